@@ -0,0 +1,101 @@
+package candycache
+
+import "time"
+
+// Включает адаптивную очистку: вместо постоянного интервала gc планирует следующий проход
+// на момент, когда устареет ближайший элемент, но не раньше чем через min и не позже чем через max.
+// Когда элементы устаревают часто, очистка идет чаще, а когда кэш стабилен - реже,
+// поэтому меньше и окно, в котором отдаются устаревшие данные, и пустых проходов.
+// Интервал, переданный в Cacher или SetCleanupInterval, при этом только включает
+// и выключает автоматическую очистку (она работает, если он > 0), а WithCleanupJitter не действует.
+// Если добавленный элемент устареет раньше запланированного прохода, проход переносится на его срок.
+// Ближайший момент устаревания ищется перебором всех элементов за O(n), а с WithExpiryBuckets -
+// по корзинам, с точностью до ширины корзины.
+// Если max <= 0 или max < min, опция ничего не делает.
+func WithAdaptiveCleanup(min, max time.Duration) Option {
+	return func(c *Cache) {
+		if max <= 0 || max < min {
+			return
+		}
+
+		c.adaptiveMin = min
+		c.adaptiveMax = max
+		c.gcWake = make(chan struct{}, 1)
+	}
+}
+
+// gc с адаптивным интервалом.
+func (c *Cache) adaptiveGC(stop <-chan struct{}) {
+	timer := time.NewTimer(c.nextCleanup())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			c.cleanupAndLog("gc")
+			timer.Reset(c.nextCleanup())
+		case <-c.gcWake:
+			timer.Reset(c.nextCleanup())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Будит адаптивный gc, если элемент с моментом устаревания destroyTimestamp
+// устареет раньше запланированного прохода. Без блокировки.
+func (c *Cache) wakeGC(destroyTimestamp int64) {
+	if c.gcWake == nil || destroyTimestamp == 0 || destroyTimestamp >= c.nextRun.Load() {
+		return
+	}
+
+	select {
+	case c.gcWake <- struct{}{}:
+	default:
+	}
+}
+
+// Возвращает через сколько нужно выполнить следующую адаптивную очистку и запоминает
+// момент прохода. Момент запоминается под блокировкой, чтобы запись, сделанная сразу после
+// расчета, увидела его и при необходимости разбудила gc.
+func (c *Cache) nextCleanup() time.Duration {
+	c.RLock()
+	defer c.RUnlock()
+
+	now := c.now()
+	wait := c.adaptiveMax
+	if soonest := c.soonestExpiry(); soonest != 0 {
+		wait = time.Duration(soonest - now)
+	}
+
+	wait = min(max(wait, c.adaptiveMin, 1), c.adaptiveMax)
+	c.nextRun.Store(now + int64(wait))
+
+	return wait
+}
+
+// Вернет ближайший момент, когда элемент станет устаревшим, слишком старым (WithMaxAge)
+// или слишком долго без обращений (WithEvictAfterIdle), в Unix-наносекундах.
+// Если таких элементов нет, вернет 0. Без блокировки.
+func (c *Cache) soonestExpiry() int64 {
+	limits := c.limits()
+
+	if c.buckets != nil && !limits.any() {
+		return c.buckets.soonest()
+	}
+
+	soonest := int64(0)
+	for _, item := range c.storage.Range {
+		if item.frozen {
+			continue
+		}
+
+		ts := expiryMoment(item, limits)
+
+		if ts != 0 && (soonest == 0 || ts < soonest) {
+			soonest = ts
+		}
+	}
+
+	return soonest
+}
@@ -0,0 +1,112 @@
+package candycache
+
+import (
+	"slices"
+	"time"
+)
+
+// Добавление элемента по основному ключу primary с дополнительными ключами aliases, только если
+// ни по одному из этих ключей нет неустаревшего элемента, как в Add. Если элемент уже есть,
+// вернет ErrKeyExists, если места нет - ErrCacheFull.
+// Данные хранятся один раз, под основным ключом, а каждый псевдоним - это только запись
+// "псевдоним -> основной ключ", поэтому большое значение, доступное по нескольким ключам
+// (например, пользователь по ID и по почте), не дублируется.
+// Get, TryGet и Has по псевдониму работают с элементом основного ключа - с его временем жизни
+// и статистикой. Остальные методы (Delete, Expire, TouchMany и т.д.) работают только с основным ключом.
+// Псевдонимы живут, пока живет элемент: удаление элемента по основному ключу (Delete, очистка,
+// вытеснение, Flush и т.д.) удаляет и все его псевдонимы, а замена элемента через Set или Add
+// снимает их, как и зависимости в AddWithDeps.
+// Элемент, записанный прямо по ключу, совпадающему с псевдонимом, заслоняет псевдоним:
+// Get по этому ключу вернет его, а не элемент основного ключа. Если псевдоним занят устаревшим
+// элементом другого основного ключа, он переходит к новому элементу.
+// Псевдонимы не попадают в дамп (Save) и забываются при ReplaceAll, Rekey, Reset и Drain.
+func (c *Cache) AddWithAliases(primary string, aliases []string, data interface{}, ttl time.Duration) error {
+	c.Lock()
+	defer c.unlock()
+
+	now := c.now()
+	if item, found := c.storage.Get(primary); found && !item.expired(now) {
+		return ErrKeyExists
+	}
+
+	for _, alias := range aliases {
+		if c.aliasTaken(alias, primary, now) {
+			return ErrKeyExists
+		}
+	}
+
+	item := c.newItem(data, ttl)
+	item.aliases = slices.Clone(aliases)
+
+	return c.store(primary, item)
+}
+
+// Возвращает дополнительные ключи элемента (см. AddWithAliases).
+func (i *Item) Aliases() []string {
+	return i.aliases
+}
+
+// Определяет занят ли ключ alias неустаревшим элементом, кроме элемента primary. Без блокировки.
+func (c *Cache) aliasTaken(alias, primary string, now int64) bool {
+	if alias == primary {
+		return false
+	}
+
+	if item, found := c.storage.Get(alias); found && !item.expired(now) {
+		return true
+	}
+
+	owner, found := c.aliases[alias]
+	if !found || owner == primary {
+		return false
+	}
+
+	item, found := c.storage.Get(owner)
+
+	return found && !item.expired(now)
+}
+
+// Запоминает, что ключи aliases ведут к элементу key. Без блокировки.
+func (c *Cache) alias(key string, aliases []string) {
+	if len(aliases) == 0 {
+		return
+	}
+
+	if c.aliases == nil {
+		c.aliases = make(map[string]string)
+	}
+
+	for _, alias := range aliases {
+		if alias != key {
+			c.aliases[alias] = key
+		}
+	}
+}
+
+// Забывает псевдонимы aliases элемента key. Псевдонимы, которые уже перешли
+// к другому элементу, не трогает. Без блокировки.
+func (c *Cache) unalias(key string, aliases []string) {
+	for _, alias := range aliases {
+		if c.aliases[alias] == key {
+			delete(c.aliases, alias)
+		}
+	}
+}
+
+// Возвращает ключ, под которым хранится элемент для key: сам key, если по нему есть элемент
+// или он не псевдоним, иначе основной ключ псевдонима. Без блокировки.
+func (c *Cache) resolve(key string) string {
+	if c.aliases == nil {
+		return key
+	}
+
+	if _, found := c.storage.Get(key); found {
+		return key
+	}
+
+	if primary, found := c.aliases[key]; found {
+		return primary
+	}
+
+	return key
+}
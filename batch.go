@@ -0,0 +1,91 @@
+package candycache
+
+import (
+	"errors"
+	"time"
+)
+
+// Пачка операций записи, которые накапливаются без блокировки кэша и применяются
+// все вместе методом Commit под одной блокировкой на запись.
+// Пока пачка не применена, ее операции не видны ни Get, ни другим методам кэша.
+// Пачку нельзя использовать из нескольких горутин одновременно.
+type Batch struct {
+	cache *Cache
+	ops   []batchOp
+}
+
+// Вид операции в пачке.
+type batchOpKind int
+
+const (
+	batchSet batchOpKind = iota
+	batchAdd
+	batchDelete
+)
+
+// Отложенная операция пачки.
+type batchOp struct {
+	kind batchOpKind
+	key  string
+	data interface{}
+	ttl  time.Duration
+}
+
+// Создает пустую пачку операций для кэша c.
+func (c *Cache) Batch() *Batch {
+	return &Batch{cache: c}
+}
+
+// Добавляет в пачку запись элемента, как Set.
+func (b *Batch) Set(key string, data interface{}, ttl time.Duration) {
+	b.ops = append(b.ops, batchOp{kind: batchSet, key: key, data: data, ttl: ttl})
+}
+
+// Добавляет в пачку добавление элемента без замены, как Add.
+func (b *Batch) Add(key string, data interface{}, ttl time.Duration) {
+	b.ops = append(b.ops, batchOp{kind: batchAdd, key: key, data: data, ttl: ttl})
+}
+
+// Добавляет в пачку удаление элемента по ключу, как Delete.
+func (b *Batch) Delete(key string) {
+	b.ops = append(b.ops, batchOp{kind: batchDelete, key: key})
+}
+
+// Вернет количество операций, ожидающих применения.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Применяет все операции пачки по порядку под одной блокировкой кэша на запись, так что
+// другие горутины видят их как одну. Время жизни элементов отсчитывается от момента Commit.
+// Операция, которая не удалась (ErrKeyExists у Add, ErrKeyNotFound у Delete, ErrCacheFull,
+// ErrClosed), не отменяет остальные; ее ошибка попадает в результат (errors.Join), поэтому
+// его можно проверять через errors.Is. После Commit пачка пуста и ее можно использовать снова.
+func (b *Batch) Commit() error {
+	c := b.cache
+
+	c.Lock()
+	defer c.unlock()
+
+	var errs []error
+	for _, op := range b.ops {
+		var err error
+		switch op.kind {
+		case batchSet:
+			err = c.set(op.key, op.data, op.ttl)
+		case batchAdd:
+			err = c.add(op.key, op.data, op.ttl)
+		case batchDelete:
+			err = c.delete(op.key)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	clear(b.ops)
+	b.ops = b.ops[:0]
+
+	return errors.Join(errs...)
+}
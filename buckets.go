@@ -0,0 +1,113 @@
+package candycache
+
+import "time"
+
+// Корзины устаревания: элементы сгруппированы по моменту устаревания с шагом width,
+// чтобы очистка перебирала только элементы, срок которых уже подошел.
+type expiryBuckets struct {
+	width   int64                         // Ширина корзины в наносекундах
+	buckets map[int64]map[string]struct{} // Номер корзины -> ключи элементов в ней
+}
+
+// Создает пустые корзины устаревания шириной width.
+func newExpiryBuckets(width time.Duration) *expiryBuckets {
+	return &expiryBuckets{
+		width:   int64(width),
+		buckets: make(map[int64]map[string]struct{}),
+	}
+}
+
+// Добавляет ключ элемента с моментом устаревания destroyTimestamp в его корзину.
+// Элементы, которые никогда не устаревают, ни в какую корзину не попадают.
+func (b *expiryBuckets) add(key string, destroyTimestamp int64) {
+	if destroyTimestamp == 0 {
+		return
+	}
+
+	id := destroyTimestamp / b.width
+	bucket, found := b.buckets[id]
+	if !found {
+		bucket = make(map[string]struct{})
+		b.buckets[id] = bucket
+	}
+
+	bucket[key] = struct{}{}
+}
+
+// Удаляет ключ элемента с моментом устаревания destroyTimestamp из его корзины.
+func (b *expiryBuckets) remove(key string, destroyTimestamp int64) {
+	if destroyTimestamp == 0 {
+		return
+	}
+
+	id := destroyTimestamp / b.width
+	bucket, found := b.buckets[id]
+	if !found {
+		return
+	}
+
+	delete(bucket, key)
+	if len(bucket) == 0 {
+		delete(b.buckets, id)
+	}
+}
+
+// Вызывает fn для каждого ключа из корзин, срок которых наступил к моменту now.
+// В последней из них могут оказаться элементы, которые еще не устарели, - fn должна это проверять.
+// fn может удалять ключи из корзин.
+func (b *expiryBuckets) due(now int64, fn func(key string)) {
+	last := now / b.width
+
+	ids := []int64{}
+	for id := range b.buckets {
+		if id <= last {
+			ids = append(ids, id)
+		}
+	}
+
+	for _, id := range ids {
+		for key := range b.buckets[id] {
+			fn(key)
+		}
+	}
+}
+
+// Вернет начало самой ранней непустой корзины в Unix-наносекундах (0 - корзин нет).
+// Элементы в ней устаревают не раньше этого момента.
+func (b *expiryBuckets) soonest() int64 {
+	soonest, found := int64(0), false
+	for id := range b.buckets {
+		if !found || id < soonest {
+			soonest, found = id, true
+		}
+	}
+
+	return soonest * b.width
+}
+
+// Вернет сколько элементов устарело к моменту now. Корзины, которые целиком раньше now,
+// учитываются по размеру, и только ключи последней корзины проверяются через expired.
+func (b *expiryBuckets) expiredCount(now int64, expired func(key string) bool) int {
+	last := now / b.width
+
+	count := 0
+	for id, bucket := range b.buckets {
+		switch {
+		case id < last:
+			count += len(bucket)
+		case id == last:
+			for key := range bucket {
+				if expired(key) {
+					count++
+				}
+			}
+		}
+	}
+
+	return count
+}
+
+// Удаляет все ключи из корзин.
+func (b *expiryBuckets) clear() {
+	b.buckets = make(map[int64]map[string]struct{})
+}
@@ -0,0 +1,97 @@
+package candycache
+
+import (
+	"container/list"
+	"time"
+)
+
+// Сколько элементов очистка с ограниченной длительностью проверяет между замерами времени.
+const cleanupBudgetStep = 64
+
+// Ограничивает время, на которое очистка (Cleanup, автоматическая очистка) удаляет устаревшие
+// элементы под блокировкой на запись: очистка проходит элементы, пока не истечет d, затем
+// отпускает блокировку, а следующая очистка продолжает с того же места. Так на огромном кэше
+// пауза для остальных горутин не превышает примерно d (плюс проверку cleanupBudgetStep элементов
+// и вызов обработчиков удаления вне блокировки), ценой того, что полный проход растягивается
+// на несколько очисток и устаревшие элементы удаляются позже.
+// Место продолжения хранится в порядке добавления, поэтому опция включает WithInsertionOrder
+// (со всеми ее расходами памяти), а элементы удаляются в порядке добавления небольшими группами,
+// внутри группы - в порядке WithCleanupOrder. Корзины устаревания (WithExpiryBuckets) такая очистка
+// не использует. Вытеснение ради WithSoftByteTarget и уплотнение хранилища не ограничиваются.
+// Если d <= 0, ограничения нет (по умолчанию).
+func WithMaxCleanupDuration(d time.Duration) Option {
+	return func(c *Cache) {
+		c.maxCleanup = d
+		if d > 0 && c.order == nil {
+			WithInsertionOrder()(c)
+		}
+	}
+}
+
+// Удаляет устаревшие элементы, начиная с места, где остановилась прошлая очистка,
+// пока не истечет maxCleanup. Вернет сколько элементов было удалено.
+func (c *Cache) cleanupBudgeted() int {
+	c.Lock()
+	defer c.unlock()
+
+	if c.sealed {
+		return 0
+	}
+
+	deadline := time.Now().Add(c.maxCleanup)
+	now := c.now()
+	limits := c.limits()
+	swept := 0
+
+	element := c.resumeCleanup()
+	for element != nil && time.Now().Before(deadline) {
+		expired := []KeyItemPair{}
+		for i := 0; i < cleanupBudgetStep && element != nil; i++ {
+			key := element.Value.(orderedKey).key
+			if item, found := c.storage.Get(key); found && item.outlived(now, limits) {
+				expired = append(expired, KeyItemPair{Key: key, Item: item})
+			}
+			element = element.Next()
+		}
+
+		// Удаление может убрать и следующий ключ (например, зависимый), поэтому
+		// место продолжения запоминается до удаления и проверяется после.
+		c.cleanupCursor = nil
+		if element != nil {
+			next := element.Value.(orderedKey)
+			c.cleanupCursor = &next
+		}
+
+		swept += c.removeExpired(expired, limits)
+
+		if c.cleanupCursor == nil {
+			break
+		}
+		element = c.resumeCleanup()
+	}
+
+	c.stats.expired.Add(uint64(swept))
+
+	return swept
+}
+
+// Вернет узел порядка добавления, с которого продолжается очистка: запомненный ключ, если он
+// еще на месте, иначе первый ключ, добавленный после него (nil - проход окончен).
+// Без запомненного ключа проход начинается сначала.
+func (c *Cache) resumeCleanup() *list.Element {
+	cursor := c.cleanupCursor
+	if cursor == nil {
+		return c.order.keys.Front()
+	}
+
+	if element, found := c.order.elements[cursor.key]; found && element.Value.(orderedKey).seq == cursor.seq {
+		return element
+	}
+
+	element := c.order.keys.Front()
+	for element != nil && element.Value.(orderedKey).seq <= cursor.seq {
+		element = element.Next()
+	}
+
+	return element
+}
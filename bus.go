@@ -0,0 +1,132 @@
+package candycache
+
+import (
+	"slices"
+	"sync"
+)
+
+// Шина инвалидации связывает несколько кэшей одного процесса: опубликованное в нее
+// событие удаляет ключ или метку из каждого подключенного кэша.
+// Публикация не блокирует отправителя - события доставляются отдельной горутиной
+// в порядке публикации и никогда не теряются.
+type InvalidationBus struct {
+	mu      sync.Mutex
+	caches  []*Cache
+	queue   []invalidation
+	wake    chan struct{}
+	stop    chan struct{}
+	stopped bool
+}
+
+// Событие шины инвалидации.
+type invalidation struct {
+	key string
+	tag bool // key - это метка (см. WithItemTags), а не ключ
+}
+
+// Создает шину инвалидации и запускает горутину доставки событий.
+// Горутина работает до вызова Close.
+func NewInvalidationBus() *InvalidationBus {
+	bus := &InvalidationBus{
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+	go bus.deliver()
+	return bus
+}
+
+// Подключает кэш к шине. Повторное подключение ничего не делает.
+func (c *Cache) AttachBus(bus *InvalidationBus) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	if !slices.Contains(bus.caches, c) {
+		bus.caches = append(bus.caches, c)
+	}
+}
+
+// Отключает кэш от шины.
+func (c *Cache) DetachBus(bus *InvalidationBus) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	bus.caches = slices.DeleteFunc(bus.caches, func(cache *Cache) bool {
+		return cache == c
+	})
+}
+
+// Удаляет элемент с ключом key из всех подключенных кэшей.
+func (b *InvalidationBus) Invalidate(key string) {
+	b.publish(invalidation{key: key})
+}
+
+// Удаляет элементы с меткой tag из всех подключенных кэшей.
+func (b *InvalidationBus) InvalidateTag(tag string) {
+	b.publish(invalidation{key: tag, tag: true})
+}
+
+// Останавливает доставку событий. Еще не доставленные события будут отброшены,
+// а события, опубликованные после Close, игнорируются.
+func (b *InvalidationBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.stopped {
+		b.stopped = true
+		b.queue = nil
+		close(b.stop)
+	}
+}
+
+// Ставит событие в очередь и будит горутину доставки.
+func (b *InvalidationBus) publish(event invalidation) {
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		return
+	}
+	b.queue = append(b.queue, event)
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Горутина доставки: забирает накопившиеся события и применяет их ко всем подключенным кэшам.
+func (b *InvalidationBus) deliver() {
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-b.wake:
+		}
+
+		b.mu.Lock()
+		queue, caches := b.queue, slices.Clone(b.caches)
+		b.queue = nil
+		b.mu.Unlock()
+
+		for _, event := range queue {
+			for _, c := range caches {
+				c.invalidate(event.key, event.tag)
+			}
+		}
+	}
+}
+
+// Применяет событие шины: удаляет элемент с ключом key или, если tag, элементы с такой меткой.
+// Запечатанный кэш (Seal) событие пропускает.
+func (c *Cache) invalidate(key string, tag bool) {
+	c.Lock()
+	defer c.unlock()
+
+	switch {
+	case c.sealed:
+	case tag:
+		c.deleteTag(key)
+	default:
+		c.delete(key)
+	}
+}
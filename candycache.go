@@ -1,18 +1,46 @@
 package candycache
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
+	"iter"
+	"math/rand/v2"
 	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 )
 
-// JSON структура для создания/загрузки дампов
+// Ошибка, возвращаемая, если элемента с указанным ключом нет в кэше.
+var ErrKeyNotFound = errors.New("candycache: key not found")
+
+// Ошибка, возвращаемая Add, если по ключу уже хранится неустаревший элемент.
+var ErrKeyExists = errors.New("candycache: key already exists")
+
+// Ошибка, возвращаемая Append, если по ключу хранится не []interface{}.
+var ErrNotSlice = errors.New("candycache: value is not a []interface{}")
+
+// Ошибка, возвращаемая Get, если по ключу закэширован отрицательный результат (см. AddNegative).
+var ErrNegative = errors.New("candycache: negative entry")
+
+// JSON структура для создания/загрузки дампов.
+// TTL заполняется только в дампах, созданных через SaveRelative,
+// CreatedAt - только в дампах, созданных через Save.
 type Dump struct {
 	Key              string      `json:"key"`
 	DestroyTimestamp int64       `json:"destroyTimestamp"`
+	TTL              *int64      `json:"ttl,omitempty"`
+	CreatedAt        int64       `json:"createdAt,omitempty"`
+	Negative         bool        `json:"negative,omitempty"`
+	Protected        bool        `json:"protected,omitempty"`
+	Tags             []string    `json:"tags,omitempty"`
+	Cost             int64       `json:"cost,omitempty"`
 	Data             interface{} `json:"data"`
 }
 
@@ -22,127 +50,1677 @@ type KeyItemPair struct {
 	Item Item
 }
 
+// Элемент для заполнения кэша через Fill.
+type KeyDataTTL struct {
+	Key  string
+	Data interface{}
+	TTL  time.Duration
+}
+
 // Элемент в кэше - это данные и время их жизни.
 type Item struct {
-	destroyTimestamp int64       // Момент в Unix-секундах, когда элемент становится устаревшим
-	data             interface{} // Данные
+	destroyTimestamp int64          // Момент в Unix-наносекундах, когда элемент становится устаревшим (0 - никогда)
+	createdAt        int64          // Момент в Unix-наносекундах, когда элемент был добавлен
+	negative         bool           // Элемент - закэшированный отрицательный результат
+	version          uint64         // Версия элемента, меняется при каждой записи
+	protected        bool           // Элемент не вытесняется ради ограничений размера кэша
+	tags             []string       // Метки элемента
+	cost             int64          // Стоимость элемента
+	hits             *atomic.Uint64 // Сколько раз элемент был найден (общий для всех копий Item)
+	dependsOn        []string       // Ключи элементов, при удалении которых удаляется и этот элемент
+	aliases          []string       // Дополнительные ключи, по которым доступен элемент (см. AddWithAliases)
+	frozen           bool           // Элемент заморожен (Freeze) и не устаревает
+	onExpired        EvictedFunc    // Обработчик устаревания этого элемента (см. WithItemExpiryCallback)
+	idleTTL          int64          // Сколько наносекунд элемент живет без обращений (0 - не ограничено, см. WithIdleTTL)
+	lastAccess       *atomic.Int64  // Момент последнего обращения в Unix-наносекундах (nil без WithIdleTTL и WithAccessTracking, общий для всех копий Item)
+	retains          int            // Сколько раз очистка продлила устаревший элемент (см. WithExpiryRetention)
+	signal           *itemSignal    // Каналы, закрываемые при уходе элемента из кэша (nil - нет, см. AddWithSignal)
+	loadErr          error          // Ошибка загрузки, которую хранит отрицательный элемент (nil - нет, см. WithErrorTTL)
+	data             interface{}    // Данные
+}
+
+// Кэш - это хранилище элементов и инервал его очистки (ну и мьютекс на всякий случай).
+// Интервал очистки хранилища укахывается в НАНОСЕКУНДАХ (используй множители для преобразования во что-то другое).
+type Cache struct {
+	locker                                            // Блокировка для безопасного доступа к общим данным (sync.RWMutex, см. WithoutLocking)
+	storage         Store                             // Хранилище элементов
+	cleanupInterval time.Duration                     // Интервал очистки хранилища в наносекундах
+	logger          Logger                            // Функция для логирования событий кэша (nil - не логировать)
+	maxAge          time.Duration                     // Максимальный возраст элемента (0 - не ограничен)
+	evictAfterIdle  time.Duration                     // Предельное время без обращений для очистки (0 - не ограничено, см. WithEvictAfterIdle)
+	lockTimeout     time.Duration                     // Сколько TryGet/TryAdd ждут блокировку
+	extendCap       time.Duration                     // Насколько вперед от текущего момента GetExtend может продлить элемент (0 - не ограничено)
+	softByteTarget  int                               // Размер в байтах, к которому очистка ужимает кэш (0 - не ужимать)
+	maxValueSize    int                               // Наибольший размер данных элемента в байтах (0 - не ограничен, см. WithMaxValueSize)
+	stats           stats                             // Счетчики статистики
+	onEvicted       EvictedFunc                       // Обработчик удаления элемента (nil - не вызывать)
+	onEvictedReason EvictedReasonFunc                 // Обработчик удаления элемента с причиной (nil - не вызывать)
+	evicted         []evictedItem                     // Удаленные под блокировкой элементы, для которых еще не вызваны обработчики удаления
+	buckets         *expiryBuckets                    // Корзины устаревания (nil - очистка перебирает все элементы)
+	copyOnGet       bool                              // Копировать данные при добавлении и получении
+	cleanupJitter   float64                           // Доля интервала очистки, на которую он случайно отклоняется
+	version         uint64                            // Последняя выданная версия элемента
+	epoch           atomic.Uint64                     // Сколько раз кэш сбрасывался целиком (см. Epoch)
+	approxCount     atomic.Int64                      // Количество элементов на момент последнего unlock (см. ApproxCount)
+	keyFunc         KeyFunc                           // Превращает ключи любых типов в строки (nil - по умолчанию, см. WithKeyFunc)
+	fallback        *Cache                            // Следующий уровень кэша для промахов (nil - нет, см. WithFallback)
+	promoteTTL      time.Duration                     // Наибольшее время жизни элемента, поднятого со следующего уровня (0 - не ограничено)
+	writes          *writeTracker                     // Счетчики записей по ключам (nil - не считать, см. WithWriteTracking)
+	gcMu            sync.Mutex                        // Мьютекс для запуска и остановки gc
+	gcStop          chan struct{}                     // Закрывается для остановки gc (nil - gc не запущен)
+	capacity        int                               // Максимальное количество элементов (0 - не ограничено)
+	sweepOnFull     bool                              // Удалять устаревшие элементы перед вытеснением из заполненного кэша
+	closed          bool                              // Кэш закрыт (Close), запись запрещена
+	sealed          bool                              // Кэш запечатан (Seal), любые изменения запрещены
+	dependents      map[string]map[string]struct{}    // Ключ -> ключи зависящих от него элементов (см. AddWithDeps)
+	aliases         map[string]string                 // Псевдоним -> основной ключ элемента (см. AddWithAliases)
+	indexes         map[string]*index                 // Вторичные индексы по имени (см. Index)
+	adaptiveMin     time.Duration                     // Наименьший интервал адаптивной очистки
+	adaptiveMax     time.Duration                     // Наибольший интервал адаптивной очистки (0 - очистка с постоянным интервалом)
+	gcWake          chan struct{}                     // Будит адаптивный gc, чтобы он перепланировал проход
+	nextRun         atomic.Int64                      // Момент следующего прохода адаптивного gc в Unix-наносекундах
+	clock           func() time.Time                  // Источник текущего времени (см. WithClock)
+	base            time.Time                         // Момент создания кэша по clock, от него отсчитывается время
+	baseUnix        int64                             // base в Unix-наносекундах
+	fill            *fillThreshold                    // Порог заполненности (nil - не отслеживать, см. OnFillThreshold)
+	fillEvents      []bool                            // Пересечения порога заполненности, для которых еще не вызван обработчик
+	logEvents       []logEvent                        // События, записанные под блокировкой, которые еще не переданы в логгер
+	policies        []prefixPolicy                    // Правила для префиксов ключей, самые длинные префиксы - первыми
+	empty           chan struct{}                     // Закрывается при удалении элемента, чтобы разбудить WaitEmpty (nil - никто не ждет)
+	waits           map[string]*leaderWait            // Ключи, значения для которых вычисляют лидеры GetOrWait
+	minLoadFactor   float64                           // Доля пика, ниже которой хранилище уплотняется (0 - не уплотнять)
+	evictionLess    func(a, b EvictionCandidate) bool // Порядок вытеснения (nil - EvictByExpiry)
+	peak            int                               // Наибольшее количество элементов с прошлого уплотнения
+	fairNamespaces  bool                              // Вытеснять из самого большого пространства имен (см. WithFairNamespaceEviction)
+	namespaces      []string                          // Префиксы пространств имен, самые длинные - первыми
+	quotaTracking   bool                              // Есть пространство с квотой: заводить элементам отметку обращений (см. Namespace)
+	fifo            bool                              // Вытеснять в порядке добавления (см. WithFIFOEviction)
+	order           *insertionOrder                   // Порядок добавления ключей (nil - не отслеживать, см. WithInsertionOrder)
+	ticks           <-chan time.Time                  // Внешний источник сигналов очистки (nil - свой таймер, см. WithTickSource)
+	copyTypes       map[reflect.Type]struct{}         // Типы, данные которых копируются (см. WithCopyTypes)
+	rawBytes        bool                              // Возвращать срезы байт без обрезки емкости (см. WithoutBytesClip)
+	initial         []initialEntries                  // Начальные элементы, ожидающие добавления при создании (см. WithInitialEntries)
+	earlyBeta       float64                           // Коэффициент досрочного устаревания XFetch (0 - выключено, см. WithEarlyExpiration)
+	loadMu          sync.Mutex                        // Мьютекс для loads
+	loads           map[string]*loadCall[interface{}] // Идущие загрузки GetOrLoad по ключам
+	validateOnAdd   bool                              // Проверять данные при добавлении (см. WithValidateOnAdd)
+	cleanupOrder    CleanupOrder                      // Порядок удаления устаревших элементов с одинаковым моментом устаревания
+	ghosts          *ghostKeys                        // Ключи недавно вытесненных элементов (nil - не отслеживать, см. WithGhostKeys)
+	idleKeys        map[string]struct{}               // Ключи элементов с WithIdleTTL, если включены корзины устаревания
+	maxCleanup      time.Duration                     // Наибольшая длительность очистки под блокировкой (0 - не ограничена)
+	cleanupCursor   *orderedKey                       // Ключ, с которого продолжится очистка с ограниченной длительностью (nil - с начала)
+	maxTTL          time.Duration                     // Наибольшее время жизни любого элемента (0 - не ограничено, см. WithMaxTTL)
+	maxWaiters      int64                             // Наибольшее количество одновременно ждущих вызовов (0 - не ограничено)
+	retain          RetainFunc                        // Продлевает устаревшие элементы перед удалением (nil - не продлевать)
+	codec           Codec                             // Формат дампов Save и Load (nil - JSON по элементам, см. WithCodec)
+	signals         bool                              // В кэш добавлялись элементы с сигналом (см. AddWithSignal)
+	accessTracking  bool                              // Запоминать момент последнего обращения к каждому элементу (см. WithAccessTracking)
+	observeLoad     LoadObserver                      // Получает сведения о вызовах сквозного чтения (nil - никто, см. WithLoadObserver)
+	errorTTL        time.Duration                     // Сколько GetOrLoad помнит ошибку загрузки (0 - не помнит, см. WithErrorTTL)
+	maxRetains      int                               // Сколько раз можно продлить один элемент (0 - не ограничено)
+}
+
+// Функция, которую кэш вызывает при значимых событиях.
+// event - название события, fields - его параметры.
+type Logger func(event string, fields map[string]interface{})
+
+// Функция, которую кэш вызывает для удаленного элемента.
+type EvictedFunc func(key string, data interface{})
+
+// Опция, настраивающая кэш при создании.
+type Option func(*Cache)
+
+// Задает функцию для логирования событий кэша.
+// События:
+// "gc" - автоматическая очистка, поля "swept" (сколько устаревших элементов удалено),
+// "evicted" и "reclaimed" (сколько элементов и байт освобождено ради WithSoftByteTarget),
+// "compacted" (было ли уплотнено хранилище, см. WithAutoCompact) и "duration";
+// "cleanup" - ручной вызов Cleanup, поля те же;
+// "retain_limit" - элемент удален, исчерпав продления WithExpiryRetention, поля "key" и "retains".
+// Функция вызывается вне блокировки кэша, поэтому может обращаться к нему.
+func WithLogger(logger Logger) Option {
+	return func(c *Cache) {
+		c.logger = logger
+	}
+}
+
+// Задает максимальный возраст элементов кэша.
+// При очистке удаляются элементы, добавленные раньше чем maxAge назад,
+// даже если их время жизни еще не истекло.
+// Ограничение применяется только при очистке - до нее такие элементы остаются доступными.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(c *Cache) {
+		c.maxAge = maxAge
+	}
+}
+
+// Задает сколько методы TryGet и TryAdd ждут освобождения блокировки кэша,
+// прежде чем вернуть ErrBusy. По умолчанию они не ждут совсем.
+// Остальные методы кэша ждут блокировку сколько потребуется.
+// Ожидание - это опрос, а не очередь: пока блокировка занята, попытка взять ее повторяется
+// каждые 50 мкс, а между попытками горутина спит. Поэтому освободившуюся блокировку TryGet
+// и TryAdd замечают с задержкой до интервала опроса (с учетом точности таймеров ОС - и дольше),
+// могут раз за разом уступать ее методам, которые ждут в очереди мьютекса, а каждая ждущая
+// горутина просыпается до timeout/50мкс раз. Большой timeout при многих ждущих тратит процессор;
+// таймаут имеет смысл задавать порядка миллисекунд.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(c *Cache) {
+		c.lockTimeout = timeout
+	}
+}
+
+// Ограничивает продление элементов через GetExtend: после продления элемент
+// устареет не позже чем через extendCap от текущего момента. Срок элемента, который
+// уже дальше этого предела, GetExtend оставляет как есть.
+func WithExtendCap(extendCap time.Duration) Option {
+	return func(c *Cache) {
+		c.extendCap = extendCap
+	}
+}
+
+// Задает желаемый размер кэша в байтах (считается так же, как в Size).
+// Если после удаления устаревших элементов кэш все еще больше target, очистка удаляет
+// неустаревшие элементы, начиная с самых холодных, пока размер не станет меньше target:
+// с WithAccessTracking - тех, к которым дольше всех не обращались (EvictByLRU), иначе - с меньшим
+// количеством попаданий (EvictByHits), а при равенстве - тех, что устареют раньше.
+// С WithEvictionComparator или WithFIFOEviction элементы удаляются в заданном ими порядке.
+// Защищенные элементы (AddWithPriority) не удаляются.
+// Добавление элементов при этом не замедляется - кэш ужимается только при очистке.
+func WithSoftByteTarget(target int) Option {
+	return func(c *Cache) {
+		c.softByteTarget = target
+	}
+}
+
+// Задает обработчик, который вызывается для каждого элемента, удаленного из кэша:
+// через Delete, DeletePrefix, DeleteMatch, Flush, FlushContext, транзакцию или очисткой.
+// Замена элемента через Set и Reset обработчик не вызывают.
+// Обработчик вызывается вне блокировки кэша, поэтому может обращаться к нему.
+// Чтобы узнать причину удаления, используйте WithOnEvictedReason.
+func WithOnEvicted(onEvicted EvictedFunc) Option {
+	return func(c *Cache) {
+		c.onEvicted = onEvicted
+	}
+}
+
+// Включает корзины устаревания шириной width: элементы группируются по моменту устаревания,
+// и очистка перебирает только корзины, срок которых уже наступил, а не весь кэш.
+// Это ограничивает работу очистки количеством действительно устаревших элементов ценой
+// небольшой дополнительной памяти на каждый элемент и работы при каждом добавлении и удалении.
+// С WithMaxAge и WithEvictAfterIdle очистка все равно перебирает все элементы, чтобы найти
+// слишком старые и давно не читанные.
+func WithExpiryBuckets(width time.Duration) Option {
+	return func(c *Cache) {
+		if width > 0 {
+			c.buckets = newExpiryBuckets(width)
+		}
+	}
+}
+
+// Включает копирование данных: при добавлении (Set, Add, Fill) в кэш кладется глубокая копия данных,
+// а при получении (Get, GetExtend, TryGet, транзакции) возвращается глубокая копия хранимых данных.
+// Так изменение полученного значения не портит значение в кэше и не влияет на другие горутины.
+// Копируются срезы, массивы, карты, указатели, интерфейсы и экспортируемые поля структур;
+// неэкспортируемые поля, каналы и функции копируются как есть, структуры с циклами не поддерживаются.
+// Копирование делается через reflect и стоит аллокаций, пропорциональных размеру значения.
+// List, ListLive, All и Sample возвращают данные без копирования.
+func WithCopyOnGet() Option {
+	return func(c *Cache) {
+		c.copyOnGet = true
+	}
+}
+
+// Включает копирование данных, как WithCopyOnGet, но только для значений, динамический тип
+// которых совпадает с одним из types (например, reflect.TypeFor[*Profile]()): они копируются
+// при добавлении и при получении, а значения остальных типов хранятся и возвращаются как есть,
+// без затрат на копирование. Тип сравнивается точно: если зарегистрирован *T, значения T
+// не копируются, и наоборот, а интерфейсные типы не совпадают ни с каким значением.
+// Копирование то же, что у WithCopyOnGet, - глубокое, через reflect, с теми же ограничениями.
+// Опцию можно задать несколько раз, типы добавляются. С WithCopyOnGet копируется всё.
+func WithCopyTypes(types ...reflect.Type) Option {
+	return func(c *Cache) {
+		if c.copyTypes == nil {
+			c.copyTypes = make(map[reflect.Type]struct{}, len(types))
+		}
+
+		for _, t := range types {
+			c.copyTypes[t] = struct{}{}
+		}
+	}
+}
+
+// Отключает обрезку емкости срезов байт. По умолчанию, даже без WithCopyOnGet, данные типа
+// []byte возвращаются (Get, GetExtend, TryGet и т.д.) как b[:len(b):len(b)]: append к полученному
+// срезу выделяет новый массив, а не дописывает байты в общий массив за концом значения в кэше.
+// Сами байты при этом не копируются, поэтому изменять их по-прежнему нельзя.
+// С этой опцией срез возвращается как есть, вместе с емкостью, и упаковка заголовка среза
+// в interface{} не требует лишней аллокации.
+func WithoutBytesClip() Option {
+	return func(c *Cache) {
+		c.rawBytes = true
+	}
+}
+
+// Задает случайное отклонение интервала очистки на ±fraction от его длины
+// (fraction от 0 до 1, по умолчанию 0 - интервал точный).
+// Отклоняется и первая очистка, и каждый следующий интервал, поэтому очистка
+// нескольких экземпляров сервиса с одинаковым интервалом не происходит одновременно.
+func WithCleanupJitter(fraction float64) Option {
+	return func(c *Cache) {
+		c.cleanupJitter = min(max(fraction, 0), 1)
+	}
+}
+
+// Задает внешний источник сигналов автоматической очистки: gc не заводит своих таймеров
+// и очищает кэш каждый раз, когда из ticks приходит значение, - например, от планировщика
+// приложения или time.Ticker, которым оно управляет само. Очистка запускается, даже если
+// cleanupInterval <= 0; интервал, WithCleanupJitter и WithAdaptiveCleanup при этом не действуют.
+// Если ticks закрыт, автоматическая очистка прекращается.
+// Сигналы по-прежнему читает горутина кэша. Если горутины запрещены совсем, создайте кэш
+// с cleanupInterval <= 0 и вызывайте Cleanup из своего планировщика - она выполняется
+// в горутине вызывающего.
+func WithTickSource(ticks <-chan time.Time) Option {
+	return func(c *Cache) {
+		c.ticks = ticks
+	}
+}
+
+// Создает новый экземпляр Cache с интервалом очистки cleanupInterval.
+// Если cleanupInterval <= 0 (и отрицательный, и нулевой), то кэш не будет очищаться автоматически -
+// интервала "по умолчанию" нет, устаревшие элементы удаляются только через Cleanup.
+func Cacher(cleanupInterval time.Duration, opts ...Option) *Cache {
+	cache := newCache(cleanupInterval, opts...)
+	cache.populate()
+	cache.start()
+
+	return cache
+}
+
+// Создает кэш и применяет опции, но не заполняет его и не запускает автоматическую очистку.
+func newCache(cleanupInterval time.Duration, opts ...Option) *Cache {
+	cache := &Cache{
+		locker:          &sync.RWMutex{},
+		storage:         make(mapStore),
+		cleanupInterval: cleanupInterval,
+	}
+
+	for _, opt := range opts {
+		opt(cache)
+	}
+
+	if cache.clock == nil {
+		cache.clock = time.Now
+	}
+	cache.base = cache.clock()
+	cache.baseUnix = cache.base.UnixNano()
+
+	return cache
+}
+
+// Запускает автоматическую очистку с интервалом, заданным при создании, если кэш не закрыт.
+func (c *Cache) start() {
+	c.gcMu.Lock()
+	defer c.gcMu.Unlock()
+
+	if !c.IsClosed() {
+		c.startGC(c.cleanupInterval)
+	}
+}
+
+// Возвращает интервал очистки кэша.
+// Неположительное значение означает, что автоматическая очистка отключена.
+func (c *Cache) CleanupInterval() time.Duration {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.cleanupInterval
+}
+
+// Меняет интервал очистки кэша на лету: останавливает текущую автоматическую очистку
+// и, если cleanupInterval > 0 и кэш не закрыт, запускает новую с этим интервалом.
+// Уже идущий проход очистки при этом доводится до конца.
+func (c *Cache) SetCleanupInterval(cleanupInterval time.Duration) {
+	c.gcMu.Lock()
+	defer c.gcMu.Unlock()
+
+	c.Lock()
+	c.cleanupInterval = cleanupInterval
+	stopped := c.closed || c.sealed
+	c.Unlock()
+
+	c.stopGC()
+	if !stopped {
+		c.startGC(cleanupInterval)
+	}
+}
+
+// Запускает gc с интервалом cleanupInterval. Вызывается под gcMu.
+// Если gc уже запущен или cleanupInterval <= 0 (и не задан WithTickSource), ничего не делает,
+// поэтому у кэша никогда не бывает больше одного gc.
+func (c *Cache) startGC(cleanupInterval time.Duration) {
+	// Без блокировки (WithoutLocking) очистка в отдельной горутине была бы гонкой данных.
+	if c.gcStop != nil || (cleanupInterval <= 0 && c.ticks == nil) || c.locker == (noLock{}) {
+		return
+	}
+
+	c.gcStop = make(chan struct{})
+	go c.gc(cleanupInterval, c.gcStop)
+}
+
+// Останавливает gc, если он запущен. Вызывается под gcMu.
+func (c *Cache) stopGC() {
+	if c.gcStop == nil {
+		return
+	}
+
+	close(c.gcStop)
+	c.gcStop = nil
+}
+
+// gc = Garbage Collector.
+func (c *Cache) gc(cleanupInterval time.Duration, stop <-chan struct{}) {
+	if c.ticks != nil {
+		c.tickedGC(stop)
+		return
+	}
+
+	if c.adaptiveMax > 0 {
+		c.adaptiveGC(stop)
+		return
+	}
+
+	if c.cleanupJitter > 0 {
+		c.jitteredGC(cleanupInterval, stop)
+		return
+	}
+
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.cleanupAndLog("gc")
+		case <-stop:
+			return
+		}
+	}
+}
+
+// gc, который очищает кэш по сигналам из внешнего источника (WithTickSource).
+func (c *Cache) tickedGC(stop <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-c.ticks:
+			if !ok {
+				return
+			}
+			c.cleanupAndLog("gc")
+		case <-stop:
+			return
+		}
+	}
+}
+
+// gc со случайно отклоняющимся интервалом.
+func (c *Cache) jitteredGC(cleanupInterval time.Duration, stop <-chan struct{}) {
+	timer := time.NewTimer(c.jitter(cleanupInterval))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			c.cleanupAndLog("gc")
+			timer.Reset(c.jitter(cleanupInterval))
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Возвращает interval, случайно отклоненный на ±cleanupJitter от его длины.
+func (c *Cache) jitter(interval time.Duration) time.Duration {
+	delta := (rand.Float64()*2 - 1) * c.cleanupJitter * float64(interval)
+
+	return max(interval+time.Duration(delta), 1)
+}
+
+// Перебирает все элементы в кэше, удаляет устаревшие.
+func (c *Cache) Cleanup() {
+	c.cleanupAndLog("cleanup")
+}
+
+// Возвращает ключи элементов, которые удалила бы Cleanup, ничего не удаляя:
+// устаревшие элементы, элементы старше WithMaxAge и без обращений дольше WithEvictAfterIdle. Вытеснение ради WithSoftByteTarget не учитывается.
+func (c *Cache) CleanupDryRun() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	keys := []string{}
+	now := c.now()
+	limits := c.limits()
+
+	for key, item := range c.storage.Range {
+		if item.outlived(now, limits) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Удаляет только те элементы, которые удалила бы Cleanup (устаревшие, старше WithMaxAge
+// и без обращений дольше WithEvictAfterIdle)
+// и ключи которых подходят под pred, - например, чтобы очищать пространства имен по очереди.
+// Вернет количество удаленных элементов. Удаленные элементы считаются устаревшими (Stats.Expired).
+// Перебирает весь кэш под блокировкой на запись; pred не должна обращаться к кэшу.
+// В отличие от Cleanup, не вытесняет элементы ради WithSoftByteTarget и не уплотняет хранилище.
+func (c *Cache) CleanupFunc(pred func(key string) bool) int {
+	c.Lock()
+	defer c.unlock()
+
+	now := c.now()
+	limits := c.limits()
+	expired := []KeyItemPair{}
+
+	for key, item := range c.storage.Range {
+		if item.outlived(now, limits) && pred(key) {
+			expired = append(expired, KeyItemPair{Key: key, Item: item})
+		}
+	}
+
+	removed := c.removeExpired(expired, limits)
+	c.stats.expired.Add(uint64(removed))
+
+	return removed
+}
+
+// Выполняет очистку и логирует ее результат как событие event.
+func (c *Cache) cleanupAndLog(event string) {
+	start := time.Now()
+	swept := c.cleanup()
+	evicted, reclaimed := c.trim()
+	compacted := c.compact()
+
+	c.stats.lastCleanup.Store(time.Now().UnixNano())
+	c.stats.cleanupRuns.Add(1)
+
+	c.log(event, map[string]interface{}{
+		"swept":     swept,
+		"evicted":   evicted,
+		"reclaimed": reclaimed,
+		"compacted": compacted,
+		"duration":  time.Since(start),
+	})
+}
+
+// Удаляет устаревшие элементы, возвращает сколько элементов было удалено.
+func (c *Cache) cleanup() int {
+	if c.maxCleanup > 0 {
+		return c.cleanupBudgeted()
+	}
+
+	c.Lock()
+	defer c.unlock()
+
+	if c.sealed {
+		return 0
+	}
+
+	now := c.now()
+	limits := c.limits()
+	expired := []KeyItemPair{}
+
+	if c.buckets != nil && !limits.any() {
+		c.buckets.due(now, func(key string) {
+			if item, _ := c.storage.Get(key); item.expired(now) {
+				expired = append(expired, KeyItemPair{Key: key, Item: item})
+			}
+		})
+		c.idleExpired(now, func(key string, item Item) {
+			expired = append(expired, KeyItemPair{Key: key, Item: item})
+		})
+	} else {
+		for key, item := range c.storage.Range {
+			if item.outlived(now, limits) {
+				expired = append(expired, KeyItemPair{Key: key, Item: item})
+			}
+		}
+	}
+
+	removed := c.removeExpired(expired, limits)
+	c.stats.expired.Add(uint64(removed))
+
+	return removed
+}
+
+// Удаляет элементы, пока размер кэша не станет меньше softByteTarget.
+// Возвращает сколько элементов и байт было освобождено.
+func (c *Cache) trim() (int, int) {
+	if c.softByteTarget <= 0 {
+		return 0, 0
+	}
+
+	c.Lock()
+	defer c.unlock()
+
+	if c.sealed {
+		return 0, 0
+	}
+
+	now := c.now()
+	total := 0
+	candidates := make([]EvictionCandidate, 0, c.storage.Len())
+	for key, item := range c.storage.Range {
+		size := itemSize(key, item)
+		total += size
+		if !item.protected {
+			candidates = append(candidates, c.candidate(key, item, size, now))
+		}
+	}
+
+	if total < c.softByteTarget {
+		c.observeBytes(total)
+		return 0, 0
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return c.trimsFirst(candidates[i], candidates[j])
+	})
+
+	evicted, reclaimed := 0, 0
+	for _, candidate := range candidates {
+		if total < c.softByteTarget {
+			break
+		}
+
+		c.remove(candidate.Key, candidate.Item, EvictEvicted)
+		total -= candidate.Size
+		reclaimed += candidate.Size
+		evicted++
+	}
+
+	c.observeBytes(total)
+	c.stats.evicted.Add(uint64(evicted))
+	c.stats.reclaimedBytes.Add(uint64(reclaimed))
+
+	return evicted, reclaimed
+}
+
+// Определяет должна ли очистка ради WithSoftByteTarget удалить кандидата a раньше b:
+// без своего порядка вытеснения - более холодного (см. WithSoftByteTarget).
+func (c *Cache) trimsFirst(a, b EvictionCandidate) bool {
+	if c.evictionLess != nil || c.fifo {
+		return c.evictsFirst(a, b)
+	}
+
+	if c.accessTracking {
+		return EvictByLRU(a, b)
+	}
+
+	return EvictByHits(a, b)
+}
+
+// Учитывает размер кэша total для порога заполненности, если ограничение - WithSoftByteTarget.
+// Без блокировки.
+func (c *Cache) observeBytes(total int) {
+	if c.fill != nil && c.capacity <= 0 {
+		c.observeFill(float64(total) / float64(c.softByteTarget))
+	}
+}
+
+// Записывает элемент в хранилище без блокировки.
+func (c *Cache) put(key string, item Item) {
+	c.checkSealed()
+
+	if c.policies != nil || c.maxTTL > 0 {
+		item.destroyTimestamp = c.clampDeadline(key, item.destroyTimestamp)
+	}
+
+	if c.onEvictedReason != nil {
+		if old, found := c.storage.Get(key); found && old.version != item.version {
+			c.evict(key, old, EvictReplaced)
+		}
+	}
+
+	if c.order != nil {
+		c.order.push(key)
+	}
+
+	if c.ghosts != nil {
+		c.ghosts.remove(key)
+	}
+
+	if c.writes != nil {
+		if old, found := c.storage.Get(key); !found || old.version != item.version {
+			c.writes.record(key, c.now())
+		}
+	}
+
+	if c.buckets != nil {
+		if old, found := c.storage.Get(key); found {
+			c.buckets.remove(key, old.destroyTimestamp)
+		}
+		if !item.frozen {
+			c.buckets.add(key, item.destroyTimestamp)
+		}
+		c.trackIdle(key, item)
+	}
+
+	if c.dependents != nil {
+		if old, found := c.storage.Get(key); found {
+			c.unlink(key, old.dependsOn)
+		}
+	}
+	c.link(key, item.dependsOn)
+
+	if c.aliases != nil {
+		if old, found := c.storage.Get(key); found {
+			c.unalias(key, old.aliases)
+		}
+	}
+	c.alias(key, item.aliases)
+
+	if c.signals {
+		if old, found := c.storage.Get(key); found {
+			item.inheritSignal(old)
+		}
+	}
+
+	if c.indexes != nil {
+		old, found := c.storage.Get(key)
+		for _, idx := range c.indexes {
+			if found {
+				idx.remove(key, old)
+			}
+			idx.add(key, item)
+		}
+	}
+
+	c.wakeGC(item.destroyTimestamp)
+
+	if c.waits != nil {
+		c.releaseWaiters(key)
+	}
+
+	item.trackHits()
+	c.trackAccess(&item)
+	c.storage.Set(key, item)
+
+	if c.minLoadFactor > 0 {
+		c.peak = max(c.peak, c.storage.Len())
+	}
+}
+
+// Удаляет элемент из хранилища по причине reason без блокировки.
+// Если задан обработчик удаления, элемент запоминается, чтобы вызвать его в unlock.
+func (c *Cache) remove(key string, item Item, reason EvictReason) {
+	c.checkSealed()
+	c.storage.Delete(key)
+
+	if c.buckets != nil {
+		c.buckets.remove(key, item.destroyTimestamp)
+		delete(c.idleKeys, key)
+	}
+
+	if c.order != nil {
+		c.order.remove(key)
+	}
+
+	if c.ghosts != nil && reason == EvictEvicted {
+		c.ghosts.add(key)
+	}
+
+	if c.notifiesEvictions() || (reason == EvictExpired && item.onExpired != nil) {
+		c.evict(key, item, reason)
+	}
+
+	for _, idx := range c.indexes {
+		idx.remove(key, item)
+	}
+
+	if c.empty != nil {
+		close(c.empty)
+		c.empty = nil
+	}
+
+	if c.aliases != nil {
+		c.unalias(key, item.aliases)
+	}
+
+	if item.signal != nil {
+		item.signal.fire()
+	}
+
+	if c.dependents != nil {
+		c.unlink(key, item.dependsOn)
+		c.removeDependents(key, reason)
+	}
+}
+
+// Снимает блокировку на запись и вызывает обработчик удаления для всех элементов, удаленных
+// под ней, обработчик заполненности (OnFillThreshold) и логгер для событий, записанных под ней.
+func (c *Cache) unlock() {
+	c.approxCount.Store(int64(c.storage.Len()))
+
+	if c.fill != nil && c.capacity > 0 {
+		c.observeFill(float64(c.storage.Len()) / float64(c.capacity))
+	}
+
+	evicted, fills, events := c.evicted, c.fillEvents, c.logEvents
+	c.evicted, c.fillEvents, c.logEvents = nil, nil, nil
+
+	var fill func(over bool)
+	if c.fill != nil {
+		fill = c.fill.fn
+	}
+	c.Unlock()
+
+	for _, e := range evicted {
+		c.notifyEvicted(e.key, e.item, e.reason)
+	}
+
+	for _, over := range fills {
+		fill(over)
+	}
+
+	for _, e := range events {
+		c.log(e.event, e.fields)
+	}
+}
+
+// Событие для логгера, записанное под блокировкой.
+type logEvent struct {
+	event  string
+	fields map[string]interface{}
+}
+
+// Передает событие в логгер, если он задан.
+func (c *Cache) log(event string, fields map[string]interface{}) {
+	if c.logger != nil {
+		c.logger(event, fields)
+	}
+}
+
+// Запоминает событие для логгера, чтобы unlock передал его после снятия блокировки:
+// логгер может обращаться к кэшу. Только под блокировкой на запись.
+func (c *Cache) logLocked(event string, fields map[string]interface{}) {
+	if c.logger != nil {
+		c.logEvents = append(c.logEvents, logEvent{event: event, fields: fields})
+	}
+}
+
+// Удаление всех элементов из кэша.
+func (c *Cache) Flush() {
+	c.Lock()
+	defer c.unlock()
+
+	for key, item := range c.storage.Range {
+		c.remove(key, item, EvictFlushed)
+	}
+	c.epoch.Add(1)
+}
+
+// Атомарно заменяет все содержимое кэша элементами items с временем жизни ttl.
+// Новое хранилище строится вне блокировки и подменяется за одну короткую блокировку на запись,
+// поэтому читатели видят либо старое содержимое, либо новое, но никогда - пустой кэш.
+// Записи (Set, Add, Delete и т.д.), выполненные другими горутинами, пока строится новое
+// хранилище, не переносятся в него: они считаются сделанными до ReplaceAll и при подмене
+// пропадают, как и все старое содержимое, - даже если успели завершиться и их результат
+// уже прочитали. Если такие записи терять нельзя, их нужно повторить после ReplaceAll
+// или не выполнять одновременно с ним.
+// Для вытесненных элементов, ключей которых нет в items, вызывается обработчик удаления (WithOnEvicted).
+// Статистика сохраняется. Ограничение WithCapacity не проверяется.
+// Свое хранилище (WithStore) подменить нельзя, поэтому его содержимое заменяется поэлементно
+// под блокировкой.
+// Вторичные индексы (Index), если они есть, перестраиваются под той же блокировкой.
+func (c *Cache) ReplaceAll(items map[string]interface{}, ttl time.Duration) {
+	c.Lock()
+	c.unlockIfSealed()
+	version := c.version
+	c.version += uint64(len(items))
+	track := c.accessTracking || c.quotaTracking
+	c.Unlock()
+
+	now := c.now()
+	storage := make(mapStore, len(items))
+	for key, data := range items {
+		version++
+		item := Item{
+			destroyTimestamp: c.clampDeadline(key, deadline(now, ttl)),
+			createdAt:        now,
+			version:          version,
+			hits:             new(atomic.Uint64),
+			data:             c.copyData(data),
+		}
+		if track {
+			item.lastAccess = new(atomic.Int64)
+		}
+		storage[key] = item
+	}
+
+	var buckets *expiryBuckets
+	if c.buckets != nil {
+		buckets = newExpiryBuckets(time.Duration(c.buckets.width))
+		for key, item := range storage.Range {
+			buckets.add(key, item.destroyTimestamp)
+		}
+	}
+
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		return
+	}
+	c.unlockIfSealed()
+	old := c.swapStore(storage)
+	c.buckets = buckets
+	c.dependents = nil
+	c.aliases = nil
+	c.reindex()
+	c.fireSignals(old)
+	c.epoch.Add(1)
+	c.unlock()
+
+	if !c.notifiesEvictions() {
+		return
+	}
+
+	for key, item := range old.Range {
+		if _, found := storage[key]; found {
+			c.notifyEvicted(key, item, EvictReplaced)
+		} else {
+			c.notifyEvicted(key, item, EvictFlushed)
+		}
+	}
+}
+
+// Удаляет все элементы (и устаревшие, и нет), кроме тех, для которых keep вернет true.
+// Для удаленных элементов вызывается обработчик удаления (WithOnEvicted) - вне блокировки.
+// keep вызывается под блокировкой, поэтому не должна обращаться к кэшу.
+// Вернет количество удаленных элементов.
+func (c *Cache) FlushExcept(keep func(key string, data interface{}) bool) int {
+	c.Lock()
+	defer c.unlock()
+
+	deleted := 0
+	for key, item := range c.storage.Range {
+		if !keep(key, item.data) {
+			c.remove(key, item, EvictFlushed)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// Сколько элементов FlushContext удаляет за одну блокировку.
+const flushBatchSize = 256
+
+// Удаляет все элементы из кэша пачками по flushBatchSize, вызывая обработчик удаления
+// (WithOnEvicted) после каждой пачки. Между пачками проверяется ctx: если он отменен,
+// удаление прекращается и возвращается ctx.Err(), а еще не удаленные элементы остаются в кэше.
+// Вернет сколько элементов было удалено.
+func (c *Cache) FlushContext(ctx context.Context) (flushed int, err error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return flushed, err
+		}
+
+		c.Lock()
+		c.unlockIfSealed()
+		batch := 0
+		for key, item := range c.storage.Range {
+			if batch == flushBatchSize {
+				break
+			}
+			c.remove(key, item, EvictFlushed)
+			batch++
+		}
+		if batch < flushBatchSize {
+			c.epoch.Add(1)
+		}
+		c.unlock()
+
+		flushed += batch
+		if batch < flushBatchSize {
+			return flushed, nil
+		}
+	}
+}
+
+// Приводит кэш в исходное состояние: заменяет хранилище новым пустым.
+// В отличие от Flush, который удаляет элементы по одному и оставляет за хранилищем
+// уже выделенную память, Reset отпускает старое хранилище целиком
+// (свое хранилище, заданное WithStore, просто очищается).
+// Заодно обнуляются статистика (Stats, GhostHits, Compactions, LastCleanup и т.д.), счетчики
+// записей WithWriteTracking и ключи WithGhostKeys, так что итерации не видят чужих цифр.
+// Обработчик удаления (WithOnEvicted) для удаленных элементов не вызывается.
+// Удобно для сброса кэша между итерациями тестов и бенчмарков.
+func (c *Cache) Reset() {
+	c.Lock()
+	defer c.unlock()
+
+	c.fireSignals(c.swapStore(make(mapStore)))
+	c.dependents = nil
+	c.aliases = nil
+	c.reindex()
+	c.epoch.Add(1)
+
+	if c.buckets != nil {
+		c.buckets.clear()
+	}
+
+	c.stats.reset()
+	c.peak = 0
+	if c.writes != nil {
+		c.writes.reset()
+	}
+	if c.ghosts != nil {
+		c.ghosts.reset()
+	}
+}
+
+// Атомарно забирает из кэша все элементы, включая устаревшие, и возвращает их.
+// После вызова кэш пуст. Обработчик удаления (WithOnEvicted) для забранных элементов
+// не вызывается - они не удаляются, а передаются вызывающему (например, чтобы сохранить
+// их или перенести в другой кэш).
+func (c *Cache) Drain() []KeyItemPair {
+	c.Lock()
+	defer c.unlock()
+
+	items := make([]KeyItemPair, 0, c.storage.Len())
+	for key, item := range c.storage.Range {
+		items = append(items, KeyItemPair{Key: key, Item: item})
+	}
+
+	c.fireSignals(c.swapStore(make(mapStore)))
+	c.dependents = nil
+	c.aliases = nil
+	c.reindex()
+	c.epoch.Add(1)
+
+	if c.buckets != nil {
+		c.buckets.clear()
+	}
+
+	return items
+}
+
+// Атомарно очищает кэш и возвращает элементы, которые в нем были, - например, чтобы сохранить их
+// в архив. В отличие от пары List и Flush, между которыми содержимое кэша может измениться,
+// все делается под одной блокировкой на запись. Возвращаются только неустаревшие элементы:
+// для них обработчик удаления (WithOnEvicted) не вызывается, потому что данные передаются
+// вызывающему. Устаревшие, но еще не удаленные элементы (с WithMaxAge и WithEvictAfterIdle -
+// и слишком старые или давно не читанные) удаляются так же, как при очистке: с причиной
+// EvictExpired и учетом в Stats().Expired.
+// Drain, наоборот, возвращает все элементы вместе с устаревшими.
+func (c *Cache) FlushAndReturn() []KeyItemPair {
+	c.Lock()
+	defer c.unlock()
+
+	now := c.now()
+	limits := c.limits()
+	expired := []KeyItemPair{}
+	for key, item := range c.storage.Range {
+		if item.outlived(now, limits) {
+			expired = append(expired, KeyItemPair{Key: key, Item: item})
+		}
+	}
+
+	c.stats.expired.Add(uint64(c.removeExpired(expired, limits)))
+
+	items := make([]KeyItemPair, 0, c.storage.Len())
+	for key, item := range c.storage.Range {
+		items = append(items, KeyItemPair{Key: key, Item: item})
+	}
+
+	c.fireSignals(c.swapStore(make(mapStore)))
+	c.dependents = nil
+	c.aliases = nil
+	c.reindex()
+	c.epoch.Add(1)
+
+	if c.buckets != nil {
+		c.buckets.clear()
+	}
+
+	return items
+}
+
+// Возвращает номер эпохи кэша - счетчик, который растет на единицу при каждом сбросе всего
+// содержимого: Flush, Reset, ReplaceAll, Drain, FlushAndReturn и FlushContext, дошедшем
+// до конца (отмененный FlushContext эпоху не меняет). Удаление отдельных элементов, FlushExcept,
+// очистка, вытеснение, Load и Close эпоху не меняют. Код, который хранит производные от кэша
+// данные, может запомнить эпоху и, сравнив ее с текущей, узнать о сбросе без сравнения
+// содержимого. Эпоха меняется под той же блокировкой, что и содержимое, поэтому после сброса
+// новое значение видно не позже нового содержимого. Вызов - одно атомарное чтение без блокировки.
+func (c *Cache) Epoch() uint64 {
+	return c.epoch.Load()
+}
+
+// Получение элемента из кэша по ключу.
+// С WithFallback при промахе элемент ищется в следующих уровнях кэша.
+func (c *Cache) Get(key string) (interface{}, error) {
+	if c.fallback != nil {
+		data, _, err := c.lookup(key)
+		return data, err
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.get(key)
+}
+
+// Получение элемента по ключу без блокировки.
+func (c *Cache) get(key string) (interface{}, error) {
+	item, found := c.storage.Get(c.resolve(key))
+	if found && (c.expiresEarly(item) || c.idleLapsed(item)) {
+		found = false
+	}
+	c.stats.lookup(found)
+
+	if !found {
+		c.ghostMiss(key)
+		return nil, ErrKeyNotFound
+	}
+
+	if item.negative {
+		return nil, ErrNegative
+	}
+
+	c.hit(item)
+
+	return c.copyData(item.data), nil
+}
+
+// Возвращает копию данных, если включено WithCopyOnGet или тип данных указан в WithCopyTypes,
+// иначе сами данные. Срез байт без копирования возвращается с емкостью, обрезанной до длины
+// (см. WithoutBytesClip).
+func (c *Cache) copyData(data interface{}) interface{} {
+	if c.copies(data) {
+		return deepCopy(data)
+	}
+
+	if b, ok := data.([]byte); ok && !c.rawBytes {
+		return b[:len(b):len(b)]
+	}
+
+	return data
+}
+
+// Получение элемента по ключу с признаком устаревания.
+// Неустаревший элемент возвращается с stale == false, устаревший, но еще не удаленный
+// очисткой - с stale == true (он при этом не удаляется). Если элемента нет, found == false.
+// Обращение к устаревшему элементу не продлевает его скользящее время жизни (WithIdleTTL).
+// Позволяет отдавать устаревшие данные, пока новые загружаются из источника; GetStaleOrLoad
+// делает то же и сам обновляет устаревший элемент в фоне.
+func (c *Cache) GetAllowStale(key string) (data interface{}, found bool, stale bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	item, found := c.storage.Get(key)
+	c.stats.lookup(found && !item.negative)
+	if !found || item.negative {
+		return nil, false, false
+	}
+
+	stale = item.expired(c.now())
+	if stale {
+		item.hit()
+	} else {
+		c.hit(item)
+	}
+
+	return c.copyData(item.data), true, stale
+}
+
+// Получение нескольких элементов за одну блокировку.
+// found - данные неустаревших элементов по ключам, missed - ключи отсутствующих и устаревших
+// элементов в порядке keys. Закэшированные отрицательные результаты (AddNegative) не попадают
+// ни туда, ни туда: источник уже ответил, что данных нет, и загружать их заново не нужно.
+func (c *Cache) GetManyWithMisses(keys []string) (found map[string]interface{}, missed []string) {
+	c.RLock()
+	defer c.RUnlock()
+
+	now := c.now()
+	found = make(map[string]interface{}, len(keys))
+	missed = []string{}
+
+	for _, key := range keys {
+		item, ok := c.storage.Get(key)
+		ok = ok && !item.expired(now)
+		c.stats.lookup(ok && !item.negative)
+
+		switch {
+		case !ok:
+			c.ghostMiss(key)
+			missed = append(missed, key)
+		case !item.negative:
+			c.hit(item)
+			found[key] = c.copyData(item.data)
+		}
+	}
+
+	return found, missed
+}
+
+// Возвращает элементы целиком (с моментом устаревания, временем добавления, попаданиями и т.д.)
+// для неустаревших ключей из keys за одну блокировку на чтение. Отсутствующие и устаревшие ключи
+// пропускаются. Данные не копируются, а обращения не учитываются в статистике.
+func (c *Cache) GetItems(keys []string) map[string]Item {
+	c.RLock()
+	defer c.RUnlock()
+
+	now := c.now()
+	items := make(map[string]Item, len(keys))
+	for _, key := range keys {
+		if item, found := c.storage.Get(key); found && !item.expired(now) {
+			items[key] = item
+		}
+	}
+
+	return items
+}
+
+// Получение неустаревшего элемента по ключу с продлением его времени жизни на bump.
+// Если задана опция WithExtendCap, элемент будет продлен не дальше чем на extendCap
+// от текущего момента, а элемент, который и так устареет позже, не продлевается, но и не
+// укорачивается. Элементы, которые никогда не устаревают, не меняются.
+// Вторым аргументом возвращается найден ли элемент.
+func (c *Cache) GetExtend(key string, bump time.Duration) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.now()
+	item, found := c.storage.Get(key)
+	found = found && !item.negative && !item.expired(now)
+	c.stats.lookup(found)
+	if !found {
+		return nil, false
+	}
+
+	c.hit(item)
+
+	if item.destroyTimestamp != 0 {
+		extended := item.destroyTimestamp + int64(bump)
+		if c.extendCap > 0 {
+			// Ограничение не должно укорачивать элемент, срок которого уже дальше его.
+			extended = max(item.destroyTimestamp, min(extended, now+int64(c.extendCap)))
+		}
+		item.destroyTimestamp = extended
+		c.put(key, item)
+	}
+
+	return c.copyData(item.data), true
+}
+
+// Получение неустаревшего элемента по ключу с установкой нового времени жизни ttl от текущего момента.
+// Если ttl <= 0, элемент больше никогда не устареет.
+// Вторым аргументом возвращается найден ли элемент.
+func (c *Cache) GetRefresh(key string, ttl time.Duration) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.now()
+	item, found := c.storage.Get(key)
+	found = found && !item.negative && !item.expired(now)
+	c.stats.lookup(found)
+	if !found {
+		return nil, false
+	}
+
+	c.hit(item)
+
+	item.destroyTimestamp = deadline(now, ttl)
+	c.put(key, item)
+
+	return c.copyData(item.data), true
+}
+
+// Получение неустаревшего элемента по ключу, только если его данные признает действительными valid.
+// Если valid вернет false, элемент удаляется (обработчик удаления вызывается как при Delete)
+// и возвращается промах. Проверка и удаление выполняются под одной блокировкой на запись,
+// поэтому между ними элемент не может быть заменен. valid получает сами данные, а не копию
+// (WithCopyOnGet), и не должна их менять и обращаться к кэшу.
+// Вторым аргументом возвращается найден ли действительный элемент.
+func (c *Cache) GetValid(key string, valid func(data interface{}) bool) (interface{}, bool) {
+	c.Lock()
+	defer c.unlock()
+
+	item, found := c.storage.Get(key)
+	found = found && !item.negative && !item.expired(c.now())
+	if found && !valid(item.data) {
+		c.remove(key, item, EvictDeleted)
+		found = false
+	}
+
+	c.stats.lookup(found)
+	if !found {
+		return nil, false
+	}
+
+	c.hit(item)
+
+	return c.copyData(item.data), true
+}
+
+// Определяет является ли элемент устаревшим.
+// Вторым аргументов возвращается есть элемент в кэше или нет.
+// Первым - устаревший элемент или нет.
+func (c *Cache) IsExpired(key string) (bool, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	item, found := c.storage.Get(key)
+
+	if !found {
+		return false, ErrKeyNotFound
+	}
+
+	return item.expired(c.now()), nil
+}
+
+// Делает элемент с ключом key устаревшим, но не удаляет его -
+// он будет удален при следующей очистке, как элемент с истекшим временем жизни.
+// Зависящие от него элементы (AddWithDeps) тоже становятся устаревшими.
+// Вернет был ли элемент в кэше.
+func (c *Cache) Expire(key string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	item, found := c.storage.Get(key)
+	if !found {
+		return false
+	}
+
+	now := c.now()
+	item.destroyTimestamp = now - 1
+	c.put(key, item)
+	c.expireDependents(key, now)
+
+	return true
+}
+
+// Удаление элемента по ключу.
+func (c *Cache) Delete(key string) error {
+	c.Lock()
+	defer c.unlock()
+
+	return c.delete(key)
+}
+
+// Удаление элемента по ключу без блокировки.
+func (c *Cache) delete(key string) error {
+	item, found := c.storage.Get(key)
+	if !found {
+		return ErrKeyNotFound
+	}
+
+	c.remove(key, item, EvictDeleted)
+
+	return nil
+}
+
+// Удаляет все элементы, ключи которых начинаются с prefix, - и устаревшие, и нет.
+// Вернет количество удаленных элементов.
+func (c *Cache) DeletePrefix(prefix string) int {
+	c.Lock()
+	defer c.unlock()
+
+	deleted := 0
+	for key, item := range c.storage.Range {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(key, item, EvictDeleted)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// Удаляет все элементы с меткой tag (см. WithItemTags) - и устаревшие, и нет.
+// Вернет количество удаленных элементов.
+func (c *Cache) DeleteTag(tag string) int {
+	c.Lock()
+	defer c.unlock()
+
+	return c.deleteTag(tag)
+}
+
+// Удаляет все элементы с меткой tag без блокировки.
+func (c *Cache) deleteTag(tag string) int {
+	deleted := 0
+	for key, item := range c.storage.Range {
+		if slices.Contains(item.tags, tag) {
+			c.remove(key, item, EvictDeleted)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// Добавление элемента в кэш.
+// key - ключ.
+// data - данные.
+// ttl - время жизни элемента (time to life) в наносекундах.
+// Если ttl <= 0, элемент никогда не устаревает.
+// Если задана WithCapacity и места для элемента не нашлось, элемент не будет добавлен.
+func (c *Cache) Set(key string, data interface{}, ttl time.Duration) {
+	c.Lock()
+	defer c.unlock()
+
+	c.set(key, data, ttl)
+}
+
+// Добавление элемента в кэш без блокировки.
+func (c *Cache) set(key string, data interface{}, ttl time.Duration) error {
+	return c.store(key, c.newItem(data, ttl))
 }
 
-// Кэш - это хранилище элементов и инервал его очистки (ну и мьютекс на всякий случай).
-// Интервал очистки хранилища укахывается в НАНОСЕКУНДАХ (используй множители для преобразования во что-то другое).
-type Cache struct {
-	sync.RWMutex                    // Мьютекс ждя реализации безопасного доступа к общим данным
-	storage         map[string]Item // Хранилище элементов
-	cleanupInterval time.Duration   // Интервал очистки хранилища в наносекундах
+// Создает новый элемент с данными data и временем жизни ttl.
+func (c *Cache) newItem(data interface{}, ttl time.Duration) Item {
+	now := c.now()
+
+	return Item{
+		destroyTimestamp: deadline(now, ttl),
+		createdAt:        now,
+		version:          c.nextVersion(),
+		data:             c.copyData(data),
+	}
 }
 
-// Создает новый экземпляр Cache с интервалом очистки cleanupInterval.
-// Если cleanupInterval < 0, то кэш не будет очищаться автоматически.
-func Cacher(cleanupInterval time.Duration) *Cache {
-	cache := &Cache{
-		storage:         make(map[string]Item),
-		cleanupInterval: cleanupInterval,
+// Записывает новый элемент в хранилище без блокировки,
+// если нужно - освобождая для него место (см. WithCapacity).
+// Если кэш закрыт, вернет ErrClosed, если данные больше WithMaxValueSize - ErrValueTooLarge.
+func (c *Cache) store(key string, item Item) error {
+	if c.closed {
+		return ErrClosed
 	}
 
-	if cleanupInterval > 0 {
-		go cache.gc(cleanupInterval)
+	if err := c.checkValueSize(item.data); err != nil {
+		return err
 	}
 
-	return cache
+	if err := c.admit(key); err != nil {
+		return err
+	}
+
+	c.put(key, item)
+
+	return nil
 }
 
-// gc = Garbage Collector.
-func (c *Cache) gc(cleanupInterval time.Duration) {
-	ticker := time.NewTicker(cleanupInterval)
-	defer ticker.Stop()
+// Возвращает новую версию для записываемого элемента.
+// Версии выдаются по возрастанию на весь кэш, поэтому удаленный и заново добавленный
+// элемент никогда не получит прежнюю версию.
+func (c *Cache) nextVersion() uint64 {
+	c.version++
+
+	return c.version
+}
+
+// Записывает data по ключу key, только если версия неустаревшего элемента равна expectedVersion.
+// Вернет новую версию элемента и true, если запись выполнена,
+// либо текущую версию (0, если элемента нет) и false, если нет.
+// Позволяет безопасно делать чтение-изменение-запись: прочитать элемент и его версию,
+// вычислить новое значение и записать его, только если элемент за это время не менялся.
+func (c *Cache) UpdateIfVersion(key string, expectedVersion uint64, data interface{}, ttl time.Duration) (uint64, bool) {
+	c.Lock()
+	defer c.unlock()
+
+	item, found := c.storage.Get(key)
+	if !found || item.expired(c.now()) {
+		return 0, false
+	}
 
-	for range ticker.C {
-		c.Cleanup()
+	if item.version != expectedVersion {
+		return item.version, false
 	}
+
+	if c.set(key, data, ttl) != nil {
+		return item.version, false
+	}
+
+	item, _ = c.storage.Get(key)
+
+	return item.version, true
 }
 
-// Перебирает все элементы в кэше, удаляет устаревшие.
-func (c *Cache) Cleanup() {
+// Атомарно добавляет value в конец списка, хранящегося по ключу key, и обновляет время жизни списка до ttl.
+// Если неустаревшего списка нет, он будет создан. Если max > 0, в списке останутся только max последних элементов.
+// Если по ключу хранится не []interface{}, вернет ErrNotSlice и оставит кэш без изменений.
+// Каждый раз сохраняется новый срез, поэтому полученные ранее через Get списки не меняются.
+func (c *Cache) Append(key string, value interface{}, ttl time.Duration, max int) error {
 	c.Lock()
-	defer c.Unlock()
+	defer c.unlock()
+
+	var list []interface{}
 
-	for key, item := range c.storage {
-		if item.destroyTimestamp <= time.Now().UnixNano() {
-			delete(c.storage, key)
+	item, found := c.storage.Get(key)
+	if found && !item.negative && !item.expired(c.now()) {
+		existing, ok := item.data.([]interface{})
+		if !ok {
+			return ErrNotSlice
 		}
+		list = existing[:len(existing):len(existing)]
 	}
+
+	list = append(list, value)
+	if max > 0 && len(list) > max {
+		list = list[len(list)-max:]
+	}
+
+	return c.set(key, list, ttl)
 }
 
-// Удаление всех элементов из кэша.
-func (c *Cache) Flush() {
+// Атомарно читает, изменяет и записывает элемент по ключу key - общий вид Append и подобных операций.
+// fn получает данные неустаревшего элемента (old, found == true) или nil и found == false, если
+// элемента нет, он устарел или это отрицательный результат. Если fn вернет store == true,
+// newVal записывается со временем жизни ttl (если ttl <= 0, элемент никогда не устаревает),
+// иначе кэш не меняется. Чтение, fn и запись выполняются под одной блокировкой на запись,
+// поэтому fn не должна обращаться к кэшу (это приведет к взаимной блокировке) и должна быть быстрой.
+// fn получает сами данные, а не копию, и не должна их менять: для изменения верните новое значение.
+// Вернет ErrCacheFull или ErrClosed, если записать значение не удалось.
+func (c *Cache) Mutate(key string, fn func(old interface{}, found bool) (newVal interface{}, store bool, ttl time.Duration)) error {
 	c.Lock()
-	defer c.Unlock()
+	defer c.unlock()
+
+	var old interface{}
+	item, found := c.storage.Get(key)
+	found = found && !item.negative && !item.expired(c.now())
+	if found {
+		old = item.data
+	}
 
-	for key := range c.storage {
-		delete(c.storage, key)
+	newVal, store, ttl := fn(old, found)
+	if !store {
+		return nil
 	}
+
+	return c.set(key, newVal, ttl)
 }
 
-// Получение элемента из кэша по ключу.
-func (c *Cache) Get(key string) (interface{}, error) {
+// Кэширует отрицательный результат по ключу key на время ttl - например,
+// когда источник данных ответил, что такого ключа нет.
+// Как и Set, заменяет то, что уже хранится по ключу.
+// Get для такого элемента вернет ErrNegative, а GetNegative - negative == true.
+func (c *Cache) AddNegative(key string, ttl time.Duration) {
+	c.Lock()
+	defer c.unlock()
+
+	item := c.newItem(nil, ttl)
+	item.negative = true
+	c.store(key, item)
+}
+
+// Проверяет закэширован ли по ключу key отрицательный результат.
+// found - есть ли по ключу неустаревший элемент (устаревшие считаются отсутствующими),
+// negative - является ли он отрицательным результатом, добавленным через AddNegative.
+func (c *Cache) GetNegative(key string) (found bool, negative bool) {
 	c.RLock()
 	defer c.RUnlock()
 
-	item, found := c.storage[key]
-
-	if !found {
-		return nil, errors.New("key not found")
+	item, found := c.storage.Get(key)
+	if !found || item.expired(c.now()) {
+		return false, false
 	}
 
-	return item.data, nil
+	return true, item.negative
 }
 
-// Определяет является ли элемент устаревшим.
-// Вторым аргументов возвращается есть элемент в кэше или нет.
-// Первым - устаревший элемент или нет.
-func (c *Cache) IsExpired(key string) (bool, error) {
-	c.RLock()
-	defer c.RUnlock()
+// Добавление элемента в кэш, только если по ключу key нет неустаревшего элемента.
+// Устаревший элемент заменяется новым.
+// Если элемент уже есть, вернет ErrKeyExists и оставит кэш без изменений,
+// если задана WithCapacity и места для элемента не нашлось - ErrCacheFull.
+func (c *Cache) Add(key string, data interface{}, ttl time.Duration) error {
+	c.Lock()
+	defer c.unlock()
 
-	item, found := c.storage[key]
+	return c.add(key, data, ttl)
+}
 
-	if !found {
-		return false, errors.New("key not found")
+// Добавление элемента в кэш, если его там нет, без блокировки.
+func (c *Cache) add(key string, data interface{}, ttl time.Duration) error {
+	if item, found := c.storage.Get(key); found && !item.expired(c.now()) {
+		return ErrKeyExists
 	}
 
-	if item.destroyTimestamp <= time.Now().UnixNano() {
-		return true, nil
-	} else {
-		return false, nil
+	if err := c.validate(data); err != nil {
+		return err
 	}
+
+	return c.set(key, data, ttl)
 }
 
-// Удаление элемента по ключу.
-func (c *Cache) Delete(key string) error {
+// Сколько элементов Fill добавляет в кэш за одну блокировку.
+const fillBatchSize = 256
+
+// Заполняет кэш элементами из канала ch, пока он не будет закрыт.
+// Элементы добавляются пачками: все, что уже лежит в канале (но не больше fillBatchSize),
+// добавляется под одной блокировкой. Возвращает управление после закрытия канала.
+func (c *Cache) Fill(ch <-chan KeyDataTTL) {
+	batch := make([]KeyDataTTL, 0, fillBatchSize)
+
+	for entry := range ch {
+		batch = append(batch, entry)
+
+	drain:
+		for len(batch) < fillBatchSize {
+			select {
+			case entry, ok := <-ch:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, entry)
+			default:
+				break drain
+			}
+		}
+
+		c.Lock()
+		c.unlockIfSealed()
+		for _, entry := range batch {
+			c.set(entry.Key, entry.Data, entry.TTL)
+		}
+		c.unlock()
+
+		batch = batch[:0]
+	}
+}
+
+// Под блокировкой на запись вызывает fn для каждого неустаревшего элемента и применяет ее решение:
+// если keep == false, элемент удаляется (с вызовом обработчика удаления), иначе его данные
+// заменяются на newData, а время жизни - на newTTL от текущего момента (если newTTL <= 0,
+// элемент больше никогда не устареет). Остальные свойства элемента сохраняются, версия меняется.
+// Закэшированные отрицательные результаты пропускаются. Если кэш закрыт, ничего не делает.
+// fn вызывается под блокировкой, поэтому не должна обращаться к кэшу - это приведет к взаимоблокировке.
+func (c *Cache) Update(fn func(key string, data interface{}) (newData interface{}, keep bool, newTTL time.Duration)) {
 	c.Lock()
-	defer c.Unlock()
+	defer c.unlock()
 
-	if _, found := c.storage[key]; !found {
-		return errors.New("key not found")
+	if c.closed {
+		return
 	}
 
-	delete(c.storage, key)
+	now := c.now()
+	for key, item := range c.storage.Range {
+		if item.negative || item.expired(now) {
+			continue
+		}
+
+		data, keep, ttl := fn(key, item.data)
+		if !keep {
+			c.remove(key, item, EvictDeleted)
+			continue
+		}
 
-	return nil
+		item.data = c.copyData(data)
+		item.destroyTimestamp = deadline(now, ttl)
+		item.version = c.nextVersion()
+		c.put(key, item)
+	}
 }
 
-// Добавление элемента в кэш.
-// key - ключ.
-// data - данные.
-// ttl - время жизни элемента (time to life) в наносекундах.
-func (c *Cache) Set(key string, data interface{}, ttl time.Duration) {
+// Продлевает время жизни элементов с ключами keys до ttl от текущего момента.
+// Отсутствующие и устаревшие элементы пропускаются.
+// Вернет количество продленных элементов.
+func (c *Cache) TouchMany(keys []string, ttl time.Duration) int {
 	c.Lock()
 	defer c.Unlock()
 
-	c.storage[key] = Item{
-		destroyTimestamp: time.Now().UnixNano() + int64(ttl),
-		data:             data,
+	now := c.now()
+	touched := 0
+	for _, key := range keys {
+		item, found := c.storage.Get(key)
+		if !found || item.expired(now) {
+			continue
+		}
+
+		item.destroyTimestamp = deadline(now, ttl)
+		c.put(key, item)
+		touched++
+	}
+
+	return touched
+}
+
+// Вычисляет момент устаревания элемента с временем жизни ttl, добавленного в момент now.
+func deadline(now int64, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return now + int64(ttl)
+}
+
+// Определяет есть ли в кэше неустаревший элемент с ключом key.
+// Проверка делает один поиск в хранилище и сравнение времени устаревания под блокировкой
+// на чтение: данные не копируются (WithCopyOnGet), а попадания и статистика
+// не обновляются, поэтому Has заметно дешевле Get.
+func (c *Cache) Has(key string) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	item, found := c.storage.Get(c.resolve(key))
+
+	return found && !item.expired(c.now())
+}
+
+// Возвращает список ключей всех элементов кэша.
+func (c *Cache) Keys() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	keys := make([]string, 0, c.storage.Len())
+
+	for key := range c.storage.Range {
+		keys = append(keys, key)
 	}
+
+	return keys
 }
 
 // Вернет количество элементов в кэше.
@@ -150,23 +1728,164 @@ func (c *Cache) Count() int {
 	c.RLock()
 	defer c.RUnlock()
 
-	return len(c.storage)
+	return c.storage.Len()
+}
+
+// Вернет приблизительное количество элементов в кэше (устаревшие тоже считаются, как в Count)
+// одним атомарным чтением, без блокировки - например, для панели мониторинга, которая часто
+// опрашивает нагруженный кэш и не должна бороться за блокировку с записью.
+// Значение запоминается в конце каждой операции записи, поэтому не учитывает только операции,
+// которые еще выполняются: расхождение с Count не больше, чем элементов добавляют и удаляют
+// идущие сейчас записи (одна запись, если писатель один; Flush или ReplaceAll - весь кэш).
+// Изменения своего хранилища (WithStore) в обход кэша не видны до следующей записи в кэш.
+// Где нужна точность, используйте Count.
+func (c *Cache) ApproxCount() int {
+	return int(c.approxCount.Load())
+}
+
+// Вернет количество неустаревших элементов в кэше.
+// С WithExpiryBuckets устаревшие элементы считаются по корзинам: целиком
+// устаревшие корзины учитываются по размеру, а перебираются только ключи одной, текущей корзины,
+// поэтому подсчет не зависит от размера кэша. Без корзин перебираются все элементы.
+func (c *Cache) CountLive() int {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.countLive()
+}
+
+// Считает неустаревшие элементы без блокировки (см. CountLive).
+func (c *Cache) countLive() int {
+	now := c.now()
+
+	if c.buckets != nil {
+		idle := 0
+		c.idleExpired(now, func(string, Item) { idle++ })
+
+		return c.storage.Len() - idle - c.buckets.expiredCount(now, func(key string) bool {
+			item, _ := c.storage.Get(key)
+			return item.expired(now)
+		})
+	}
+
+	count := 0
+	for _, item := range c.storage.Range {
+		if !item.expired(now) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Считает неустаревшие элементы кэша по группам: для каждого элемента вызывается group,
+// а возвращается количество элементов для каждой метки группы.
+// group вызывается под блокировкой кэша на чтение и не должна его изменять.
+// Если группа определяется только по ключу, data можно просто не использовать.
+func (c *Cache) CountBy(group func(key string, data interface{}) string) map[string]int {
+	c.RLock()
+	defer c.RUnlock()
+
+	counts := make(map[string]int)
+
+	now := c.now()
+	for key, item := range c.storage.Range {
+		if !item.expired(now) {
+			counts[group(key, item.data)]++
+		}
+	}
+
+	return counts
 }
 
-// Возвращает список всех элементов кэша.
+// Возвращает список всех элементов кэша, которые сейчас в нем хранятся,
+// включая устаревшие, но еще не удаленные очисткой.
 func (c *Cache) List() []KeyItemPair {
 	c.RLock()
 	defer c.RUnlock()
 
 	items := []KeyItemPair{}
 
-	for key, item := range c.storage {
+	for key, item := range c.storage.Range {
 		items = append(items, KeyItemPair{Key: key, Item: item})
 	}
 
 	return items
 }
 
+// Возвращает список всех неустаревших элементов кэша.
+func (c *Cache) ListLive() []KeyItemPair {
+	c.RLock()
+	defer c.RUnlock()
+
+	items := []KeyItemPair{}
+
+	now := c.now()
+	for key, item := range c.storage.Range {
+		if !item.expired(now) {
+			items = append(items, KeyItemPair{Key: key, Item: item})
+		}
+	}
+
+	return items
+}
+
+// Возвращает до n случайно выбранных неустаревших элементов кэша.
+// Выборка делается за один проход резервуарным методом, каждый элемент
+// попадает в нее с одинаковой вероятностью.
+func (c *Cache) Sample(n int) []KeyItemPair {
+	c.RLock()
+	defer c.RUnlock()
+
+	if n <= 0 {
+		return []KeyItemPair{}
+	}
+
+	sample := make([]KeyItemPair, 0, min(n, c.storage.Len()))
+
+	seen := 0
+	now := c.now()
+	for key, item := range c.storage.Range {
+		if item.expired(now) {
+			continue
+		}
+
+		seen++
+		if len(sample) < n {
+			sample = append(sample, KeyItemPair{Key: key, Item: item})
+		} else if j := rand.IntN(seen); j < n {
+			sample[j] = KeyItemPair{Key: key, Item: item}
+		}
+	}
+
+	return sample
+}
+
+// Возвращает последовательность ключей и данных всех неустаревших элементов кэша
+// для использования в range: for key, data := range cache.All() { ... }.
+// Последовательность строится по снимку кэша, сделанному в начале обхода,
+// поэтому блокировка во время обхода не удерживается и кэш можно изменять внутри цикла.
+// Изменения, сделанные во время обхода, в нем не видны.
+func (c *Cache) All() iter.Seq2[string, interface{}] {
+	return func(yield func(string, interface{}) bool) {
+		c.RLock()
+		now := c.now()
+		items := make([]KeyItemPair, 0, c.storage.Len())
+		for key, item := range c.storage.Range {
+			if !item.expired(now) {
+				items = append(items, KeyItemPair{Key: key, Item: item})
+			}
+		}
+		c.RUnlock()
+
+		for _, pair := range items {
+			if !yield(pair.Key, pair.Item.data) {
+				return
+			}
+		}
+	}
+}
+
 // Возвращает список всех устаревших элементов кэша.
 func (c *Cache) ExpiredList() []KeyItemPair {
 	c.RLock()
@@ -174,8 +1893,9 @@ func (c *Cache) ExpiredList() []KeyItemPair {
 
 	items := []KeyItemPair{}
 
-	for key, item := range c.storage {
-		if item.destroyTimestamp <= time.Now().UnixNano() {
+	now := c.now()
+	for key, item := range c.storage.Range {
+		if item.expired(now) {
 			items = append(items, KeyItemPair{Key: key, Item: item})
 		}
 	}
@@ -183,36 +1903,138 @@ func (c *Cache) ExpiredList() []KeyItemPair {
 	return items
 }
 
+// Возвращает самый давно добавленный неустаревший элемент кэша.
+// Вторым аргументом возвращается нашелся ли такой элемент.
+// Работает за O(n) - перебирает все элементы кэша.
+func (c *Cache) OldestEntry() (KeyItemPair, bool) {
+	return c.entryBy(func(candidate, best Item) bool {
+		return candidate.createdAt < best.createdAt
+	})
+}
+
+// Возвращает самый недавно добавленный неустаревший элемент кэша.
+// Вторым аргументом возвращается нашелся ли такой элемент.
+// Работает за O(n) - перебирает все элементы кэша.
+func (c *Cache) NewestEntry() (KeyItemPair, bool) {
+	return c.entryBy(func(candidate, best Item) bool {
+		return candidate.createdAt > best.createdAt
+	})
+}
+
+// Возвращает неустаревший элемент, лучший по функции better.
+func (c *Cache) entryBy(better func(candidate, best Item) bool) (KeyItemPair, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	var result KeyItemPair
+	found := false
+
+	now := c.now()
+	for key, item := range c.storage.Range {
+		if item.expired(now) {
+			continue
+		}
+
+		if !found || better(item, result.Item) {
+			result = KeyItemPair{Key: key, Item: item}
+			found = true
+		}
+	}
+
+	return result, found
+}
+
 // Вернет размер всего кэша в байтах.
 func (c *Cache) Size() int {
 	c.RLock()
 	defer c.RUnlock()
 
 	size := 0
-	for key, item := range c.storage {
-		size += isize(key) + isize(item.data) + isize(item.destroyTimestamp)
+	for key, item := range c.storage.Range {
+		size += itemSize(key, item)
 	}
 
 	return size
 }
 
-// Save сохраняет кэш в io.Writer в формате JSON, записывая каждый элемент по отдельности.
+// Вернет приблизительный объем памяти, который занимает кэш, в байтах: к данным и байтам
+// ключей добавляются служебные расходы - структура Item и заголовок строки ключа каждого
+// элемента, накладные расходы карты и сама структура Cache:
+//
+//	footprint = sizeof(Cache) + Σ(len(key) + size(data)) + ⌈n·8/7⌉·(sizeof(string) + sizeof(Item) + 1)
+//
+// где size(data) считается так же, как в Size, n - количество элементов, а ⌈n·8/7⌉·(…+1) -
+// слоты карты с учетом ее наибольшего заполнения 7/8 и байта управления на слот.
+// Это оценка: метки, зависимости, счетчики попаданий, индексы, корзины устаревания и память,
+// которую карта не отпустила после удаления элементов (см. WithAutoCompact), не учитываются,
+// а для своего хранилища (WithStore) расходы считаются так, как если бы оно было картой.
+func (c *Cache) MemoryFootprint() int {
+	c.RLock()
+	defer c.RUnlock()
+
+	data := 0
+	for key, item := range c.storage.Range {
+		data += len(key) + isize(item.data)
+	}
+
+	slots := (c.storage.Len()*8 + 6) / 7
+	slot := int(unsafe.Sizeof("")) + int(unsafe.Sizeof(Item{})) + 1
+
+	return int(unsafe.Sizeof(Cache{})) + data + slots*slot
+}
+
+// Вернет размер элемента вместе с ключом в байтах.
+func itemSize(key string, item Item) int {
+	return isize(key) + isize(item.data) + isize(item.destroyTimestamp) + isize(item.createdAt)
+}
+
+// Save сохраняет кэш в io.Writer в формате JSON, записывая каждый элемент по отдельности
+// (или в формате WithCodec, если он задан).
+// Время жизни элементов сохраняется как абсолютный момент устаревания.
 func (c *Cache) Save(w io.Writer) error {
+	return c.save(w, false, nil)
+}
+
+// SaveKeys сохраняет в io.Writer только элементы с ключами keys в том же формате, что и Save,
+// поэтому такой дамп читается обычным Load. Отсутствующие и устаревшие ключи пропускаются,
+// повторы ключей сохраняются один раз. Подходит для частичных резервных копий
+// и переноса отдельных пространств имен.
+func (c *Cache) SaveKeys(w io.Writer, keys []string) error {
+	return c.save(w, false, keys)
+}
+
+// SaveRelative сохраняет кэш так же, как Save, но вместо абсолютного момента устаревания
+// записывает оставшееся время жизни каждого элемента. При загрузке момент устаревания
+// пересчитывается от часов загружающей машины, поэтому расхождение часов между машинами
+// не влияет на TTL. Цена - время между сохранением и загрузкой не учитывается.
+func (c *Cache) SaveRelative(w io.Writer) error {
+	return c.save(w, true, nil)
+}
+
+// Сохраняет элементы с ключами keys (nil - все элементы кэша, включая устаревшие).
+func (c *Cache) save(w io.Writer, relative bool, keys []string) error {
 	c.RLock()
 	defer c.RUnlock()
 
+	now := c.now()
+
+	items := c.storage.Range
+	if keys != nil {
+		items = c.liveItems(keys, now)
+	}
+
+	if c.codec != nil {
+		return c.saveCodec(w, items, relative, now)
+	}
+
 	if _, err := w.Write([]byte("[\n")); err != nil {
 		return err
 	}
 
 	encoder := json.NewEncoder(w)
 	first := true
-	for key, item := range c.storage {
-		entry := Dump{
-			Key:              key,
-			DestroyTimestamp: item.destroyTimestamp,
-			Data:             item.data,
-		}
+	for key, item := range items {
+		entry := dumpEntry(key, item, relative, now)
 
 		if !first {
 			if _, err := w.Write([]byte(",\n")); err != nil {
@@ -233,10 +2055,60 @@ func (c *Cache) Save(w io.Writer) error {
 	return nil
 }
 
-// Load загружает кэш из io.Reader в формате JSON.
+// Возвращает запись дампа для элемента. С relative вместо момента устаревания записывается
+// оставшееся на момент now время жизни, а момент добавления не записывается.
+func dumpEntry(key string, item Item, relative bool, now int64) Dump {
+	entry := Dump{
+		Key:              key,
+		DestroyTimestamp: item.destroyTimestamp,
+		CreatedAt:        item.createdAt,
+		Negative:         item.negative,
+		Protected:        item.protected,
+		Tags:             item.tags,
+		Cost:             item.cost,
+		Data:             item.data,
+	}
+
+	if relative {
+		entry.CreatedAt = 0
+	}
+
+	if relative && item.destroyTimestamp != 0 {
+		ttl := item.destroyTimestamp - now
+		entry.DestroyTimestamp = 0
+		entry.TTL = &ttl
+	}
+
+	return entry
+}
+
+// Возвращает перебор неустаревших элементов с ключами keys (каждый ключ - один раз). Без блокировки.
+func (c *Cache) liveItems(keys []string, now int64) func(fn func(key string, item Item) bool) {
+	return func(fn func(key string, item Item) bool) {
+		seen := make(map[string]struct{}, len(keys))
+		for _, key := range keys {
+			if _, dup := seen[key]; dup {
+				continue
+			}
+			seen[key] = struct{}{}
+
+			if item, found := c.storage.Get(key); found && !item.expired(now) && !fn(key, item) {
+				return
+			}
+		}
+	}
+}
+
+// Load загружает кэш из io.Reader в формате JSON (или в формате WithCodec, если он задан).
+// Понимает дампы, созданные как через Save, так и через SaveRelative.
+// Если задана WithCapacity и места для очередного элемента не нашлось, вернет ErrCacheFull.
 func (c *Cache) Load(r io.Reader) error {
+	if c.codec != nil {
+		return c.loadCodec(r)
+	}
+
 	c.Lock()
-	defer c.Unlock()
+	defer c.unlock()
 
 	decoder := json.NewDecoder(r)
 
@@ -244,6 +2116,7 @@ func (c *Cache) Load(r io.Reader) error {
 		return err
 	}
 
+	now := c.now()
 	for decoder.More() {
 		entry := Dump{}
 
@@ -251,9 +2124,8 @@ func (c *Cache) Load(r io.Reader) error {
 			return err
 		}
 
-		c.storage[entry.Key] = Item{
-			destroyTimestamp: entry.DestroyTimestamp,
-			data:             entry.Data,
+		if err := c.loadEntry(entry, now); err != nil {
+			return err
 		}
 	}
 
@@ -264,32 +2136,68 @@ func (c *Cache) Load(r io.Reader) error {
 	return nil
 }
 
+// Добавляет в кэш элемент из записи дампа. now - момент загрузки. Без блокировки.
+func (c *Cache) loadEntry(entry Dump, now int64) error {
+	destroyTimestamp := entry.DestroyTimestamp
+	if entry.TTL != nil {
+		destroyTimestamp = now + *entry.TTL
+	}
+
+	createdAt := entry.CreatedAt
+	if createdAt == 0 {
+		createdAt = now
+	}
+
+	return c.store(entry.Key, Item{
+		destroyTimestamp: destroyTimestamp,
+		createdAt:        createdAt,
+		negative:         entry.Negative,
+		version:          c.nextVersion(),
+		protected:        entry.Protected,
+		tags:             entry.Tags,
+		cost:             entry.Cost,
+		data:             entry.Data,
+	})
+}
+
 func isize(i interface{}) int {
 	if i == nil {
 		return 0
 	}
-	val := reflect.ValueOf(i)
-	kind := val.Kind()
+	return vsize(reflect.ValueOf(i))
+}
+
+// Размер значения в байтах. Работает с reflect.Value, а не с interface{}, потому что
+// Interface() паникует на неэкспортируемых полях структур, а Len, Index и Field - нет.
+func vsize(val reflect.Value) int {
 	size := 0
-	switch kind {
-	case reflect.Slice, reflect.Array, reflect.String:
+	switch val.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.Interface:
+		return vsize(val.Elem())
+	case reflect.String:
+		// Строка - это заголовок и байты UTF-8, поэтому размер считается по байтам, а не по рунам.
+		return int(unsafe.Sizeof("")) + val.Len()
+	case reflect.Slice, reflect.Array:
 		len := val.Len()
 		for i := 0; i < len; i++ {
-			size += isize(val.Index(i).Interface())
+			size += vsize(val.Index(i))
 		}
 		return size
 	case reflect.Map:
-		for _, key := range val.MapKeys() {
-			size += isize(key.Interface()) + isize(val.MapIndex(key).Interface())
+		iter := val.MapRange()
+		for iter.Next() {
+			size += vsize(iter.Key()) + vsize(iter.Value())
 		}
 		return size
 	case reflect.Struct:
 		for i := 0; i < val.NumField(); i++ {
-			size += isize(val.Field(i).Interface())
+			size += vsize(val.Field(i))
 		}
 		return size
 	default:
-		return int(reflect.TypeOf(i).Size())
+		return int(val.Type().Size())
 	}
 }
 
@@ -299,15 +2207,75 @@ func (i *Item) Data() interface{} {
 }
 
 // Возвращает момент смерти элемента кэша.
+// Для элементов, которые никогда не устаревают, вернет 0.
 func (i *Item) DestroyTimestamp() int64 {
 	return i.destroyTimestamp
 }
 
-// Определяет является ли элемент устаревшим.
+// Возвращает момент смерти элемента кэша как time.Time.
+// Для элементов, которые никогда не устаревают, вернет нулевое время (IsZero() == true).
+func (i *Item) ExpiresAt() time.Time {
+	if i.destroyTimestamp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, i.destroyTimestamp)
+}
+
+// Возвращает метки элемента, заданные через WithItemTags.
+func (i *Item) Tags() []string {
+	return i.tags
+}
+
+// Возвращает стоимость элемента, заданную через WithItemCost.
+func (i *Item) Cost() int64 {
+	return i.cost
+}
+
+// Определяет является ли элемент защищенным от вытеснения (см. AddWithPriority).
+func (i *Item) IsProtected() bool {
+	return i.protected
+}
+
+// Определяет является ли элемент закэшированным отрицательным результатом.
+func (i *Item) IsNegative() bool {
+	return i.negative
+}
+
+// Возвращает версию элемента. Она меняется при каждой записи элемента
+// (Set, Add, Append и т.д.), но не при продлении его времени жизни.
+func (i *Item) Version() uint64 {
+	return i.version
+}
+
+// Возвращает момент добавления элемента в кэш в Unix-наносекундах.
+func (i *Item) CreatedAt() int64 {
+	return i.createdAt
+}
+
+// Определяет является ли элемент устаревшим по системным часам (а не по часам кэша, см. WithClock).
+// Для замороженного элемента (см. Cache.Freeze) сообщает, истек ли его срок, хотя кэш
+// продолжает считать такой элемент неустаревшим.
 func (i *Item) IsExpired() bool {
-	if i.destroyTimestamp <= time.Now().UnixNano() {
+	return i.lapsed(time.Now().UnixNano())
+}
+
+// Определяет является ли элемент устаревшим на момент now. Замороженный элемент не устаревает.
+func (i *Item) expired(now int64) bool {
+	return !i.frozen && i.lapsed(now)
+}
+
+// Определяет истек ли срок элемента на момент now (время жизни или WithIdleTTL) без учета заморозки.
+func (i *Item) lapsed(now int64) bool {
+	if i.idleTTL > 0 && now-i.lastAccess.Load() >= i.idleTTL {
 		return true
-	} else {
-		return false
 	}
+
+	return i.destroyTimestamp != 0 && i.destroyTimestamp <= now
+}
+
+// Определяет должна ли очистка удалить элемент на момент now: он устарел
+// или превысил ограничения limits. Замороженный элемент не удаляется.
+func (i *Item) outlived(now int64, limits ageLimits) bool {
+	return i.expired(now) || (!i.frozen && limits.exceeded(i, now))
 }
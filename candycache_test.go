@@ -0,0 +1,2451 @@
+package candycache_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+
+	"git.hikan.ru/serr/candycache"
+	"git.hikan.ru/serr/candycache/candycachetest"
+)
+
+// Момент, с которого идут управляемые часы тестов.
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Создает кэш без автоматической очистки с управляемыми часами.
+func newCache(t testing.TB, opts ...candycache.Option) (*candycache.Cache, *candycachetest.Clock) {
+	t.Helper()
+
+	clock := candycachetest.NewClock(epoch)
+	c := candycache.Cacher(0, append([]candycache.Option{clock.Option()}, opts...)...)
+	t.Cleanup(c.Close)
+
+	return c, clock
+}
+
+func TestReset(t *testing.T) {
+	evicted := 0
+	c, _ := newCache(t,
+		candycache.WithOnEvicted(func(string, interface{}) { evicted++ }),
+		candycache.WithWriteTracking(time.Minute, 8),
+		candycache.WithGhostKeys(8),
+	)
+
+	c.Set("a", 1, 0)
+	c.Set("a", 2, 0)
+	c.Get("a")
+	c.Get("missing")
+	c.Cleanup()
+
+	c.Reset()
+
+	if evicted != 0 {
+		t.Errorf("OnEvicted called %d times, want 0", evicted)
+	}
+	if got := c.Count(); got != 0 {
+		t.Errorf("Count() = %d, want 0", got)
+	}
+	if got := c.Stats(); got != (candycache.Stats{}) {
+		t.Errorf("Stats() = %+v, want zero", got)
+	}
+	if !c.LastCleanup().IsZero() {
+		t.Errorf("LastCleanup() = %v, want zero", c.LastCleanup())
+	}
+	if got := c.HotWriteKeys(10); len(got) != 0 {
+		t.Errorf("HotWriteKeys() = %v, want empty", got)
+	}
+}
+
+func TestErrorTTL(t *testing.T) {
+	errDown := errors.New("backend down")
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		calls   int
+		err     error
+	}{
+		{"cached", 4 * time.Second, 1, errDown},
+		{"expired", 5 * time.Second, 2, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, clock := newCache(t, candycache.WithErrorTTL(5*time.Second))
+
+			calls, fail := 0, true
+			load := func() (interface{}, error) {
+				calls++
+				if fail {
+					return nil, errDown
+				}
+				return "value", nil
+			}
+
+			if _, err := c.GetOrLoad("key", time.Minute, load); err != errDown {
+				t.Fatalf("first GetOrLoad error = %v, want %v", err, errDown)
+			}
+
+			fail = false
+			clock.Advance(tt.advance)
+			data, err := c.GetOrLoad("key", time.Minute, load)
+			if err != tt.err || calls != tt.calls {
+				t.Fatalf("GetOrLoad = %v, %v after %d calls, want error %v after %d", data, err, calls, tt.err, tt.calls)
+			}
+			if tt.err == nil && data != "value" {
+				t.Fatalf("GetOrLoad data = %v, want value", data)
+			}
+		})
+	}
+}
+
+func TestErrorTTLOverwrittenBySet(t *testing.T) {
+	c, _ := newCache(t, candycache.WithErrorTTL(time.Minute))
+
+	errDown := errors.New("backend down")
+	c.GetOrLoad("key", 0, func() (interface{}, error) { return nil, errDown })
+	c.Set("key", "value", 0)
+
+	data, err := c.GetOrLoad("key", 0, func() (interface{}, error) {
+		t.Fatal("loader called after Set")
+		return nil, nil
+	})
+	if err != nil || data != "value" {
+		t.Fatalf("GetOrLoad = %v, %v, want value", data, err)
+	}
+}
+
+func TestLoadingCacheErrorTTL(t *testing.T) {
+	errDown := errors.New("backend down")
+	calls, fail := 0, true
+	c := candycache.LoadingCacher(0, func(key string) (string, time.Duration, error) {
+		calls++
+		if fail {
+			return "", 0, errDown
+		}
+		return "value", 0, nil
+	})
+	c.SetErrorTTL(20 * time.Millisecond)
+
+	for range 3 {
+		if _, err := c.Get("key"); err != errDown {
+			t.Fatalf("Get error = %v, want %v", err, errDown)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("loader called %d times, want 1", calls)
+	}
+
+	fail = false
+	time.Sleep(30 * time.Millisecond)
+	if data, err := c.Get("key"); err != nil || data != "value" || calls != 2 {
+		t.Fatalf("Get = %q, %v after %d calls, want value after 2", data, err, calls)
+	}
+}
+
+func TestTryAddErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []candycache.Option
+		prep func(c *candycache.Cache)
+		data interface{}
+		want []error
+	}{
+		{"exists", nil, func(c *candycache.Cache) { c.Set("key", 1, 0) }, 1, []error{candycache.ErrKeyExists}},
+		{"non-serializable", []candycache.Option{candycache.WithValidateOnAdd()}, nil, make(chan int),
+			[]error{candycache.ErrInvalidData, candycache.ErrNonSerializable}},
+		{"closed", nil, func(c *candycache.Cache) { c.Close() }, 1, []error{candycache.ErrClosed}},
+		{"too large", []candycache.Option{candycache.WithMaxValueSize(64)}, nil, strings.Repeat("x", 100),
+			[]error{candycache.ErrValueTooLarge}},
+		{"full", []candycache.Option{candycache.WithCapacity(1)}, func(c *candycache.Cache) {
+			c.AddWithPriority("other", 1, 0, true)
+		}, 1, []error{candycache.ErrCacheFull}},
+		// Проверки идут по порядку: размер проверяется раньше заполненности.
+		{"too large and full", []candycache.Option{candycache.WithCapacity(1), candycache.WithMaxValueSize(64)}, func(c *candycache.Cache) {
+			c.AddWithPriority("other", 1, 0, true)
+		}, strings.Repeat("x", 100), []error{candycache.ErrValueTooLarge}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newCache(t, tt.opts...)
+			if tt.prep != nil {
+				tt.prep(c)
+			}
+
+			err := c.TryAdd("key", tt.data, 0)
+			for _, want := range tt.want {
+				if !errors.Is(err, want) {
+					t.Errorf("TryAdd error = %v, want it to match %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxValueSizeSet(t *testing.T) {
+	c, _ := newCache(t, candycache.WithMaxValueSize(64))
+
+	c.Set("key", "small", 0)
+	c.Set("key", strings.Repeat("x", 100), 0)
+
+	if data, err := c.Get("key"); err != nil || data != "small" {
+		t.Fatalf("Get = %v, %v, want the earlier small value", data, err)
+	}
+}
+
+func TestSizeUnexportedFields(t *testing.T) {
+	type inner struct {
+		name string
+		tags []string
+	}
+	type value struct {
+		ID    int
+		label string
+		inner inner
+		ptr   *inner
+		meta  map[string]int
+	}
+
+	tests := []struct {
+		name string
+		data interface{}
+	}{
+		{"unexported fields", value{ID: 1, label: "x", inner: inner{name: "n", tags: []string{"a"}}}},
+		{"pointer to struct", &value{ptr: &inner{name: "n"}, meta: map[string]int{"k": 1}}},
+		{"slice of structs", []value{{label: "a"}, {label: "b"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newCache(t)
+			c.Set("key", tt.data, 0)
+
+			if size := c.Size(); size <= 0 {
+				t.Fatalf("Size() = %d, want positive", size)
+			}
+		})
+	}
+}
+
+func TestClockIndependentOfWallTime(t *testing.T) {
+	// Часы кэша расходятся с системными, как после перевода системных часов:
+	// кэш должен отсчитывать время жизни только по прошедшему на своих часах времени.
+	tests := []struct {
+		name  string
+		start time.Time
+	}{
+		{"wall clock ahead", time.Now().Add(-365 * 24 * time.Hour)},
+		{"wall clock behind", time.Now().Add(365 * 24 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := candycachetest.NewClock(tt.start)
+			c := candycache.Cacher(0, clock.Option())
+			t.Cleanup(c.Close)
+
+			c.Set("key", "value", time.Minute)
+
+			clock.Advance(59 * time.Second)
+			if expired, err := c.IsExpired("key"); err != nil || expired {
+				t.Fatalf("after 59s IsExpired = %v, %v, want false", expired, err)
+			}
+			if got := c.CountLive(); got != 1 {
+				t.Fatalf("after 59s CountLive() = %d, want 1", got)
+			}
+
+			clock.Advance(2 * time.Second)
+			if expired, err := c.IsExpired("key"); err != nil || !expired {
+				t.Fatalf("after 61s IsExpired = %v, %v, want true", expired, err)
+			}
+		})
+	}
+}
+
+func TestCountLiveMatchesRecount(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []candycache.Option
+	}{
+		{"full scan", nil},
+		{"expiry buckets", []candycache.Option{candycache.WithExpiryBuckets(time.Second)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, clock := newCache(t, tt.opts...)
+			rng := rand.New(rand.NewPCG(1, 2))
+
+			for step := range 5000 {
+				key := strconv.Itoa(rng.IntN(200))
+				switch op := rng.IntN(10); {
+				case op < 5:
+					c.Set(key, step, time.Duration(rng.IntN(10))*time.Second) // 0 - никогда не устареет
+				case op < 7:
+					c.Delete(key)
+				case op < 9:
+					clock.Advance(time.Duration(rng.IntN(1500)) * time.Millisecond)
+				default:
+					c.Cleanup()
+				}
+
+				now, want := clock.Now().UnixNano(), 0
+				for _, pair := range c.List() {
+					if ts := pair.Item.DestroyTimestamp(); ts == 0 || ts > now {
+						want++
+					}
+				}
+
+				if got := c.CountLive(); got != want {
+					t.Fatalf("step %d: CountLive() = %d, recount = %d", step, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAutoCompactThreshold(t *testing.T) {
+	tests := []struct {
+		name   string
+		factor float64
+		remain int // Сколько из 100 элементов переживут очистку
+		want   uint64
+	}{
+		{"below factor", 0.25, 10, 1},
+		{"at factor", 0.25, 25, 0},
+		{"above factor", 0.25, 50, 0},
+		{"disabled", 0, 10, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newCache(t, candycache.WithAutoCompact(tt.factor))
+
+			for i := range 100 {
+				ttl := time.Second
+				if i < tt.remain {
+					ttl = 0
+				}
+				c.Set(strconv.Itoa(i), i, ttl)
+			}
+
+			candycachetest.AdvanceClock(c, 2*time.Second)
+
+			if got := c.Compactions(); got != tt.want {
+				t.Fatalf("Compactions() = %d, want %d", got, tt.want)
+			}
+			if got := c.Count(); got != tt.remain {
+				t.Fatalf("Count() = %d, want %d", got, tt.remain)
+			}
+
+			// После уплотнения пиком считается то, что осталось, и повторная очистка не уплотняет.
+			c.Cleanup()
+			if got := c.Compactions(); got != tt.want {
+				t.Fatalf("Compactions() after second cleanup = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvictionComparator(t *testing.T) {
+	byCostThenAge := func(a, b candycache.EvictionCandidate) bool {
+		if a.Item.Cost() != b.Item.Cost() {
+			return a.Item.Cost() < b.Item.Cost()
+		}
+		return a.Age > b.Age
+	}
+	bySize := func(a, b candycache.EvictionCandidate) bool {
+		return a.Size > b.Size
+	}
+
+	type entry struct {
+		key  string
+		data interface{}
+		cost int64
+		hits int
+	}
+	entries := []entry{
+		{"cheap-old", "x", 1, 5},
+		{"cheap-new", "x", 1, 0},
+		{"dear", strings.Repeat("x", 100), 9, 1},
+	}
+
+	tests := []struct {
+		name    string
+		less    func(a, b candycache.EvictionCandidate) bool
+		evicted string
+	}{
+		{"custom priority then age", byCostThenAge, "cheap-old"},
+		{"custom largest first", bySize, "dear"},
+		{"hits", candycache.EvictByHits, "cheap-new"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, clock := newCache(t, candycache.WithCapacity(len(entries)), candycache.WithEvictionComparator(tt.less))
+
+			for _, e := range entries {
+				if err := c.AddOpts(e.key, e.data, candycache.WithItemCost(e.cost)); err != nil {
+					t.Fatal(err)
+				}
+				for range e.hits {
+					c.Get(e.key)
+				}
+				clock.Advance(time.Second)
+			}
+
+			if err := c.Add("new", "x", 0); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+
+			for _, e := range entries {
+				if got, want := c.Has(e.key), e.key != tt.evicted; got != want {
+					t.Errorf("Has(%q) = %v, want %v", e.key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReshardRelocationFraction(t *testing.T) {
+	const keys = 10000
+
+	tests := []struct {
+		name     string
+		from, to int
+	}{
+		{"grow", 8, 10},
+		{"shrink", 8, 6},
+		{"double", 4, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := candycache.Sharded(tt.from, 0)
+			t.Cleanup(s.Close)
+
+			for i := range keys {
+				s.Set(strconv.Itoa(i), i, 0)
+			}
+
+			moved := s.Reshard(tt.to)
+
+			// Консистентное хеширование переносит только ключи новых или удаленных шардов.
+			want := float64(abs(tt.to-tt.from)) / float64(max(tt.from, tt.to))
+			if got := float64(moved) / keys; got < want/2 || got > want*1.5 {
+				t.Errorf("relocated fraction = %.3f, want about %.3f", got, want)
+			}
+
+			if got := len(s.ShardCounts()); got != tt.to {
+				t.Errorf("len(ShardCounts()) = %d, want %d", got, tt.to)
+			}
+			if got := s.Count(); got != keys {
+				t.Errorf("Count() = %d, want %d", got, keys)
+			}
+			for i := range keys {
+				if data, err := s.Get(strconv.Itoa(i)); err != nil || data != i {
+					t.Fatalf("Get(%d) = %v, %v after Reshard", i, data, err)
+				}
+			}
+		})
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func TestSaveKeysRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []candycache.Option
+	}{
+		{"json", nil},
+		{"gob codec", []candycache.Option{candycache.WithCodec(candycache.GobCodec)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, clock := newCache(t, tt.opts...)
+			src.Set("a", "alpha", time.Minute)
+			src.Set("b", "beta", 0)
+			src.Set("c", "gamma", 0)
+			src.Set("expired", "old", time.Second)
+			clock.Advance(2 * time.Second)
+
+			buf := bytes.Buffer{}
+			if err := src.SaveKeys(&buf, []string{"a", "c", "expired", "missing", "a"}); err != nil {
+				t.Fatalf("SaveKeys: %v", err)
+			}
+
+			dst := candycache.Cacher(0, append([]candycache.Option{clock.Option()}, tt.opts...)...)
+			t.Cleanup(dst.Close)
+			if err := dst.Load(&buf); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			want := map[string]string{"a": "alpha", "c": "gamma"}
+			if got := dst.Count(); got != len(want) {
+				t.Fatalf("Count() = %d, want %d", got, len(want))
+			}
+			for key, data := range want {
+				if got, err := dst.Get(key); err != nil || got != data {
+					t.Errorf("Get(%q) = %v, %v, want %q", key, got, err, data)
+				}
+			}
+
+			// Оставшееся время жизни сохраняется вместе с элементом.
+			clock.Advance(time.Minute)
+			if expired, err := dst.IsExpired("a"); err != nil || !expired {
+				t.Errorf("IsExpired(a) after its TTL = %v, %v, want true", expired, err)
+			}
+			if expired, err := dst.IsExpired("c"); err != nil || expired {
+				t.Errorf("IsExpired(c) = %v, %v, want false", expired, err)
+			}
+		})
+	}
+}
+
+func TestCleanupOrderStable(t *testing.T) {
+	// Ключи добавляются не по порядку; "early" устаревают раньше остальных.
+	inserted := []string{"m", "b", "early-2", "z", "a", "early-1", "k"}
+
+	tests := []struct {
+		name  string
+		order candycache.CleanupOrder
+		want  []string
+	}{
+		{"by key", candycache.CleanupByKey, []string{"early-1", "early-2", "a", "b", "k", "m", "z"}},
+		{"by insertion", candycache.CleanupByInsertion, []string{"early-2", "early-1", "m", "b", "z", "a", "k"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for run := range 20 {
+				evicted := []string{}
+				c, _ := newCache(t,
+					candycache.WithCleanupOrder(tt.order),
+					candycache.WithOnEvicted(func(key string, _ interface{}) { evicted = append(evicted, key) }),
+				)
+
+				for _, key := range inserted {
+					ttl := 2 * time.Second
+					if strings.HasPrefix(key, "early") {
+						ttl = time.Second
+					}
+					c.Set(key, key, ttl)
+				}
+
+				candycachetest.AdvanceClock(c, 3*time.Second)
+
+				if !slices.Equal(evicted, tt.want) {
+					t.Fatalf("run %d: eviction order = %v, want %v", run, evicted, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxCleanupDurationBoundsPause(t *testing.T) {
+	const (
+		items  = 100000
+		budget = 2 * time.Millisecond
+		// Допуск на проверку последней группы элементов и планировщик под -race.
+		slack = 25 * time.Millisecond
+	)
+
+	durations := []time.Duration{}
+	c, clock := newCache(t,
+		candycache.WithMaxCleanupDuration(budget),
+		candycache.WithLogger(func(event string, fields map[string]interface{}) {
+			if event == "cleanup" {
+				durations = append(durations, fields["duration"].(time.Duration))
+			}
+		}),
+	)
+
+	for i := range items {
+		c.Set(strconv.Itoa(i), i, time.Second)
+	}
+	clock.Advance(2 * time.Second)
+
+	for pass := 0; c.Count() > 0; pass++ {
+		if pass > items {
+			t.Fatal("cleanup does not make progress")
+		}
+		c.Cleanup()
+	}
+
+	if len(durations) < 2 {
+		t.Fatalf("cleanup finished in %d pass(es), want the budget to split it", len(durations))
+	}
+	for i, d := range durations {
+		if d > budget+slack {
+			t.Errorf("pass %d held the cache for %v, budget %v", i, d, budget)
+		}
+	}
+}
+
+func TestIdleTTLWithMaxLifetime(t *testing.T) {
+	const (
+		idle     = 10 * time.Second
+		lifetime = 30 * time.Second
+	)
+
+	// Способы чтения, которые должны отсчитывать скользящее время жизни и не находить
+	// устаревший элемент. Вернут найден ли элемент.
+	reads := map[string]func(c *candycache.Cache) bool{
+		"Get": func(c *candycache.Cache) bool {
+			_, err := c.Get("session")
+			return err == nil
+		},
+		"TryGet": func(c *candycache.Cache) bool {
+			_, err := c.TryGet("session")
+			return err == nil
+		},
+		"GetManyWithMisses": func(c *candycache.Cache) bool {
+			found, _ := c.GetManyWithMisses([]string{"session"})
+			return len(found) == 1
+		},
+		"GetOrLoad": func(c *candycache.Cache) bool {
+			data, _ := c.GetOrLoad("session", 0, func() (interface{}, error) { return "reloaded", nil })
+			return data == "data"
+		},
+	}
+
+	tests := []struct {
+		name  string
+		reads []time.Duration // Через сколько после предыдущего шага читать элемент
+		last  time.Duration   // Через сколько после последнего чтения проверить элемент
+		alive bool
+	}{
+		{"idle window lapses", nil, idle, false},
+		{"read just before idle window", nil, idle - time.Second, true},
+		{"reads slide idle window", []time.Duration{8 * time.Second, 8 * time.Second}, 8 * time.Second, true},
+		{"max lifetime caps reads", []time.Duration{8 * time.Second, 8 * time.Second, 8 * time.Second}, 6 * time.Second, false},
+	}
+
+	for readName, read := range reads {
+		for _, buckets := range []bool{false, true} {
+			for _, tt := range tests {
+				t.Run(fmt.Sprintf("%s/buckets=%v/%s", readName, buckets, tt.name), func(t *testing.T) {
+					opts := []candycache.Option{}
+					if buckets {
+						opts = append(opts, candycache.WithExpiryBuckets(time.Second))
+					}
+					c, clock := newCache(t, opts...)
+
+					err := c.AddOpts("session", "data", candycache.WithIdleTTL(idle), candycache.WithMaxLifetime(lifetime))
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					for i, d := range tt.reads {
+						clock.Advance(d)
+						if !read(c) {
+							t.Fatalf("read %d did not find the live entry", i)
+						}
+					}
+
+					clock.Advance(tt.last)
+					if got := read(c); got != tt.alive {
+						t.Fatalf("found = %v, want %v", got, tt.alive)
+					}
+
+					// Промах не должен оживлять элемент: очистка удаляет устаревший элемент.
+					if !tt.alive && readName != "GetOrLoad" {
+						c.Cleanup()
+						if c.Count() != 0 {
+							t.Fatalf("Count() after Cleanup = %d, want 0", c.Count())
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestGetAllowStaleIdleTTL(t *testing.T) {
+	c, clock := newCache(t)
+	c.AddOpts("session", "data", candycache.WithIdleTTL(10*time.Second))
+
+	clock.Advance(10 * time.Second)
+	data, found, stale := c.GetAllowStale("session")
+	if !found || !stale || data != "data" {
+		t.Fatalf("GetAllowStale = %v, %v, %v, want data, true, true", data, found, stale)
+	}
+
+	// Чтение устаревшего элемента не отсчитывает скользящее время жизни заново.
+	if _, _, stale := c.GetAllowStale("session"); !stale {
+		t.Fatal("GetAllowStale revived the idle entry")
+	}
+	c.Cleanup()
+	if c.Has("session") {
+		t.Fatal("Cleanup kept the idle entry")
+	}
+}
+
+func TestMaxTTLClamp(t *testing.T) {
+	const maxTTL = time.Hour
+
+	tests := []struct {
+		name  string
+		write func(c *candycache.Cache) error
+		want  time.Duration // Через сколько после записи элемент устареет (0 - никогда)
+		opts  []candycache.Option
+	}{
+		{"shorter ttl kept", func(c *candycache.Cache) error { return c.Add("key", 1, time.Minute) }, time.Minute, nil},
+		{"longer ttl clamped", func(c *candycache.Cache) error { return c.Add("key", 1, 24*time.Hour) }, maxTTL, nil},
+		{"never expire clamped", func(c *candycache.Cache) error { return c.Add("key", 1, 0) }, maxTTL, nil},
+		{"negative ttl clamped", func(c *candycache.Cache) error {
+			c.Set("key", 1, -time.Second)
+			return nil
+		}, maxTTL, nil},
+		{"AddOpts clamped", func(c *candycache.Cache) error {
+			return c.AddOpts("key", 1, candycache.WithItemTTL(48*time.Hour))
+		}, maxTTL, nil},
+		{"deadline clamped", func(c *candycache.Cache) error {
+			return c.AddOpts("key", 1, candycache.WithItemDeadline(epoch.Add(72*time.Hour)))
+		}, maxTTL, nil},
+		{"prefix policy cannot extend", func(c *candycache.Cache) error { return c.Add("key", 1, 0) }, maxTTL,
+			[]candycache.Option{candycache.WithPrefixPolicy("k", candycache.PrefixPolicy{MaxTTL: 2 * maxTTL})}},
+		{"stricter prefix policy wins", func(c *candycache.Cache) error { return c.Add("key", 1, 0) }, time.Minute,
+			[]candycache.Option{candycache.WithPrefixPolicy("k", candycache.PrefixPolicy{MaxTTL: time.Minute})}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, clock := newCache(t, append([]candycache.Option{candycache.WithMaxTTL(maxTTL)}, tt.opts...)...)
+
+			if err := tt.write(c); err != nil {
+				t.Fatal(err)
+			}
+
+			item := c.GetItems([]string{"key"})["key"]
+			if got, want := item.ExpiresAt(), epoch.Add(tt.want); !got.Equal(want) {
+				t.Fatalf("ExpiresAt() = %v, want %v", got, want)
+			}
+
+			clock.Advance(tt.want)
+			if expired, _ := c.IsExpired("key"); !expired {
+				t.Fatal("entry outlived the clamped TTL")
+			}
+		})
+	}
+}
+
+func TestMaxTTLDisabled(t *testing.T) {
+	c, _ := newCache(t, candycache.WithMaxTTL(0))
+	c.Set("key", 1, 0)
+
+	item := c.GetItems([]string{"key"})["key"]
+	if ts := item.DestroyTimestamp(); ts != 0 {
+		t.Fatalf("DestroyTimestamp() = %d, want 0 without a limit", ts)
+	}
+}
+
+func TestMaxWaitersOverflow(t *testing.T) {
+	const n = 3
+
+	c, _ := newCache(t, candycache.WithMaxWaiters(n))
+
+	release, started := make(chan struct{}), make(chan struct{})
+	load := func() (interface{}, error) {
+		close(started)
+		<-release
+		return "value", nil
+	}
+
+	results := make(chan error, n+1)
+	go func() {
+		_, err := c.GetOrLoad("key", 0, load)
+		results <- err
+	}()
+	<-started
+
+	// n вызовов ждут чужой загрузки; больше ждать нельзя.
+	for range n {
+		go func() {
+			_, err := c.GetOrLoad("key", 0, load)
+			results <- err
+		}()
+	}
+	for c.Stats().Waiters != n {
+		time.Sleep(time.Millisecond)
+	}
+
+	overflow := []struct {
+		name string
+		call func() error
+	}{
+		{"GetOrLoad", func() error {
+			_, err := c.GetOrLoad("key", 0, load)
+			return err
+		}},
+		{"GetOrLoadMany", func() error {
+			_, err := c.GetOrLoadMany([]string{"key"}, 0, func([]string) (map[string]interface{}, error) {
+				t.Error("GetOrLoadMany loaded a key that is being loaded")
+				return nil, nil
+			})
+			return err
+		}},
+		{"WaitEmpty", func() error {
+			c.Set("other", 1, 0)
+			return c.WaitEmpty(context.Background())
+		}},
+		{"GetOrWait", func() error {
+			if _, leader, _ := c.GetOrWait("absent", time.Hour); !leader {
+				return errors.New("first GetOrWait is not the leader")
+			}
+			// Второй вызов ждал бы лидера час, но ждать нельзя, и он сразу возвращает промах.
+			if _, leader, found := c.GetOrWait("absent", time.Hour); leader || found {
+				return errors.New("second GetOrWait did not miss")
+			}
+			return candycache.ErrTooManyWaiters
+		}},
+	}
+	for _, tt := range overflow {
+		if err := tt.call(); !errors.Is(err, candycache.ErrTooManyWaiters) {
+			t.Errorf("%s over the limit: error = %v, want ErrTooManyWaiters", tt.name, err)
+		}
+	}
+	if got := c.Stats().Waiters; got != n {
+		t.Errorf("Stats().Waiters with rejected calls = %d, want %d", got, n)
+	}
+
+	close(release)
+	for range n + 1 {
+		if err := <-results; err != nil {
+			t.Errorf("waiter error = %v, want nil", err)
+		}
+	}
+	if got := c.Stats().Waiters; got != 0 {
+		t.Errorf("Stats().Waiters after release = %d, want 0", got)
+	}
+}
+
+// Определяет закрыт ли канал ch.
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestAddWithSignal(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove func(c *candycache.Cache)
+	}{
+		{"expired and cleaned up", func(c *candycache.Cache) { candycachetest.AdvanceClock(c, 2*time.Second) }},
+		{"Delete", func(c *candycache.Cache) { c.Delete("key") }},
+		{"Flush", func(c *candycache.Cache) { c.Flush() }},
+		{"Reset", func(c *candycache.Cache) { c.Reset() }},
+		{"Drain", func(c *candycache.Cache) { c.Drain() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, clock := newCache(t)
+
+			done, err := c.AddWithSignal("key", "data", time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clock.Advance(500 * time.Millisecond)
+			c.Cleanup()
+			if closed(done) {
+				t.Fatal("channel closed while the entry is live")
+			}
+
+			tt.remove(c)
+			if !closed(done) {
+				t.Fatal("channel still open after the entry left the cache")
+			}
+
+			// Ключ свободен, а повторное удаление не закрывает канал второй раз.
+			c.Set("key", "again", 0)
+			c.Delete("key")
+		})
+	}
+}
+
+func TestAddWithSignalFollowsKey(t *testing.T) {
+	c, _ := newCache(t)
+
+	done, _ := c.AddWithSignal("key", "data", time.Second)
+	if again, err := c.AddWithSignal("key", "other", time.Second); err != candycache.ErrKeyExists || again != nil {
+		t.Fatalf("second AddWithSignal = %v, %v, want nil, ErrKeyExists", again, err)
+	}
+
+	// Замена продлевает сигнал до устаревания нового элемента.
+	c.Set("key", "replaced", 5*time.Second)
+	candycachetest.AdvanceClock(c, 2*time.Second)
+	if closed(done) {
+		t.Fatal("channel closed by the original TTL after the entry was replaced")
+	}
+
+	candycachetest.AdvanceClock(c, 4*time.Second)
+	if !closed(done) {
+		t.Fatal("channel still open after the replacement expired")
+	}
+}
+
+func TestFrozenExpiredFlow(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []candycache.Option
+		add  func(c *candycache.Cache) error
+		// Has учитывает время жизни и WithIdleTTL, но не WithMaxAge: по нему элемент удаляет только очистка.
+		expiresForHas bool
+	}{
+		{"ttl", nil, func(c *candycache.Cache) error { return c.Add("key", "data", time.Second) }, true},
+		{"idle ttl", nil, func(c *candycache.Cache) error {
+			return c.AddOpts("key", "data", candycache.WithIdleTTL(time.Second))
+		}, true},
+		{"max age", []candycache.Option{candycache.WithMaxAge(time.Second)}, func(c *candycache.Cache) error {
+			return c.Add("key", "data", 0)
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newCache(t, tt.opts...)
+			if err := tt.add(c); err != nil {
+				t.Fatal(err)
+			}
+
+			if !c.Freeze("key") {
+				t.Fatal("Freeze() = false for a live entry")
+			}
+			if _, found, pinned := c.GetFrozen("key"); !found || pinned {
+				t.Fatalf("GetFrozen before expiry = %v, %v, want true, false", found, pinned)
+			}
+
+			// Срок истек, но заморозка держит элемент: он читается и не удаляется очисткой.
+			candycachetest.AdvanceClock(c, 2*time.Second)
+			if data, err := c.Get("key"); err != nil || data != "data" {
+				t.Fatalf("Get of a frozen expired entry = %v, %v", data, err)
+			}
+			if !c.Has("key") {
+				t.Fatal("Has() = false for a frozen expired entry")
+			}
+			if data, found, pinned := c.GetFrozen("key"); !found || !pinned || data != "data" {
+				t.Fatalf("GetFrozen after expiry = %v, %v, %v, want data, true, true", data, found, pinned)
+			}
+
+			// После разморозки элемент устарел и удаляется ближайшей очисткой.
+			if !c.Unfreeze("key") {
+				t.Fatal("Unfreeze() = false")
+			}
+			if tt.expiresForHas && c.Has("key") {
+				t.Fatal("Has() = true for an unfrozen expired entry")
+			}
+			if _, found, pinned := c.GetFrozen("key"); pinned {
+				t.Fatalf("GetFrozen after Unfreeze = %v, pinned, want not pinned", found)
+			}
+			c.Cleanup()
+			if c.Count() != 0 {
+				t.Fatalf("Count() after Cleanup = %d, want 0", c.Count())
+			}
+			if _, err := c.Get("key"); err != candycache.ErrKeyNotFound {
+				t.Fatalf("Get after Cleanup error = %v, want ErrKeyNotFound", err)
+			}
+		})
+	}
+}
+
+func TestEvictAfterIdle(t *testing.T) {
+	c, clock := newCache(t, candycache.WithEvictAfterIdle(10*time.Second))
+	for _, key := range []string{"read", "idle", "rewritten", "frozen"} {
+		c.Set(key, key, 0)
+	}
+	if !c.Freeze("frozen") {
+		t.Fatal("Freeze() = false")
+	}
+
+	clock.Advance(6 * time.Second)
+	if _, err := c.Get("read"); err != nil {
+		t.Fatal(err)
+	}
+	c.Set("rewritten", "rewritten", 0)
+
+	clock.Advance(6 * time.Second)
+	// Ограничение применяется только при очистке: до нее элемент, к которому не обращались, доступен.
+	if !c.Has("idle") {
+		t.Fatal("Has(idle) = false before Cleanup")
+	}
+
+	c.Cleanup()
+	for key, want := range map[string]bool{"read": true, "idle": false, "rewritten": true, "frozen": true} {
+		if got := c.Has(key); got != want {
+			t.Errorf("Has(%s) after Cleanup = %v, want %v", key, got, want)
+		}
+	}
+
+	// Прочитанный элемент отсчитывает время без обращений от чтения.
+	candycachetest.AdvanceClock(c, 5*time.Second)
+	if c.Has("read") {
+		t.Error("Has(read) = true after 11s without access")
+	}
+	if !c.Has("frozen") {
+		t.Error("frozen entry removed by WithEvictAfterIdle")
+	}
+}
+
+func TestEvictAfterIdleWithIdleTTL(t *testing.T) {
+	c, clock := newCache(t, candycache.WithEvictAfterIdle(10*time.Second))
+	if err := c.AddOpts("short", "short", candycache.WithIdleTTL(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddOpts("long", "long", candycache.WithIdleTTL(20*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// WithIdleTTL короче ограничения: элемент скрыт от чтения сразу, не дожидаясь очистки.
+	clock.Advance(3 * time.Second)
+	if _, err := c.Get("short"); err != candycache.ErrKeyNotFound {
+		t.Fatalf("Get(short) after its idle TTL error = %v, want ErrKeyNotFound", err)
+	}
+	if _, err := c.Get("long"); err != nil {
+		t.Fatalf("Get(long) error = %v", err)
+	}
+
+	// Ограничение короче WithIdleTTL: элемент доступен, пока его не удалит очистка.
+	clock.Advance(11 * time.Second)
+	if !c.Has("long") {
+		t.Fatal("Has(long) = false before Cleanup")
+	}
+	c.Cleanup()
+	if c.Count() != 0 {
+		t.Fatalf("Count() after Cleanup = %d, want 0 (keys %v)", c.Count(), c.Keys())
+	}
+}
+
+func TestGetKeyExpired(t *testing.T) {
+	type userKey struct {
+		Tenant string
+		ID     int
+	}
+
+	c, clock := newCache(t)
+	if err := c.AddKey(userKey{"acme", 42}, "user", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if data, found := c.GetKey(userKey{"acme", 42}); !found || data != "user" {
+		t.Fatalf("GetKey() = %v, %v, want user, true", data, found)
+	}
+
+	clock.Advance(2 * time.Second)
+	if data, found := c.GetKey(userKey{"acme", 42}); found {
+		t.Fatalf("GetKey() of an expired entry = %v, true, want not found", data)
+	}
+	if c.Count() != 1 {
+		t.Fatalf("Count() = %d, want the expired entry kept until Cleanup", c.Count())
+	}
+}
+
+func TestNamespaceTTLIsolation(t *testing.T) {
+	c, clock := newCache(t)
+	a, b := c.Namespace("a/", 0), c.Namespace("b/", 0)
+	again := c.Namespace("a/", 0)
+
+	a.Set("before", 1, 0)
+	a.SetDefaultTTL(5 * time.Second)
+	a.Set("default", 1, 0)
+	a.Set("never", 1, -1)
+	b.Set("default", 1, 0)
+	again.Set("again", 1, 0)
+
+	a.SetMaxTTL(2 * time.Second)
+	a.Set("limited", 1, time.Hour)
+	a.Set("limited-never", 1, -1)
+	b.Set("long", 1, time.Hour)
+
+	clock.Advance(3 * time.Second)
+	tests := []struct {
+		name string
+		ns   *candycache.Namespace
+		key  string
+		want bool
+	}{
+		{"written before SetDefaultTTL", a, "before", true},
+		{"default TTL, before SetMaxTTL", a, "default", true},
+		{"negative ttl ignores default", a, "never", true},
+		{"max TTL clamps ttl", a, "limited", false},
+		{"max TTL clamps never", a, "limited-never", false},
+		{"other prefix", b, "long", true},
+		{"same prefix, other value", again, "again", true},
+	}
+	for _, tt := range tests {
+		if got := tt.ns.Has(tt.key); got != tt.want {
+			t.Errorf("%s: Has(%s) at 3s = %v, want %v", tt.name, tt.key, got, tt.want)
+		}
+	}
+
+	clock.Advance(3 * time.Second)
+	if a.Has("default") {
+		t.Error("Has(a/default) at 6s = true, want expired by the 5s default")
+	}
+	for _, key := range []string{"before", "never"} {
+		if !a.Has(key) {
+			t.Errorf("Has(a/%s) at 6s = false, want never expiring", key)
+		}
+	}
+	if !b.Has("default") || !again.Has("again") {
+		t.Error("default TTL of a/ leaked into another Namespace value")
+	}
+}
+
+func TestFallbackPromotion(t *testing.T) {
+	l2, clock := newCache(t)
+	l1 := candycache.Cacher(0, clock.Option(), candycache.WithFallback(l2, 2*time.Second))
+	t.Cleanup(l1.Close)
+
+	l2.Set("long", "l2", time.Hour)
+	l2.Set("short", "l2", time.Second)
+	l2.AddNegative("negative", time.Hour)
+
+	for _, key := range []string{"long", "short"} {
+		if data, err := l1.Get(key); err != nil || data != "l2" {
+			t.Fatalf("Get(%s) = %v, %v, want the L2 value", key, data, err)
+		}
+		if !l1.Has(key) {
+			t.Fatalf("Has(%s) = false, want the L2 hit promoted into L1", key)
+		}
+	}
+	if _, err := l1.Get("negative"); err != candycache.ErrNegative {
+		t.Fatalf("Get(negative) error = %v, want ErrNegative", err)
+	}
+
+	// Поднятый элемент живет в L1 не дольше promoteTTL и не дольше, чем в L2.
+	clock.Advance(1500 * time.Millisecond)
+	if l1.Has("short") {
+		t.Error("Has(short) = true after its L2 lifetime")
+	}
+	if !l1.Has("long") {
+		t.Error("Has(long) = false before promoteTTL")
+	}
+	clock.Advance(time.Second)
+	if l1.Has("long") {
+		t.Error("Has(long) = true after promoteTTL")
+	}
+
+	// Устаревший в L1 элемент не возвращается: Get ищет дальше и поднимает его заново.
+	l2.Set("long", "l2 v2", time.Hour)
+	if data, err := l1.Get("long"); err != nil || data != "l2 v2" {
+		t.Fatalf("Get(long) after promoteTTL = %v, %v, want the new L2 value", data, err)
+	}
+
+	// Delete удаляет элемент только из L1.
+	if err := l1.Delete("long"); err != nil {
+		t.Fatal(err)
+	}
+	if l1.Has("long") || !l2.Has("long") {
+		t.Fatalf("after Delete: L1 Has = %v, L2 Has = %v, want false, true", l1.Has("long"), l2.Has("long"))
+	}
+	if data, err := l1.Get("long"); err != nil || data != "l2 v2" {
+		t.Fatalf("Get(long) after Delete = %v, %v, want it promoted again", data, err)
+	}
+}
+
+func TestSealedTransfer(t *testing.T) {
+	tests := []struct {
+		name     string
+		transfer func(src, dst *candycache.Cache, key string) bool
+		moves    bool
+	}{
+		{"MoveTo", (*candycache.Cache).MoveTo, true},
+		{"CopyTo", (*candycache.Cache).CopyTo, false},
+	}
+
+	for _, tt := range tests {
+		for _, existing := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/existing=%v", tt.name, existing), func(t *testing.T) {
+				src, clock := newCache(t)
+				dst := candycache.Cacher(0, clock.Option())
+				t.Cleanup(dst.Close)
+
+				src.Set("key", "src", 0)
+				if existing {
+					dst.Set("key", "dst", 0)
+				}
+				src.Seal()
+
+				moved, panicked := func() (moved bool, panicked error) {
+					defer func() {
+						if r := recover(); r != nil {
+							panicked, _ = r.(error)
+						}
+					}()
+					return tt.transfer(src, dst, "key"), nil
+				}()
+
+				if tt.moves {
+					if !errors.Is(panicked, candycache.ErrSealed) {
+						t.Fatalf("panic = %v, want ErrSealed", panicked)
+					}
+				} else if panicked != nil || !moved {
+					t.Fatalf("CopyTo from a sealed cache = %v, panic %v, want true without panic", moved, panicked)
+				}
+
+				if data, err := src.Get("key"); err != nil || data != "src" {
+					t.Errorf("source after transfer = %v, %v, want it unchanged", data, err)
+				}
+				want := "dst"
+				if !existing {
+					want = ""
+				}
+				if !tt.moves {
+					want = "src"
+				}
+				data, _ := dst.Get("key")
+				if got, _ := data.(string); got != want {
+					t.Errorf("destination after transfer = %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestRetainLimitLoggerReadsCache(t *testing.T) {
+	clock := candycachetest.NewClock(epoch)
+	var c *candycache.Cache
+	counts := []int{}
+	logger := func(event string, fields map[string]interface{}) {
+		if event == "retain_limit" {
+			// Логгер вызывается вне блокировки, поэтому может читать кэш.
+			counts = append(counts, c.Count())
+		}
+	}
+	retain := func(string, interface{}) time.Duration { return time.Second }
+	c = candycache.Cacher(0, clock.Option(), candycache.WithLogger(logger), candycache.WithExpiryRetention(retain, 1))
+	t.Cleanup(c.Close)
+
+	c.Set("key", "data", time.Second)
+	candycachetest.AdvanceClock(c, 2*time.Second)
+	if !c.Has("key") {
+		t.Fatal("entry not retained by the first cleanup")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		candycachetest.AdvanceClock(c, 2*time.Second)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Cleanup hangs when the logger reads the cache")
+	}
+
+	if !slices.Equal(counts, []int{0}) {
+		t.Fatalf("Count() seen by the logger = %v, want [0]", counts)
+	}
+}
+
+func TestGetExtendCap(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		bump time.Duration
+		want time.Duration
+	}{
+		{"extended within cap", 10 * time.Second, 20 * time.Second, 30 * time.Second},
+		{"clamped to cap", 50 * time.Second, 20 * time.Second, time.Minute},
+		{"already beyond cap", time.Hour, 20 * time.Second, time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newCache(t, candycache.WithExtendCap(time.Minute))
+			c.Set("key", "data", tt.ttl)
+
+			if _, found := c.GetExtend("key", tt.bump); !found {
+				t.Fatal("GetExtend() found = false")
+			}
+
+			item := c.GetItems([]string{"key"})["key"]
+			if got, want := item.ExpiresAt(), epoch.Add(tt.want); !got.Equal(want) {
+				t.Fatalf("ExpiresAt() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestGetOrLoadCountsOneMiss(t *testing.T) {
+	c, _ := newCache(t, candycache.WithCapacity(1), candycache.WithGhostKeys(4))
+	load := func() (interface{}, error) { return "loaded", nil }
+
+	c.Set("evicted", 1, 0)
+	c.Set("other", 1, 0)
+
+	if _, err := c.GetOrLoad("evicted", 0, load); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Stats(); s.Misses != 1 || s.Hits != 0 {
+		t.Fatalf("after a miss: Hits = %d, Misses = %d, want 0, 1", s.Hits, s.Misses)
+	}
+	if got := c.GhostHits(); got != 1 {
+		t.Fatalf("GhostHits() = %d, want 1", got)
+	}
+
+	if _, err := c.GetOrLoad("evicted", 0, load); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Stats(); s.Misses != 1 || s.Hits != 1 {
+		t.Fatalf("after a hit: Hits = %d, Misses = %d, want 1, 1", s.Hits, s.Misses)
+	}
+}
+
+func TestNamespaceQuotaIsolation(t *testing.T) {
+	c, clock := newCache(t)
+	a := c.Namespace("a", 2)
+	ab := c.Namespace("ab", 0)
+	other := c.Namespace("other:", 0)
+
+	for _, key := range []string{"x", "y"} {
+		other.Set(key, 1, 0)
+		ab.Set(key, 1, 0)
+	}
+
+	a.Set(":old", 1, time.Hour)
+	clock.Advance(time.Second)
+	a.Set(":new", 1, time.Minute)
+	clock.Advance(time.Second)
+	if _, err := a.Get(":old"); err != nil {
+		t.Fatal(err)
+	}
+	// Квота заполнена: вытесняется элемент, к которому дольше не обращались (":new"),
+	// хотя ":old" устареет позже, а ключи пространства "ab" в квоту "a" не входят.
+	if err := a.Add(":third", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := slices.Sorted(slices.Values(a.Keys())), []string{":old", ":third"}; !slices.Equal(got, want) {
+		t.Fatalf("a.Keys() = %v, want %v", got, want)
+	}
+	for _, ns := range []*candycache.Namespace{ab, other} {
+		if ns.Count() != 2 {
+			t.Fatalf("another namespace lost entries: Count() = %d, want 2", ns.Count())
+		}
+	}
+
+	if deleted := a.Flush(); deleted != 2 {
+		t.Fatalf("a.Flush() = %d, want 2", deleted)
+	}
+	if ab.Count() != 2 {
+		t.Fatalf("a.Flush() removed keys of namespace ab: Count() = %d", ab.Count())
+	}
+}
+
+func TestEvictionCandidateAccess(t *testing.T) {
+	byPriorityThenCold := func(a, b candycache.EvictionCandidate) bool {
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.LastAccess.Before(b.LastAccess)
+	}
+
+	tests := []struct {
+		name    string
+		less    func(a, b candycache.EvictionCandidate) bool
+		evicted string
+	}{
+		{"lru", candycache.EvictByLRU, "b"},
+		{"priority then coldness", byPriorityThenCold, "c"},
+		{"age", candycache.EvictByAge, "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, clock := newCache(t, candycache.WithCapacity(3), candycache.WithAccessTracking(),
+				candycache.WithEvictionComparator(tt.less))
+
+			// a и b дорогие, c дешевый; b - самый холодный: к a и c обращались позже.
+			for _, e := range []struct {
+				key  string
+				cost int64
+			}{{"a", 5}, {"b", 5}, {"c", 1}} {
+				if err := c.AddOpts(e.key, e.key, candycache.WithItemCost(e.cost)); err != nil {
+					t.Fatal(err)
+				}
+				clock.Advance(time.Second)
+			}
+			c.Get("a")
+			clock.Advance(time.Second)
+			c.Get("c")
+
+			if err := c.Add("new", "new", 0); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"a", "b", "c"} {
+				if got, want := c.Has(key), key != tt.evicted; got != want {
+					t.Errorf("Has(%q) = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvictionPolicyFIFOvsLRU(t *testing.T) {
+	tests := []struct {
+		policy  candycache.EvictionPolicy
+		evicted string
+	}{
+		{candycache.PolicyFIFO, "a"},
+		{candycache.PolicyLRU, "b"},
+		{candycache.PolicyLFU, "c"},
+		{candycache.PolicyExpiry, "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(int(tt.policy)), func(t *testing.T) {
+			c, clock := newCache(t, candycache.WithCapacity(3), candycache.WithEvictionPolicy(tt.policy))
+
+			// Один и тот же порядок обращений для всех политик: "a" добавлен первым, но к нему
+			// обращаются чаще и позже всех; к "b" обращались давнее всех, к "c" - реже всех.
+			ttls := map[string]time.Duration{"a": time.Hour, "b": time.Minute, "c": 2 * time.Hour}
+			for _, key := range []string{"a", "b", "c"} {
+				c.Set(key, key, ttls[key])
+				clock.Advance(time.Second)
+			}
+			for _, key := range []string{"b", "b", "c", "a", "a", "a"} {
+				c.Get(key)
+				clock.Advance(time.Second)
+			}
+
+			if err := c.Add("new", "new", 0); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"a", "b", "c"} {
+				if got, want := c.Has(key), key != tt.evicted; got != want {
+					t.Errorf("Has(%q) = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReshardConcurrentWrites(t *testing.T) {
+	for _, sizes := range [][2]int{{2, 8}, {8, 2}} {
+		t.Run(fmt.Sprintf("%d to %d", sizes[0], sizes[1]), func(t *testing.T) {
+			c := candycache.Sharded(sizes[0], 0)
+			t.Cleanup(c.Close)
+			for i := range 20000 {
+				c.Set("old"+strconv.Itoa(i), i, 0)
+			}
+
+			// Запись идет все время, пока работает Reshard.
+			var resharded atomic.Bool
+			started, written := make(chan struct{}), make(chan int)
+			go func() {
+				i := 0
+				for ; i == 0 || !resharded.Load(); i++ {
+					c.Set("new"+strconv.Itoa(i), i, 0)
+					if i == 0 {
+						close(started)
+					}
+				}
+				written <- i
+			}()
+			<-started
+			c.Reshard(sizes[1])
+			resharded.Store(true)
+
+			for i := range <-written {
+				if data, err := c.Get("new" + strconv.Itoa(i)); err != nil || data != i {
+					t.Fatalf("Get(new%d) = %v, %v after concurrent Reshard", i, data, err)
+				}
+			}
+			for i := range 20000 {
+				if data, err := c.Get("old" + strconv.Itoa(i)); err != nil || data != i {
+					t.Fatalf("Get(old%d) = %v, %v after Reshard", i, data, err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWithoutLocking(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		opts []candycache.Option
+	}{
+		{"locked", nil},
+		{"without locking", []candycache.Option{candycache.WithoutLocking()}},
+	} {
+		c := candycache.Cacher(0, bb.opts...)
+		keys := make([]string, 1024)
+		for i := range keys {
+			keys[i] = "key" + strconv.Itoa(i)
+			c.Set(keys[i], i, 0)
+		}
+
+		b.Run(bb.name+"/Get", func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				c.Get(keys[i%len(keys)])
+			}
+		})
+		b.Run(bb.name+"/Set", func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				c.Set(keys[i%len(keys)], i, 0)
+			}
+		})
+		c.Close()
+	}
+}
+
+func TestRLocker(t *testing.T) {
+	for _, opts := range [][]candycache.Option{nil, {candycache.WithoutLocking()}} {
+		c := candycache.Cacher(0, opts...)
+		c.Set("key", "data", 0)
+
+		l := c.RLocker()
+		l.Lock()
+		// Под блокировкой на чтение другое чтение проходит.
+		if !c.Has("key") {
+			t.Fatal("Has() = false under RLocker")
+		}
+		l.Unlock()
+		c.Close()
+	}
+}
+
+func TestGetStaleOrLoad(t *testing.T) {
+	c, clock := newCache(t)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := func() (interface{}, error) {
+		calls.Add(1)
+		<-release
+		return "fresh", nil
+	}
+
+	c.Set("key", "stale", time.Second)
+	if data, stale, err := c.GetStaleOrLoad("key", time.Minute, load); err != nil || stale || data != "stale" {
+		t.Fatalf("live entry = %v, %v, %v, want stale data unmarked", data, stale, err)
+	}
+
+	clock.Advance(2 * time.Second)
+	for range 3 {
+		if data, stale, err := c.GetStaleOrLoad("key", time.Minute, load); err != nil || !stale || data != "stale" {
+			t.Fatalf("expired entry = %v, %v, %v, want stale data marked stale", data, stale, err)
+		}
+	}
+
+	// GetOrLoad дожидается уже идущей фоновой загрузки, а не начинает свою.
+	got := make(chan interface{})
+	go func() {
+		data, _ := c.GetOrLoad("key", time.Minute, load)
+		got <- data
+	}()
+	close(release)
+	if data := <-got; data != "fresh" {
+		t.Fatalf("GetOrLoad during the refresh = %v, want fresh", data)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("load called %d times, want 1", n)
+	}
+	if data, stale, err := c.GetStaleOrLoad("key", time.Minute, load); err != nil || stale || data != "fresh" {
+		t.Fatalf("after the refresh = %v, %v, %v, want fresh", data, stale, err)
+	}
+}
+
+func TestGetStaleOrLoadKeepsStaleOnError(t *testing.T) {
+	c, clock := newCache(t, candycache.WithErrorTTL(time.Minute))
+	failed := make(chan struct{}, 1)
+	load := func() (interface{}, error) {
+		defer func() {
+			select {
+			case failed <- struct{}{}:
+			default:
+			}
+		}()
+		return nil, errors.New("source down")
+	}
+
+	c.Set("key", "stale", time.Second)
+	clock.Advance(2 * time.Second)
+	if _, stale, err := c.GetStaleOrLoad("key", time.Minute, load); err != nil || !stale {
+		t.Fatalf("GetStaleOrLoad() = %v, %v, want stale without error", stale, err)
+	}
+	<-failed
+
+	// Ошибка не запомнилась и не заменила устаревшее значение.
+	if data, stale, err := c.GetStaleOrLoad("key", time.Minute, load); err != nil || data != "stale" || !stale {
+		t.Fatalf("after a failed refresh = %v, %v, %v, want the stale value kept", data, stale, err)
+	}
+}
+
+func TestSoftByteTargetEvictsColdest(t *testing.T) {
+	probe := candycache.Cacher(0)
+	probe.Set("cold", "data", 0)
+	size := probe.Size()
+	probe.Close()
+
+	for _, tt := range []struct {
+		name string
+		opts []candycache.Option
+	}{
+		{"fewest hits", nil},
+		{"least recently used", []candycache.Option{candycache.WithAccessTracking()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Места хватает одному элементу. "warm" устареет раньше, но его читают чаще и позже.
+			c, clock := newCache(t, append(tt.opts, candycache.WithSoftByteTarget(2*size-1))...)
+			c.Set("cold", "data", time.Hour)
+			c.Set("warm", "data", time.Minute)
+			c.Get("cold")
+			clock.Advance(time.Second)
+			for range 3 {
+				c.Get("warm")
+			}
+
+			c.Cleanup()
+			if c.Has("cold") || !c.Has("warm") {
+				t.Fatalf("after Cleanup: Has(cold) = %v, Has(warm) = %v, want the cold entry evicted", c.Has("cold"), c.Has("warm"))
+			}
+		})
+	}
+}
+
+func TestSaveRelativeClockSkew(t *testing.T) {
+	tests := []struct {
+		name     string
+		skew     time.Duration // Насколько часы загружающей машины впереди сохранившей
+		relative bool
+		expired  bool          // Устарел ли элемент с 10 минутами жизни сразу после загрузки
+		left     time.Duration // Сколько элемент проживет после загрузки, если не устарел
+	}{
+		{"absolute, loader ahead", time.Hour, false, true, 0},
+		{"relative, loader ahead", time.Hour, true, false, 10 * time.Minute},
+		{"absolute, loader behind", -time.Hour, false, false, 70 * time.Minute},
+		{"relative, loader behind", -time.Hour, true, false, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, _ := newCache(t)
+			src.Set("key", "data", 10*time.Minute)
+
+			var dump bytes.Buffer
+			save := src.Save
+			if tt.relative {
+				save = src.SaveRelative
+			}
+			if err := save(&dump); err != nil {
+				t.Fatal(err)
+			}
+
+			clock := candycachetest.NewClock(epoch.Add(tt.skew))
+			dst := candycache.Cacher(0, clock.Option())
+			t.Cleanup(dst.Close)
+			if err := dst.Load(&dump); err != nil {
+				t.Fatal(err)
+			}
+
+			if expired, _ := dst.IsExpired("key"); expired != tt.expired {
+				t.Fatalf("IsExpired() after Load = %v, want %v", expired, tt.expired)
+			}
+			if tt.expired {
+				return
+			}
+
+			clock.Advance(tt.left - time.Second)
+			if expired, _ := dst.IsExpired("key"); expired {
+				t.Fatalf("entry expired before %v", tt.left)
+			}
+			clock.Advance(time.Second)
+			if expired, _ := dst.IsExpired("key"); !expired {
+				t.Fatalf("entry outlived %v", tt.left)
+			}
+		})
+	}
+}
+
+func TestNegativeTTLNeverExpires(t *testing.T) {
+	writes := []struct {
+		name  string
+		write func(c *candycache.Cache) error
+	}{
+		{"Set", func(c *candycache.Cache) error { c.Set("key", "data", -time.Second); return nil }},
+		{"Add", func(c *candycache.Cache) error { return c.Add("key", "data", -time.Second) }},
+		{"TryAdd", func(c *candycache.Cache) error { return c.TryAdd("key", "data", -time.Second) }},
+		{"AddWithPriority", func(c *candycache.Cache) error {
+			return c.AddWithPriority("key", "data", -time.Second, false)
+		}},
+	}
+
+	for _, w := range writes {
+		t.Run(w.name, func(t *testing.T) {
+			c, _ := newCache(t)
+			if err := w.write(c); err != nil {
+				t.Fatal(err)
+			}
+
+			item := c.GetItems([]string{"key"})["key"]
+			if !item.ExpiresAt().IsZero() {
+				t.Fatalf("ExpiresAt() = %v, want zero for a negative ttl", item.ExpiresAt())
+			}
+
+			candycachetest.AdvanceClock(c, 1000*time.Hour)
+			if data, err := c.Get("key"); err != nil || data != "data" {
+				t.Fatalf("Get after Cleanup = %v, %v, want the entry kept", data, err)
+			}
+		})
+	}
+}
+
+func TestAddVersusSet(t *testing.T) {
+	variants := []struct {
+		name      string
+		write     func(c *candycache.Cache) error
+		overwrite bool // Заменяет ли запись неустаревший элемент
+	}{
+		{"Set", func(c *candycache.Cache) error { c.Set("key", "new", 0); return nil }, true},
+		{"Add", func(c *candycache.Cache) error { return c.Add("key", "new", 0) }, false},
+		{"TryAdd", func(c *candycache.Cache) error { return c.TryAdd("key", "new", 0) }, false},
+		{"AddWithPriority", func(c *candycache.Cache) error { return c.AddWithPriority("key", "new", 0, true) }, false},
+		{"AddOpts", func(c *candycache.Cache) error { return c.AddOpts("key", "new") }, false},
+		{"AddKey", func(c *candycache.Cache) error { return c.AddKey("key", "new", 0) }, false},
+	}
+	states := []struct {
+		name  string
+		setup func(c *candycache.Cache, clock *candycachetest.Clock)
+		live  bool // Лежит ли по ключу неустаревший элемент
+	}{
+		{"absent", func(*candycache.Cache, *candycachetest.Clock) {}, false},
+		{"live", func(c *candycache.Cache, _ *candycachetest.Clock) { c.Set("key", "old", time.Hour) }, true},
+		{"expired", func(c *candycache.Cache, clock *candycachetest.Clock) {
+			c.Set("key", "old", time.Second)
+			clock.Advance(2 * time.Second)
+		}, false},
+	}
+
+	for _, v := range variants {
+		for _, st := range states {
+			t.Run(v.name+"/"+st.name, func(t *testing.T) {
+				c, clock := newCache(t)
+				st.setup(c, clock)
+
+				err := v.write(c)
+				refused := st.live && !v.overwrite
+				if refused != errors.Is(err, candycache.ErrKeyExists) {
+					t.Fatalf("error = %v, want ErrKeyExists: %v", err, refused)
+				}
+				if !refused && err != nil {
+					t.Fatal(err)
+				}
+
+				want := "new"
+				if refused {
+					want = "old"
+				}
+				if data, err := c.Get("key"); err != nil || data != want {
+					t.Fatalf("Get() = %v, %v, want %q", data, err, want)
+				}
+			})
+		}
+	}
+}
+
+func TestListBetweenExpiryAndCleanup(t *testing.T) {
+	c, clock := newCache(t)
+	c.Set("short", 1, time.Second)
+	c.Set("long", 2, time.Hour)
+
+	keys := func(items []candycache.KeyItemPair) []string {
+		var keys []string
+		for _, item := range items {
+			keys = append(keys, item.Key)
+		}
+		slices.Sort(keys)
+		return keys
+	}
+	check := func(stage string, list, live []string) {
+		t.Helper()
+		if got := keys(c.List()); !slices.Equal(got, list) {
+			t.Errorf("%s: List() keys = %v, want %v", stage, got, list)
+		}
+		if got := keys(c.ListLive()); !slices.Equal(got, live) {
+			t.Errorf("%s: ListLive() keys = %v, want %v", stage, got, live)
+		}
+	}
+
+	check("before expiry", []string{"long", "short"}, []string{"long", "short"})
+
+	// Элемент устарел, но очистка еще не прошла: List его возвращает, ListLive - нет.
+	clock.Advance(time.Second)
+	check("expired, not collected", []string{"long", "short"}, []string{"long"})
+
+	c.Cleanup()
+	check("after Cleanup", []string{"long"}, []string{"long"})
+}
+
+func TestShardBalance(t *testing.T) {
+	const shards, keys = 8, 16000
+
+	for _, tt := range []struct {
+		name string
+		opts []candycache.ShardedOption
+	}{
+		{"default", nil},
+		{"nil hasher keeps default", []candycache.ShardedOption{candycache.WithHasher(nil)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := candycache.Sharded(shards, 0, tt.opts...)
+			t.Cleanup(c.Close)
+
+			// Последовательные числовые ключи - типичный неудобный для хеша набор.
+			for i := range keys {
+				c.Set("user:"+strconv.Itoa(i), i, 0)
+			}
+
+			mean := keys / shards
+			for i, n := range c.ShardCounts() {
+				if abs(n-mean) > mean/4 {
+					t.Errorf("shard %d holds %d keys, want %d ± 25%%", i, n, mean)
+				}
+			}
+		})
+	}
+}
+
+func TestShardCustomHasher(t *testing.T) {
+	var calls atomic.Int64
+	hasher := func(key string) uint64 {
+		calls.Add(1)
+		return 42
+	}
+	c := candycache.Sharded(4, 0, candycache.WithHasher(hasher))
+	t.Cleanup(c.Close)
+
+	for i := range 100 {
+		c.Set(strconv.Itoa(i), i, 0)
+	}
+	if calls.Load() == 0 {
+		t.Fatal("custom hasher never called")
+	}
+
+	// Один хеш на все ключи - все ключи в одном шарде.
+	counts := c.ShardCounts()
+	if !slices.Contains(counts, 100) {
+		t.Fatalf("ShardCounts() = %v, want all 100 keys in one shard", counts)
+	}
+	if data, err := c.Get("7"); err != nil || data != 7 {
+		t.Fatalf("Get() = %v, %v", data, err)
+	}
+}
+
+func TestSizeStringKeys(t *testing.T) {
+	sizeOf := func(key string) int {
+		c := candycache.Cacher(0)
+		defer c.Close()
+		c.Set(key, nil, 0)
+		return c.Size()
+	}
+
+	// Пустой ключ - только заголовок строки (и поля элемента), остальные добавляют свои байты UTF-8.
+	empty := sizeOf("")
+	if header := int(unsafe.Sizeof("")); empty < header {
+		t.Fatalf("Size() with an empty key = %d, want at least the string header %d", empty, header)
+	}
+
+	for _, key := range []string{"key", "ключ", "🍬🍭", strings.Repeat("к", 10000)} {
+		if got, want := sizeOf(key)-empty, len(key); got != want {
+			t.Errorf("key %.10q (%d runes) adds %d bytes, want its byte length %d", key, utf8.RuneCountInString(key), got, want)
+		}
+	}
+}
+
+func TestSingleGC(t *testing.T) {
+	ticks := make(chan time.Time)
+	runs := make(chan struct{}, 16)
+	logger := func(event string, _ map[string]interface{}) {
+		if event == "gc" {
+			runs <- struct{}{}
+		}
+	}
+
+	before := runtime.NumGoroutine()
+	c := candycache.Cacher(time.Hour, candycache.WithTickSource(ticks), candycache.WithLogger(logger))
+	t.Cleanup(c.Close)
+
+	// Все пути запуска gc, многократно и из нескольких горутин.
+	done := make(chan struct{})
+	for range 8 {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for range 50 {
+				c.SetCleanupInterval(time.Hour)
+				c.Unseal()
+			}
+		}()
+	}
+	for range 8 {
+		<-done
+	}
+	for range 20 {
+		c.Seal()
+		c.Unseal()
+	}
+
+	// Остановленные gc завершаются не сразу, поэтому лишние горутины ждем до секунды.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before+1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine() - before; n > 1 {
+		t.Fatalf("%d goroutines left running after repeated starts, want one gc", n)
+	}
+
+	ticks <- time.Now()
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("gc not running after repeated starts")
+	}
+}
+
+type gobPoint struct {
+	X, Y int
+	Name string
+}
+
+func TestItemGobRoundTrip(t *testing.T) {
+	gob.Register(gobPoint{})
+	gob.Register(map[string]int{})
+
+	values := []interface{}{
+		"строка",
+		42,
+		int64(-7),
+		uint32(9),
+		3.5,
+		true,
+		[]byte{0, 1, 255},
+		[]string{"a", "b"},
+		[]int{1, 2, 3},
+		map[string]int{"a": 1},
+		gobPoint{X: 1, Y: -2, Name: "p"},
+	}
+
+	for _, value := range values {
+		t.Run(fmt.Sprintf("%T", value), func(t *testing.T) {
+			c, _ := newCache(t)
+			err := c.AddOpts("key", value,
+				candycache.WithItemTTL(time.Hour),
+				candycache.WithItemTags("t1", "t2"),
+				candycache.WithItemPriority(true),
+				candycache.WithItemCost(5),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			item := c.List()[0].Item
+
+			buf := bytes.Buffer{}
+			if err := gob.NewEncoder(&buf).Encode(item); err != nil {
+				t.Fatal(err)
+			}
+			got := candycache.Item{}
+			if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got.Data(), value) {
+				t.Fatalf("data %#v (%T), want %#v (%T)", got.Data(), got.Data(), value, value)
+			}
+			if got.DestroyTimestamp() != item.DestroyTimestamp() || got.CreatedAt() != item.CreatedAt() {
+				t.Fatalf("timestamps %d/%d, want %d/%d",
+					got.DestroyTimestamp(), got.CreatedAt(), item.DestroyTimestamp(), item.CreatedAt())
+			}
+			if !slices.Equal(got.Tags(), item.Tags()) || got.Cost() != 5 || !got.IsProtected() ||
+				got.Version() != item.Version() || got.IsNegative() {
+				t.Fatalf("metadata tags=%v cost=%d protected=%v version=%d negative=%v",
+					got.Tags(), got.Cost(), got.IsProtected(), got.Version(), got.IsNegative())
+			}
+
+			// Весь кэш проходит через gob так же.
+			data, err := c.GobEncode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			restored, _ := newCache(t)
+			if err := restored.GobDecode(data); err != nil {
+				t.Fatal(err)
+			}
+			if v, err := restored.Get("key"); err != nil || !reflect.DeepEqual(v, value) {
+				t.Fatalf("restored Get = %#v, %v, want %#v", v, err, value)
+			}
+		})
+	}
+}
+
+func TestCloseWrites(t *testing.T) {
+	source, _ := newCache(t)
+	source.Set("ns:k", "new", 0)
+	saved := bytes.Buffer{}
+	if err := source.Save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := source.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Записи, которые после Close возвращают ErrClosed.
+	failing := map[string]func(c *candycache.Cache) error{
+		"Add": func(c *candycache.Cache) error { return c.Add("ns:k", "new", 0) },
+		"AddWithPriority": func(c *candycache.Cache) error {
+			return c.AddWithPriority("ns:k", "new", 0, true)
+		},
+		"AddOpts":       func(c *candycache.Cache) error { return c.AddOpts("ns:k", "new") },
+		"TryAdd":        func(c *candycache.Cache) error { return c.TryAdd("ns:k", "new", 0) },
+		"Append":        func(c *candycache.Cache) error { return c.Append("ns:k", "new", 0, 10) },
+		"Load":          func(c *candycache.Cache) error { return c.Load(bytes.NewReader(saved.Bytes())) },
+		"Namespace.Add": func(c *candycache.Cache) error { return c.Namespace("ns:", 0).Add("k", "new", 0) },
+		"GobDecode":     func(c *candycache.Cache) error { return c.GobDecode(encoded) },
+	}
+	// Записи, которые после Close молча ничего не делают.
+	silent := map[string]func(t *testing.T, c *candycache.Cache){
+		"Set":         func(t *testing.T, c *candycache.Cache) { c.Set("ns:k", "new", 0) },
+		"AddNegative": func(t *testing.T, c *candycache.Cache) { c.AddNegative("ns:k", 0) },
+		"Fill": func(t *testing.T, c *candycache.Cache) {
+			ch := make(chan candycache.KeyDataTTL, 1)
+			ch <- candycache.KeyDataTTL{Key: "ns:k", Data: "new"}
+			close(ch)
+			c.Fill(ch)
+		},
+		"ReplaceAll": func(t *testing.T, c *candycache.Cache) {
+			c.ReplaceAll(map[string]interface{}{"ns:seed": "old", "ns:k": "new"}, 0)
+		},
+		"Update": func(t *testing.T, c *candycache.Cache) {
+			c.Update(func(string, interface{}) (interface{}, bool, time.Duration) { return "new", true, 0 })
+		},
+		"UpdateIfVersion": func(t *testing.T, c *candycache.Cache) {
+			_, ok := c.UpdateIfVersion("ns:seed", c.List()[0].Item.Version(), "new", 0)
+			if ok == c.IsClosed() {
+				t.Errorf("UpdateIfVersion = %v with closed = %v", ok, c.IsClosed())
+			}
+		},
+		"Tx.Set": func(t *testing.T, c *candycache.Cache) {
+			c.Transaction(func(tx *candycache.Tx) { tx.Set("ns:k", "new", 0) })
+		},
+		"Namespace.Set": func(t *testing.T, c *candycache.Cache) { c.Namespace("ns:", 0).Set("k", "new", 0) },
+	}
+
+	// Запись удалась, если появился ns:k или изменился ns:seed.
+	written := func(c *candycache.Cache) bool {
+		seed, _ := c.Get("ns:seed")
+		return slices.Contains(c.Keys(), "ns:k") || seed != "old"
+	}
+
+	for _, closeFirst := range []bool{false, true} {
+		for name, write := range failing {
+			t.Run(fmt.Sprintf("%s/closed=%v", name, closeFirst), func(t *testing.T) {
+				c, _ := newCache(t)
+				c.Set("ns:seed", "old", 0)
+				if closeFirst {
+					c.Close()
+				}
+				err := write(c)
+				switch {
+				case !closeFirst && (err != nil || !written(c)):
+					t.Fatalf("open cache: err = %v, written = %v", err, written(c))
+				case closeFirst && (!errors.Is(err, candycache.ErrClosed) || written(c)):
+					t.Fatalf("closed cache: err = %v, written = %v, want ErrClosed and no write", err, written(c))
+				}
+			})
+		}
+		for name, write := range silent {
+			t.Run(fmt.Sprintf("%s/closed=%v", name, closeFirst), func(t *testing.T) {
+				c, _ := newCache(t)
+				c.Set("ns:seed", "old", 0)
+				if closeFirst {
+					c.Close()
+				}
+				write(t, c)
+				if written(c) == closeFirst {
+					t.Fatalf("closed = %v, written = %v", closeFirst, written(c))
+				}
+			})
+		}
+	}
+}
+
+func TestCloseKeepsReadsAndDeletes(t *testing.T) {
+	fill := func(closeFirst bool) (*candycache.Cache, *candycachetest.Clock) {
+		c, clock := newCache(t)
+		for _, key := range []string{"a", "b", "p:1", "p:2"} {
+			c.Set(key, key, time.Minute)
+		}
+		if closeFirst {
+			c.Close()
+		}
+		return c, clock
+	}
+
+	for _, closeFirst := range []bool{false, true} {
+		t.Run(fmt.Sprintf("closed=%v", closeFirst), func(t *testing.T) {
+			c, clock := fill(closeFirst)
+
+			if data, err := c.Get("a"); err != nil || data != "a" {
+				t.Fatalf("Get = %v, %v", data, err)
+			}
+			if !c.Has("b") || len(c.Keys()) != 4 || len(c.List()) != 4 {
+				t.Fatalf("Has = %v, Keys = %v, List = %d", c.Has("b"), c.Keys(), len(c.List()))
+			}
+
+			// Продление существующих элементов.
+			if _, ok := c.GetExtend("a", time.Minute); !ok {
+				t.Fatal("GetExtend failed")
+			}
+			if _, ok := c.GetRefresh("b", 3*time.Minute); !ok {
+				t.Fatal("GetRefresh failed")
+			}
+			if n := c.TouchMany([]string{"p:1", "p:2"}, 3*time.Minute); n != 2 {
+				t.Fatalf("TouchMany = %d, want 2", n)
+			}
+			clock.Advance(90 * time.Second)
+			if !c.Has("a") || !c.Has("b") || !c.Has("p:1") {
+				t.Fatal("extended entries expired")
+			}
+
+			// Удаления.
+			if !c.Expire("b") || c.Has("b") {
+				t.Fatal("Expire failed")
+			}
+			c.Cleanup()
+			if slices.Contains(c.Keys(), "b") {
+				t.Fatal("Cleanup kept the expired entry")
+			}
+			if n := c.DeletePrefix("p:"); n != 2 {
+				t.Fatalf("DeletePrefix = %d, want 2", n)
+			}
+			if err := c.Delete("a"); err != nil {
+				t.Fatal(err)
+			}
+			if c.Count() != 0 {
+				t.Fatalf("Count = %d after deletes", c.Count())
+			}
+
+			c2, _ := fill(closeFirst)
+			if n := len(c2.Drain()); n != 4 || c2.Count() != 0 {
+				t.Fatalf("Drain = %d, Count = %d", n, c2.Count())
+			}
+			c3, _ := fill(closeFirst)
+			c3.Flush()
+			if c3.Count() != 0 {
+				t.Fatalf("Flush left %d entries", c3.Count())
+			}
+		})
+	}
+}
+
+func TestCloseStopsGC(t *testing.T) {
+	ticks := make(chan time.Time)
+	c := candycache.Cacher(time.Hour, candycache.WithTickSource(ticks))
+	c.Close()
+	c.Close()
+	c.SetCleanupInterval(time.Minute)
+
+	if !c.IsClosed() {
+		t.Fatal("IsClosed = false after Close")
+	}
+	// Остановленный gc может успеть принять сигнал, пока выходит, но затем перестает их читать.
+	for range 100 {
+		select {
+		case ticks <- time.Now():
+		case <-time.After(50 * time.Millisecond):
+			return
+		}
+	}
+	t.Fatal("gc still running after Close")
+}
+
+func TestNonPositiveIntervalStartsNoGC(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		t.Run(interval.String(), func(t *testing.T) {
+			before := runtime.NumGoroutine()
+			for range 20 {
+				c := candycache.Cacher(interval)
+				c.Set("key", "value", time.Nanosecond)
+				t.Cleanup(c.Close)
+			}
+			if n := runtime.NumGoroutine() - before; n > 0 {
+				t.Fatalf("%d goroutines started by 20 caches with interval %v, want none", n, interval)
+			}
+		})
+	}
+}
+
+func TestFairEvictionInsertRates(t *testing.T) {
+	const capacity, quiet = 100, 20
+
+	// Шумное пространство пишет в 50 раз чаще тихого.
+	run := func(opts ...candycache.Option) map[string]int {
+		c, _ := newCache(t, append(opts, candycache.WithCapacity(capacity), candycache.WithFIFOEviction())...)
+		noisyNS, quietNS := c.Namespace("noisy:", 0), c.Namespace("quiet:", 0)
+		for i := range quiet {
+			for j := range 50 {
+				noisyNS.Set(strconv.Itoa(i*50+j), j, 0)
+			}
+			quietNS.Set(strconv.Itoa(i), i, 0)
+		}
+		return c.NamespaceUsage()
+	}
+
+	fair := run(candycache.WithFairNamespaceEviction())
+	if fair["quiet:"] != quiet || fair["noisy:"] != capacity-quiet {
+		t.Fatalf("fair eviction usage = %v, want quiet:%d noisy:%d", fair, quiet, capacity-quiet)
+	}
+
+	// Без справедливого вытеснения тихое пространство теряет свои элементы.
+	unfair := run()
+	if unfair["quiet:"] >= quiet {
+		t.Fatalf("usage without fair eviction = %v, want quiet entries evicted", unfair)
+	}
+}
+
+func TestEarlyExpirationSpreadsRecomputes(t *testing.T) {
+	const (
+		ttl     = 10 * time.Second
+		cost    = time.Second // сколько занимает пересчет
+		step    = 10 * time.Millisecond
+		readers = 10 // чтений за шаг, т.е. 1000 в секунду
+	)
+
+	// Моделирует чтения одного ключа в течение 50 секунд: при промахе читающий запускает пересчет,
+	// который длится cost и затем записывает значение заново. Вернет наибольшее число пересчетов,
+	// шедших одновременно.
+	simulate := func(opts ...candycache.Option) int {
+		c, clock := newCache(t, opts...)
+		put := func() {
+			c.Delete("key")
+			if err := c.AddOpts("key", "value", candycache.WithItemTTL(ttl), candycache.WithItemCost(int64(cost))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		put()
+
+		var inflight []time.Time
+		peak := 0
+		for range 50 * time.Second / step {
+			candycachetest.AdvanceClock(c, step)
+			if len(inflight) > 0 && !clock.Now().Before(inflight[0]) {
+				put()
+				inflight = nil
+			}
+			for range readers {
+				if _, err := c.Get("key"); err != nil {
+					inflight = append(inflight, clock.Now().Add(cost))
+				}
+			}
+			peak = max(peak, len(inflight))
+		}
+		return peak
+	}
+
+	// Без досрочного устаревания промахиваются все чтения, пока идет первый пересчет: 1000.
+	plain := simulate()
+	if plain != readers*int(cost/step) {
+		t.Fatalf("peak without early expiration = %d, want %d", plain, readers*int(cost/step))
+	}
+
+	// С beta = 1 вероятность досрочного промаха за d до устаревания - exp(-d/cost), поэтому первый
+	// промах при 1000 чтениях в секунду ожидается примерно за ln(1000)·cost ≈ 7s до устаревания,
+	// и пока идет пересчет, промахиваются еще около 1000·(exp(-6) - exp(-7)) ≈ 2 чтений - несколько
+	// пересчетов вместо тысячи. Проверяем с запасом на случайность: одновременных пересчетов
+	// должно быть хотя бы в 20 раз меньше.
+	early := simulate(candycache.WithEarlyExpiration(1))
+	if early > plain/20 {
+		t.Fatalf("peak with early expiration = %d, want at most %d (without: %d)", early, plain/20, plain)
+	}
+	t.Logf("simultaneous recomputes: %d without early expiration, %d with beta = 1", plain, early)
+}
+
+func BenchmarkCleanupTick(b *testing.B) {
+	const horizon = 3600 // Время жизни элементов распределено по часу, за тик в 1s устаревает 1/3600
+
+	for _, size := range []int{10_000, 100_000, 1_000_000} {
+		for _, bb := range []struct {
+			name string
+			opts []candycache.Option
+		}{
+			{"full scan", nil},
+			{"expiry buckets", []candycache.Option{candycache.WithExpiryBuckets(time.Second)}},
+		} {
+			b.Run(fmt.Sprintf("%s/%d", bb.name, size), func(b *testing.B) {
+				c, clock := newCache(b, bb.opts...)
+				keys := make([]string, size)
+				for i := range keys {
+					keys[i] = strconv.Itoa(i)
+					c.Set(keys[i], i, time.Duration(i%horizon+1)*time.Second)
+				}
+
+				for tick := 0; b.Loop(); tick++ {
+					clock.Advance(time.Second)
+					c.Cleanup()
+
+					// Возвращает устаревшие за тик элементы, чтобы размер кэша не менялся.
+					b.StopTimer()
+					for i := tick % horizon; i < size; i += horizon {
+						c.Set(keys[i], i, horizon*time.Second)
+					}
+					b.StartTimer()
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkStaleServeWindow(b *testing.B) {
+	const interval = 50 * time.Millisecond
+
+	for _, bb := range []struct {
+		name string
+		opts []candycache.Option
+	}{
+		{"fixed interval", nil},
+		{"adaptive", []candycache.Option{candycache.WithAdaptiveCleanup(time.Millisecond, interval)}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			c := candycache.Cacher(interval, bb.opts...)
+			defer c.Close()
+
+			// Сколько элемент, уже устаревший, еще лежит в кэше и может быть отдан через Get.
+			var stale time.Duration
+			for i := 0; b.Loop(); i++ {
+				ttl := time.Duration(1+i%5) * time.Millisecond
+				expiresAt := time.Now().Add(ttl)
+				c.Set("key", i, ttl)
+				for c.Count() > 0 {
+					time.Sleep(100 * time.Microsecond)
+				}
+				stale += max(time.Since(expiresAt), 0)
+			}
+			b.ReportMetric(float64(stale.Nanoseconds())/float64(b.N), "stale-ns/op")
+		})
+	}
+}
+
+func BenchmarkShardedCleanupSkewed(b *testing.B) {
+	const shards, hot, cold = 64, 50_000, 500 // В одном шарде устаревших элементов в 100 раз больше
+
+	// Горячие ключи h<i> попадают в один шард, холодные k<i> - равномерно во все.
+	hasher := func(key string) uint64 {
+		if key[0] == 'h' {
+			return 0
+		}
+		n, _ := strconv.ParseUint(key[1:], 10, 64)
+		return n
+	}
+	fill := func(set func(key string, inHot bool)) {
+		for i := range hot {
+			set("h"+strconv.Itoa(i), true)
+		}
+		for i := range shards * cold {
+			set("k"+strconv.Itoa(i), false)
+		}
+	}
+
+	b.Run("work queue", func(b *testing.B) {
+		s := candycache.Sharded(shards, 0, candycache.WithHasher(hasher))
+		defer s.Close()
+		for b.Loop() {
+			b.StopTimer()
+			fill(func(key string, _ bool) { s.Set(key, key, time.Nanosecond) })
+			time.Sleep(time.Microsecond)
+			b.StartTimer()
+
+			s.Cleanup()
+		}
+	})
+
+	b.Run("goroutine per shard", func(b *testing.B) {
+		caches := make([]*candycache.Cache, shards)
+		for i := range caches {
+			caches[i] = candycache.Cacher(0)
+			defer caches[i].Close()
+		}
+		for b.Loop() {
+			b.StopTimer()
+			fill(func(key string, inHot bool) {
+				shard := 0
+				if !inHot {
+					shard = int(hasher(key) % shards)
+				}
+				caches[shard].Set(key, key, time.Nanosecond)
+			})
+			time.Sleep(time.Microsecond)
+			b.StartTimer()
+
+			var wg sync.WaitGroup
+			for _, c := range caches {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					c.Cleanup()
+				}()
+			}
+			wg.Wait()
+		}
+	})
+}
+
+// Has - один поиск в хранилище и сравнение момента устаревания с текущим временем.
+// Простой Get времени не читает (он отдает и устаревшие, еще не удаленные элементы), поэтому
+// без опций они стоят примерно одинаково; с отметками доступа или копированием Has заметно дешевле.
+func BenchmarkHasVersusGet(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		opts []candycache.Option
+	}{
+		{"plain", nil},
+		// Get обновляет счетчики и отметки доступа, а WithCopyOnGet еще и копирует данные.
+		{"access tracking", []candycache.Option{candycache.WithAccessTracking()}},
+		{"copy on get", []candycache.Option{candycache.WithCopyOnGet()}},
+	} {
+		c := candycache.Cacher(0, bb.opts...)
+		keys := make([]string, 1024)
+		for i := range keys {
+			keys[i] = "key" + strconv.Itoa(i)
+			c.Set(keys[i], map[string]int{"value": i}, time.Hour)
+		}
+
+		b.Run(bb.name+"/Has", func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				c.Has(keys[i%len(keys)])
+			}
+		})
+		b.Run(bb.name+"/Get", func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				c.Get(keys[i%len(keys)])
+			}
+		})
+		c.Close()
+	}
+}
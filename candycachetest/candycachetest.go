@@ -0,0 +1,66 @@
+// Пакет candycachetest содержит помощники для тестов кода, использующего candycache:
+// управляемые часы и детерминированное устаревание элементов без ожидания и фоновой очистки,
+// а также нагрузочный тест для подбора опций кэша (StressTest).
+package candycachetest
+
+import (
+	"sync"
+	"time"
+
+	"git.hikan.ru/serr/candycache"
+)
+
+// Часы, время которых идет только по команде (Advance, AdvanceClock).
+// Безопасны для одновременного использования.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Кэши, созданные с управляемыми часами (см. Clock.Option), -> их часы.
+var clocks sync.Map
+
+// Создает часы, показывающие время start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Вернет текущее время часов.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Переводит часы вперед на d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Опция, с которой кэш берет время из этих часов (как candycache.WithClock(c.Now)).
+// Только с ней к кэшу применим AdvanceClock. Кэш с такой опцией остается в памяти до конца
+// программы, поэтому опция предназначена только для тестов.
+func (c *Clock) Option() candycache.Option {
+	return func(cache *candycache.Cache) {
+		clocks.Store(cache, c)
+		candycache.WithClock(c.Now)(cache)
+	}
+}
+
+// Переводит часы кэша c вперед на d и синхронно выполняет очистку (Cache.Cleanup), так что
+// после возврата все устаревшие за это время элементы удалены, а обработчики удаления вызваны.
+// Работает только для кэша, созданного с управляемыми часами (Clock.Option), иначе паникует.
+// Часы общие для всех кэшей, созданных с ними, но очищается только c.
+func AdvanceClock(c *candycache.Cache, d time.Duration) {
+	clock, found := clocks.Load(c)
+	if !found {
+		panic("candycachetest: cache was not created with Clock.Option")
+	}
+
+	clock.(*Clock).Advance(d)
+	c.Cleanup()
+}
@@ -0,0 +1,212 @@
+package candycachetest
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"git.hikan.ru/serr/candycache"
+)
+
+// Параметры нагрузочного теста (см. StressTest).
+type StressConfig struct {
+	Readers  int           // Сколько горутин читают элементы (Get)
+	Writers  int           // Сколько горутин записывают элементы (Set)
+	Deleters int           // Сколько горутин удаляют элементы (Delete)
+	Duration time.Duration // Сколько длится тест (0 - одна секунда)
+	Keys     int           // Сколько разных ключей используется (0 - 1024)
+	TTL      time.Duration // Время жизни записываемых элементов
+	Prefix   string        // Префикс ключей теста (пусто - "stress:")
+}
+
+// Результат нагрузочного теста (см. StressTest).
+type StressResult struct {
+	Reads           uint64        // Сколько выполнено чтений
+	Writes          uint64        // Сколько выполнено записей
+	Deletes         uint64        // Сколько выполнено удалений
+	Elapsed         time.Duration // Сколько длился тест на самом деле
+	Throughput      float64       // Операций всех видов в секунду
+	HitRatio        float64       // Доля чтений, нашедших элемент
+	P99             time.Duration // 99-й процентиль длительности одной операции
+	Inconsistencies uint64        // Сколько чтений вернули данные, записанные не по этому ключу
+	Errors          uint64        // Сколько операций вернули ошибку, кроме ErrKeyNotFound
+}
+
+// Данные, которые записывает нагрузочный тест: по ним чтение проверяет, что получило свое.
+type stressValue struct {
+	Key string
+	Seq uint64
+}
+
+// Сколько длительностей операций запоминает каждая горутина теста для расчета процентиля.
+const stressSamples = 1 << 14
+
+// Нагружает кэш c одновременными чтениями, записями и удалениями случайных ключей в течение
+// cfg.Duration и возвращает производительность и найденные нарушения - например, чтобы подобрать
+// опции кэша под свою нагрузку. Тест пишет в c ключи с префиксом cfg.Prefix и не удаляет их
+// после завершения, поэтому лучше запускать его на отдельном кэше с боевыми опциями.
+// Длительность измеряется для каждой операции, а процентиль считается по равномерной
+// выборке из операций каждой горутины. Нарушение - это чтение, вернувшее данные, записанные
+// не по этому ключу. Гонки данных сам тест не видит: для этого запускайте его с -race.
+// Если ни одной горутины не задано, вернет пустой результат.
+func StressTest(c *candycache.Cache, cfg StressConfig) StressResult {
+	if cfg.Readers+cfg.Writers+cfg.Deleters <= 0 {
+		return StressResult{}
+	}
+
+	if cfg.Duration <= 0 {
+		cfg.Duration = time.Second
+	}
+	if cfg.Keys <= 0 {
+		cfg.Keys = 1024
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "stress:"
+	}
+
+	keys := make([]string, cfg.Keys)
+	for i := range keys {
+		keys[i] = cfg.Prefix + strconv.Itoa(i)
+	}
+
+	var (
+		mu      sync.Mutex
+		result  StressResult
+		hits    uint64
+		samples []time.Duration
+		wg      sync.WaitGroup
+	)
+
+	stop := make(chan struct{})
+	run := func(op func(w *stressWorker)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			w := &stressWorker{cache: c, keys: keys, ttl: cfg.TTL}
+			for {
+				select {
+				case <-stop:
+					mu.Lock()
+					result.Reads += w.reads
+					result.Writes += w.writes
+					result.Deletes += w.deletes
+					result.Inconsistencies += w.inconsistencies
+					result.Errors += w.errors
+					hits += w.hits
+					samples = append(samples, w.samples...)
+					mu.Unlock()
+					return
+				default:
+				}
+
+				start := time.Now()
+				op(w)
+				w.sample(time.Since(start))
+			}
+		}()
+	}
+
+	started := time.Now()
+	for range cfg.Readers {
+		run((*stressWorker).read)
+	}
+	for range cfg.Writers {
+		run((*stressWorker).write)
+	}
+	for range cfg.Deleters {
+		run((*stressWorker).delete)
+	}
+
+	time.Sleep(cfg.Duration)
+	close(stop)
+	wg.Wait()
+	result.Elapsed = time.Since(started)
+
+	ops := result.Reads + result.Writes + result.Deletes
+	result.Throughput = float64(ops) / result.Elapsed.Seconds()
+	if result.Reads > 0 {
+		result.HitRatio = float64(hits) / float64(result.Reads)
+	}
+
+	if len(samples) > 0 {
+		slices.Sort(samples)
+		result.P99 = samples[(99*len(samples)+99)/100-1]
+	}
+
+	return result
+}
+
+// Горутина нагрузочного теста и ее счетчики.
+type stressWorker struct {
+	cache           *candycache.Cache
+	keys            []string
+	ttl             time.Duration
+	seq             uint64
+	ops             uint64
+	reads           uint64
+	writes          uint64
+	deletes         uint64
+	hits            uint64
+	inconsistencies uint64
+	errors          uint64
+	samples         []time.Duration
+}
+
+// Вернет случайный ключ теста.
+func (w *stressWorker) key() string {
+	return w.keys[rand.IntN(len(w.keys))]
+}
+
+// Читает случайный ключ и проверяет, что данные записаны по нему.
+func (w *stressWorker) read() {
+	key := w.key()
+	w.reads++
+
+	data, err := w.cache.Get(key)
+	switch {
+	case errors.Is(err, candycache.ErrKeyNotFound):
+	case err != nil:
+		w.errors++
+	default:
+		w.hits++
+		if value, ok := data.(stressValue); !ok || value.Key != key {
+			w.inconsistencies++
+		}
+	}
+}
+
+// Записывает случайный ключ.
+func (w *stressWorker) write() {
+	key := w.key()
+	w.writes++
+	w.seq++
+
+	w.cache.Set(key, stressValue{Key: key, Seq: w.seq}, w.ttl)
+}
+
+// Удаляет случайный ключ.
+func (w *stressWorker) delete() {
+	w.deletes++
+
+	if err := w.cache.Delete(w.key()); err != nil && !errors.Is(err, candycache.ErrKeyNotFound) {
+		w.errors++
+	}
+}
+
+// Запоминает длительность операции d в выборке: первые stressSamples длительностей подряд,
+// дальше - с убывающей вероятностью, так что выборка остается равномерной (reservoir sampling).
+func (w *stressWorker) sample(d time.Duration) {
+	w.ops++
+	if len(w.samples) < stressSamples {
+		w.samples = append(w.samples, d)
+		return
+	}
+
+	if i := rand.Uint64N(w.ops); i < stressSamples {
+		w.samples[i] = d
+	}
+}
@@ -0,0 +1,179 @@
+package candycache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Ошибка, возвращаемая при добавлении элемента, если кэш заполнен (WithCapacity),
+// а вытеснить ради нового элемента нечего - все элементы защищены.
+var ErrCacheFull = errors.New("candycache: cache is full")
+
+// Ошибка, возвращаемая при добавлении элемента, если его данные больше WithMaxValueSize.
+// Оборачивается в ошибку с размером данных и ограничением.
+var ErrValueTooLarge = errors.New("candycache: value too large")
+
+// Ограничивает количество элементов в кэше.
+// Если при добавлении нового ключа кэш заполнен, из него вытесняется незащищенный элемент,
+// который устареет раньше всех (в первую очередь - уже устаревшие, а элементы, которые никогда
+// не устаревают, - в последнюю; порядок меняется через WithEvictionComparator). Замена элемента по существующему ключу места не требует.
+// Защищенные элементы (AddWithPriority) не вытесняются никогда и удаляются только по времени жизни
+// или явно. Если вытеснить нечего, Add, AddWithPriority, TryAdd, Append и Load вернут ErrCacheFull,
+// а Set, AddNegative, Fill и Tx.Set просто не добавят элемент.
+// Выбор вытесняемого элемента перебирает весь кэш, то есть работает за O(n)
+// (кроме вытеснения в порядке добавления, см. WithFIFOEviction).
+func WithCapacity(capacity int) Option {
+	return func(c *Cache) {
+		c.capacity = capacity
+	}
+}
+
+// Ограничивает размер данных одного элемента: данные больше size байт (размер считается
+// так же, как в Size) в кэш не записываются. Add, AddWithPriority, TryAdd, Append и Load
+// вернут ошибку, обернутую в ErrValueTooLarge, а Set, AddNegative, Fill и Tx.Set просто
+// не добавят элемент; прежний элемент по ключу при этом остается. Размер считается при каждой
+// записи обходом данных, а данные с циклами через срезы, карты и интерфейсы посчитать нельзя
+// (см. WithValidateOnAdd). Если size <= 0, размер не ограничен (по умолчанию).
+func WithMaxValueSize(size int) Option {
+	return func(c *Cache) {
+		c.maxValueSize = size
+	}
+}
+
+// Проверяет размер данных data по WithMaxValueSize. Без блокировки.
+func (c *Cache) checkValueSize(data interface{}) error {
+	if c.maxValueSize <= 0 {
+		return nil
+	}
+
+	if size := isize(data); size > c.maxValueSize {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrValueTooLarge, size, c.maxValueSize)
+	}
+
+	return nil
+}
+
+// Если кэш, ограниченный WithCapacity, заполнен, перед вытеснением удаляет из него
+// все устаревшие элементы, в том числе защищенные. Удаленные так элементы считаются
+// устаревшими (Stats.Expired), а не вытесненными, и живые элементы вытесняются, только
+// если устаревших не осталось.
+// По умолчанию устаревшие, но еще не удаленные очисткой элементы занимают место в кэше:
+// они вытесняются первыми, но защищенные из них не вытесняются до очистки.
+func WithSweepOnFull() Option {
+	return func(c *Cache) {
+		c.sweepOnFull = true
+	}
+}
+
+// Добавление элемента в кэш, только если по ключу key нет неустаревшего элемента, как в Add.
+// Если protected == true, элемент защищен от вытеснения ради ограничений размера кэша
+// (WithCapacity, WithSoftByteTarget) и удаляется только по истечении времени жизни или явно.
+// Если элемент уже есть, вернет ErrKeyExists, если места нет - ErrCacheFull.
+// Замена элемента через Set снимает с него защиту.
+func (c *Cache) AddWithPriority(key string, data interface{}, ttl time.Duration, protected bool) error {
+	c.Lock()
+	defer c.unlock()
+
+	if item, found := c.storage.Get(key); found && !item.expired(c.now()) {
+		return ErrKeyExists
+	}
+
+	item := c.newItem(data, ttl)
+	item.protected = protected
+
+	return c.store(key, item)
+}
+
+// Освобождает место для нового элемента с ключом key, если кэш заполнен. Без блокировки.
+// Если освободить место нельзя, вернет ErrCacheFull.
+func (c *Cache) admit(key string) error {
+	if c.capacity <= 0 {
+		return nil
+	}
+
+	if _, found := c.storage.Get(key); found {
+		return nil
+	}
+
+	if c.sweepOnFull && c.storage.Len() >= c.capacity {
+		c.sweep()
+	}
+
+	for c.storage.Len() >= c.capacity {
+		if !c.evictOne() {
+			return ErrCacheFull
+		}
+	}
+
+	return nil
+}
+
+// Удаляет все устаревшие элементы. Без блокировки.
+func (c *Cache) sweep() {
+	now := c.now()
+	expired := []KeyItemPair{}
+	for key, item := range c.storage.Range {
+		if item.expired(now) {
+			expired = append(expired, KeyItemPair{Key: key, Item: item})
+		}
+	}
+
+	c.stats.expired.Add(uint64(c.removeExpired(expired, ageLimits{})))
+}
+
+// Вытесняет один незащищенный элемент, первый по порядку вытеснения
+// (по умолчанию - тот, что устареет раньше всех, см. WithEvictionComparator). Без блокировки.
+// Вернет был ли вытеснен элемент.
+func (c *Cache) evictOne() bool {
+	victim, found := c.victim()
+	if !found {
+		return false
+	}
+
+	c.remove(victim.Key, victim.Item, EvictEvicted)
+	c.stats.evicted.Add(1)
+
+	return true
+}
+
+// Выбирает незащищенный элемент, который нужно вытеснить первым. Без блокировки.
+// С WithFairNamespaceEviction берет его из самого большого пространства имен,
+// с WithFIFOEviction - из начала порядка добавления, иначе перебирает весь кэш.
+func (c *Cache) victim() (EvictionCandidate, bool) {
+	if c.fairNamespaces && len(c.namespaces) > 0 {
+		return c.fairVictim()
+	}
+
+	if c.fifo {
+		return c.oldestUnprotected()
+	}
+
+	var victim EvictionCandidate
+	found := false
+
+	now := c.now()
+	for key, item := range c.storage.Range {
+		if item.protected {
+			continue
+		}
+
+		candidate := c.candidate(key, item, -1, now)
+		if !found || c.evictsFirst(candidate, victim) {
+			victim = candidate
+			found = true
+		}
+	}
+
+	return victim, found
+}
+
+// Определяет должен ли элемент a вытесняться раньше элемента b:
+// раньше вытесняется тот, что раньше устареет, а элементы, которые никогда не устаревают, - последними.
+func evictsBefore(a, b Item) bool {
+	if a.destroyTimestamp == 0 {
+		return false
+	}
+
+	return b.destroyTimestamp == 0 || a.destroyTimestamp < b.destroyTimestamp
+}
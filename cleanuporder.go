@@ -0,0 +1,84 @@
+package candycache
+
+import (
+	"slices"
+	"strings"
+)
+
+// Порядок, в котором очистка удаляет устаревшие элементы (см. WithCleanupOrder).
+type CleanupOrder int
+
+const (
+	// Элементы, устаревшие в один и тот же момент, удаляются по возрастанию ключа (по умолчанию).
+	CleanupByKey CleanupOrder = iota
+	// Элементы, устаревшие в один и тот же момент, удаляются в порядке добавления (см. WithInsertionOrder).
+	CleanupByInsertion
+)
+
+// Задает порядок, в котором очистка (Cleanup, автоматическая очистка и WithSweepOnFull) удаляет
+// устаревшие элементы и, значит, вызывает для них обработчики удаления. Элементы всегда удаляются
+// от устаревшего раньше всех к устаревшему позже всех (с WithMaxAge и WithEvictAfterIdle - по тому,
+// что наступит раньше: момент устаревания, предельный возраст или предельное время без обращений),
+// а order определяет порядок элементов с одинаковым моментом - например, добавленных одним AddMany. По умолчанию это CleanupByKey, поэтому очистка
+// детерминирована и не зависит от случайного порядка перебора карты.
+// CleanupByInsertion включает WithInsertionOrder (со всеми ее расходами памяти).
+// Упорядочивание сортирует только устаревшие элементы, то есть стоит O(k log k) для k удаляемых.
+func WithCleanupOrder(order CleanupOrder) Option {
+	return func(c *Cache) {
+		c.cleanupOrder = order
+		if order == CleanupByInsertion && c.order == nil {
+			WithInsertionOrder()(c)
+		}
+	}
+}
+
+// Удаляет устаревшие элементы expired в порядке очистки (см. WithCleanupOrder) с причиной
+// EvictExpired, кроме продленных WithExpiryRetention. limits - ограничения WithMaxAge
+// и WithEvictAfterIdle, по которым элементы отбирались. Вернет сколько элементов удалено. Без блокировки.
+func (c *Cache) removeExpired(expired []KeyItemPair, limits ageLimits) int {
+	slices.SortFunc(expired, func(a, b KeyItemPair) int {
+		if da, db := expiryMoment(a.Item, limits), expiryMoment(b.Item, limits); da != db {
+			if da < db {
+				return -1
+			}
+			return 1
+		}
+
+		if c.cleanupOrder == CleanupByInsertion && c.order != nil {
+			switch {
+			case c.order.before(a.Key, b.Key):
+				return -1
+			case c.order.before(b.Key, a.Key):
+				return 1
+			}
+		}
+
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	now := c.now()
+	removed := 0
+	for _, pair := range expired {
+		if c.retained(pair.Key, pair.Item, now, limits) {
+			continue
+		}
+
+		c.remove(pair.Key, pair.Item, EvictExpired)
+		removed++
+	}
+
+	return removed
+}
+
+// Момент, когда элемент устарел: момент устаревания или, если с ограничениями limits он
+// наступает раньше, момент достижения предельного возраста или предельного времени без обращений.
+func expiryMoment(item Item, limits ageLimits) int64 {
+	moment := item.destroyTimestamp
+	for _, limit := range []int64{limits.agedAt(&item), limits.idledAt(&item)} {
+		if limit != 0 && (moment == 0 || limit < moment) {
+			moment = limit
+		}
+	}
+
+	return moment
+}
@@ -0,0 +1,21 @@
+package candycache
+
+import "time"
+
+// Задает источник текущего времени (по умолчанию time.Now), например, чтобы управлять временем в тестах.
+// Кэш запоминает время при создании и дальше отсчитывает его как разницу между показаниями now,
+// поэтому для time.Now время течет по монотонным часам и не скачет при переводе системных часов.
+func WithClock(now func() time.Time) Option {
+	return func(c *Cache) {
+		c.clock = now
+	}
+}
+
+// Вернет текущий момент в Unix-наносекундах по часам кэша.
+// Момент отсчитывается от времени создания кэша через Time.Sub, который для показаний time.Now
+// использует монотонные часы: если системные часы переведут назад (NTP, пауза виртуальной машины),
+// элементы не "оживут" и не устареют раньше срока. За это время кэша может разойтись
+// с системным на величину перевода, пока кэш не будет создан заново.
+func (c *Cache) now() int64 {
+	return c.baseUnix + int64(c.clock().Sub(c.base))
+}
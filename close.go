@@ -0,0 +1,35 @@
+package candycache
+
+import "errors"
+
+// Ошибка, возвращаемая при попытке записи в закрытый кэш (см. Close).
+var ErrClosed = errors.New("candycache: cache is closed")
+
+// Закрывает кэш: останавливает автоматическую очистку и запрещает запись.
+// После Close:
+// - Get, Has, Keys, List и остальные методы чтения работают как раньше;
+// - Delete, DeletePrefix, Flush, Drain, Cleanup и другие удаления работают как раньше;
+// - Add, AddWithPriority, AddOpts, TryAdd, Append, Load, Namespace.Add и декодирование gob
+// возвращают ErrClosed, а UpdateIfVersion - false;
+// - Set, AddNegative, Fill, ReplaceAll, Update, Tx.Set и Namespace.Set ничего не делают;
+// - продление существующих элементов (GetExtend, GetRefresh, TouchMany, Expire) работает как раньше;
+// - SetCleanupInterval меняет интервал, но очистку не запускает.
+// Повторный вызов ничего не делает.
+func (c *Cache) Close() {
+	c.gcMu.Lock()
+	defer c.gcMu.Unlock()
+
+	c.Lock()
+	c.closed = true
+	c.Unlock()
+
+	c.stopGC()
+}
+
+// Определяет закрыт ли кэш.
+func (c *Cache) IsClosed() bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.closed
+}
@@ -0,0 +1,87 @@
+package candycache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+)
+
+// Формат, в котором Save, SaveKeys и SaveRelative записывают дамп, а Load читает его (см. WithCodec).
+// Marshal получает []Dump со всеми сохраняемыми элементами, Unmarshal - указатель на []Dump.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Кодек encoding/gob. Данные элементов восстанавливаются с исходными типами, но конкретные типы,
+// хранящиеся в interface{}, должны быть зарегистрированы через gob.Register и при сохранении,
+// и при загрузке.
+var GobCodec Codec = gobCodec{}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// Задает формат дампов Save, SaveKeys, SaveRelative и Load - например, GobCodec или обертку
+// над msgpack или protobuf, чтобы дамп был меньше и кодировался быстрее, без зависимости
+// пакета от сторонних библиотек. Без опции дамп - это JSON, который пишется и читается
+// по одному элементу. С кодеком все сохраняемые элементы собираются в один []Dump и кодируются
+// за один вызов Marshal, а Load читает дамп целиком и декодирует его за один вызов Unmarshal,
+// поэтому дамп целиком держится в памяти. Дамп, записанный с одним кодеком, читается только им.
+// Как восстанавливаются типы данных, зависит от кодека: JSON возвращает map[string]interface{},
+// float64 и т.д., GobCodec - исходные типы, если они зарегистрированы.
+// WriteJSONL, ReadJSONL и кодирование кэша через gob от опции не зависят.
+func WithCodec(codec Codec) Option {
+	return func(c *Cache) {
+		c.codec = codec
+	}
+}
+
+// Сохраняет элементы items в формате кодека. Без блокировки.
+func (c *Cache) saveCodec(w io.Writer, items func(fn func(key string, item Item) bool), relative bool, now int64) error {
+	entries := []Dump{}
+	for key, item := range items {
+		entries = append(entries, dumpEntry(key, item, relative, now))
+	}
+
+	data, err := c.codec.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// Загружает дамп в формате кодека. Дамп читается и декодируется до блокировки кэша.
+func (c *Cache) loadCodec(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	entries := []Dump{}
+	if err := c.codec.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.unlock()
+
+	now := c.now()
+	for _, entry := range entries {
+		if err := c.loadEntry(entry, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
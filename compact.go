@@ -0,0 +1,46 @@
+package candycache
+
+// Включает уплотнение хранилища после каждой очистки. Карта в Go не отдает память после
+// удаления элементов, поэтому кэш, который то разрастается, то опустошается, со временем
+// занимает столько памяти, сколько нужно было в пике. С этой опцией, если после очистки
+// элементов в кэше меньше чем minLoadFactor от наибольшего их количества с прошлого уплотнения,
+// хранилище пересобирается в новую карту подходящего размера, а старая отпускается.
+// Пересборка копирует все элементы под блокировкой на запись. Свое хранилище (WithStore)
+// не уплотняется. Если minLoadFactor <= 0, опция ничего не делает.
+func WithAutoCompact(minLoadFactor float64) Option {
+	return func(c *Cache) {
+		c.minLoadFactor = minLoadFactor
+	}
+}
+
+// Возвращает сколько раз хранилище было уплотнено (см. WithAutoCompact).
+func (c *Cache) Compactions() uint64 {
+	return c.stats.compactions.Load()
+}
+
+// Уплотняет хранилище, если элементов в нем стало слишком мало по сравнению с пиком.
+// Вернет было ли хранилище уплотнено.
+func (c *Cache) compact() bool {
+	if c.minLoadFactor <= 0 {
+		return false
+	}
+
+	c.Lock()
+	defer c.unlock()
+
+	storage, ok := c.storage.(mapStore)
+	if !ok || c.peak == 0 || float64(len(storage))/float64(c.peak) >= c.minLoadFactor {
+		return false
+	}
+
+	compacted := make(mapStore, len(storage))
+	for key, item := range storage {
+		compacted[key] = item
+	}
+
+	c.storage = compacted
+	c.peak = len(compacted)
+	c.stats.compactions.Add(1)
+
+	return true
+}
@@ -0,0 +1,55 @@
+package candycache
+
+import (
+	"sync"
+	"time"
+)
+
+// Интервал очистки кэша по умолчанию (DefaultCache).
+const DefaultCleanupInterval = time.Minute
+
+// Кэш по умолчанию, которым пользуются функции пакета Get, Set, Add, Has и Delete,
+// по аналогии с http.DefaultServeMux. Он очищается каждые DefaultCleanupInterval, причем
+// автоматическая очистка запускается при первом вызове функции пакета, а не при импорте,
+// и дальше работает, пока работает программа (или пока кэш не закрыт через Close).
+// Переменную можно заменить своим кэшем, но только до первого вызова функций пакета
+// и не одновременно с ними.
+var DefaultCache = newCache(DefaultCleanupInterval)
+
+// Запускает автоматическую очистку DefaultCache один раз.
+var startDefault = sync.OnceFunc(func() {
+	DefaultCache.start()
+})
+
+// Вернет DefaultCache, запустив его очистку, если она еще не запущена.
+func defaultCache() *Cache {
+	startDefault()
+
+	return DefaultCache
+}
+
+// Получение элемента из кэша по умолчанию (см. Cache.Get).
+func Get(key string) (interface{}, error) {
+	return defaultCache().Get(key)
+}
+
+// Добавление элемента в кэш по умолчанию (см. Cache.Set).
+// Если ttl <= 0, элемент никогда не устаревает.
+func Set(key string, data interface{}, ttl time.Duration) {
+	defaultCache().Set(key, data, ttl)
+}
+
+// Добавление элемента в кэш по умолчанию, только если по ключу key нет неустаревшего элемента (см. Cache.Add).
+func Add(key string, data interface{}, ttl time.Duration) error {
+	return defaultCache().Add(key, data, ttl)
+}
+
+// Определяет есть ли в кэше по умолчанию неустаревший элемент с ключом key.
+func Has(key string) bool {
+	return defaultCache().Has(key)
+}
+
+// Удаление элемента из кэша по умолчанию по ключу.
+func Delete(key string) error {
+	return defaultCache().Delete(key)
+}
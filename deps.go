@@ -0,0 +1,92 @@
+package candycache
+
+import "time"
+
+// Добавление элемента, зависящего от элементов с ключами dependsOn, только если по ключу key
+// нет неустаревшего элемента, как в Add. Если элемент уже есть, вернет ErrKeyExists,
+// если места нет - ErrCacheFull.
+// Когда элемент, от которого зависят другие, удаляется (Delete, очистка, вытеснение, Flush и т.д.),
+// сразу за ним удаляются и все зависимые элементы, затем зависимые от них и так далее, в глубину.
+// Обработчик удаления (WithOnEvicted) вызывается для них в том же порядке.
+// Expire так же делает устаревшими все зависимые элементы.
+// Замена элемента через Set или Add не считается удалением и зависимые элементы не затрагивает,
+// а замена самого зависимого элемента снимает его зависимости.
+// Циклы допустимы: каждый элемент цикла удаляется один раз, после чего каскад останавливается.
+// Ключи в dependsOn могут отсутствовать в кэше - зависимость сработает, когда элемент
+// с таким ключом будет добавлен и затем удален.
+func (c *Cache) AddWithDeps(key string, data interface{}, ttl time.Duration, dependsOn ...string) error {
+	c.Lock()
+	defer c.unlock()
+
+	if item, found := c.storage.Get(key); found && !item.expired(c.now()) {
+		return ErrKeyExists
+	}
+
+	item := c.newItem(data, ttl)
+	item.dependsOn = dependsOn
+
+	return c.store(key, item)
+}
+
+// Возвращает ключи элементов, от которых зависит элемент (см. AddWithDeps).
+func (i *Item) DependsOn() []string {
+	return i.dependsOn
+}
+
+// Запоминает, что элемент key зависит от элементов dependsOn. Без блокировки.
+func (c *Cache) link(key string, dependsOn []string) {
+	if len(dependsOn) == 0 {
+		return
+	}
+
+	if c.dependents == nil {
+		c.dependents = make(map[string]map[string]struct{})
+	}
+
+	for _, base := range dependsOn {
+		dependents, found := c.dependents[base]
+		if !found {
+			dependents = make(map[string]struct{})
+			c.dependents[base] = dependents
+		}
+		dependents[key] = struct{}{}
+	}
+}
+
+// Забывает зависимости элемента key от элементов dependsOn. Без блокировки.
+func (c *Cache) unlink(key string, dependsOn []string) {
+	for _, base := range dependsOn {
+		dependents := c.dependents[base]
+		delete(dependents, key)
+		if len(dependents) == 0 {
+			delete(c.dependents, base)
+		}
+	}
+}
+
+// Удаляет элементы, зависящие от уже удаленного элемента key, с той же причиной reason. Без блокировки.
+func (c *Cache) removeDependents(key string, reason EvictReason) {
+	dependents := c.dependents[key]
+	delete(c.dependents, key)
+
+	for dependent := range dependents {
+		if item, found := c.storage.Get(dependent); found {
+			c.remove(dependent, item, reason)
+		}
+	}
+}
+
+// Делает устаревшими элементы, зависящие от элемента key. Без блокировки.
+// Уже устаревшие элементы пропускаются, поэтому каскад по циклу останавливается.
+func (c *Cache) expireDependents(key string, now int64) {
+	for dependent := range c.dependents[key] {
+		item, found := c.storage.Get(dependent)
+		if !found || item.expired(now) {
+			continue
+		}
+
+		item.destroyTimestamp = now - 1
+		c.put(dependent, item)
+		c.expireDependents(dependent, now)
+	}
+}
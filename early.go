@@ -0,0 +1,34 @@
+package candycache
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// Включает вероятностное досрочное устаревание (алгоритм XFetch): незадолго до устаревания
+// Get (а также TryGet, Tx.Get и LoadingCache.Get) иногда возвращает ErrKeyNotFound, хотя
+// элемент еще есть в кэше, чтобы вызвавший пересчитал и записал значение заранее.
+// Элемент считается устаревшим, если now - cost·beta·ln(rand) >= момента устаревания, где cost -
+// стоимость элемента (WithItemCost) в наносекундах, то есть сколько занимает его пересчет,
+// а rand - случайное число из (0, 1]. Чем ближе момент устаревания и чем дороже пересчет,
+// тем вероятнее досрочный промах, но обычно промах достается одному из читающих, а остальные
+// продолжают получать закэшированное значение, и пересчеты не происходят одновременно.
+// beta > 1 делает досрочные промахи чаще, beta < 1 - реже; если beta <= 0, досрочного
+// устаревания нет (по умолчанию). Элементы без стоимости, без времени жизни и замороженные
+// досрочно не устаревают. Сам элемент из кэша не удаляется.
+func WithEarlyExpiration(beta float64) Option {
+	return func(c *Cache) {
+		c.earlyBeta = max(beta, 0)
+	}
+}
+
+// Определяет нужно ли считать элемент досрочно устаревшим по XFetch (см. WithEarlyExpiration).
+func (c *Cache) expiresEarly(item Item) bool {
+	if c.earlyBeta <= 0 || item.cost <= 0 || item.destroyTimestamp == 0 || item.frozen {
+		return false
+	}
+
+	gap := -float64(item.cost) * c.earlyBeta * math.Log(1-rand.Float64())
+
+	return float64(c.now())+gap >= float64(item.destroyTimestamp)
+}
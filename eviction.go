@@ -0,0 +1,210 @@
+package candycache
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Кандидат на вытеснение, которого сравнивает функция WithEvictionComparator.
+type EvictionCandidate struct {
+	Key        string        // Ключ элемента
+	Item       Item          // Сам элемент: Cost, Hits, Tags, DestroyTimestamp, CreatedAt и т.д.
+	Priority   int64         // Приоритет элемента - его стоимость (WithItemCost): чем выше, тем дороже его вытеснить
+	LastAccess time.Time     // Последнее обращение (WithAccessTracking), а если его не было или обращения не отслеживаются - добавление
+	Size       int           // Размер элемента вместе с ключом в байтах, как в Size
+	Age        time.Duration // Сколько времени прошло с добавления элемента
+}
+
+// Задает порядок вытеснения элементов, когда кэш упирается в WithCapacity или WithSoftByteTarget
+// (и в квоту Namespace): less(a, b) == true означает, что a вытесняется раньше b.
+// less должна задавать строгий слабый порядок (как для sort.Slice): быть иррефлексивной,
+// транзитивной и согласованной, иначе порядок вытеснения будет непредсказуемым.
+// Защищенные элементы (AddWithPriority) не вытесняются при любом порядке.
+// Защищенные элементы в кандидаты не попадают, поэтому Priority - это стоимость, а не защита.
+// Готовые порядки: EvictByExpiry (по умолчанию), EvictByLRU, EvictByHits (LFU) и EvictByAge.
+// С заданным порядком размер каждого кандидата считается при каждом вытеснении, а не только
+// при ужимании до WithSoftByteTarget, поэтому вытеснение ради WithCapacity становится дороже.
+func WithEvictionComparator(less func(a, b EvictionCandidate) bool) Option {
+	return func(c *Cache) {
+		c.evictionLess = less
+	}
+}
+
+// Порядок вытеснения для WithEvictionPolicy.
+type EvictionPolicy int
+
+const (
+	PolicyExpiry EvictionPolicy = iota // Раньше вытесняется тот, что раньше устареет (по умолчанию, EvictByExpiry)
+	PolicyLRU                          // Тот, к которому дольше всех не обращались (EvictByLRU с WithAccessTracking)
+	PolicyLFU                          // Тот, в который меньше всего попаданий (EvictByHits)
+	PolicyFIFO                         // Тот, что добавлен раньше всех, независимо от чтений (WithFIFOEviction)
+)
+
+// Задает порядок вытеснения одной из готовых политик - короткая запись для WithEvictionComparator
+// с готовым порядком и WithFIFOEviction. Политика заменяет заданные до нее порядок и FIFO, а опции
+// после нее - ее саму. PolicyLRU включает WithAccessTracking, PolicyFIFO - WithInsertionOrder.
+// С PolicyFIFO чтение порядок не меняет, а с PolicyLRU каждое попадание отодвигает элемент в конец.
+func WithEvictionPolicy(policy EvictionPolicy) Option {
+	return func(c *Cache) {
+		c.fifo = false
+		c.evictionLess = nil
+
+		switch policy {
+		case PolicyLRU:
+			WithAccessTracking()(c)
+			c.evictionLess = EvictByLRU
+		case PolicyLFU:
+			c.evictionLess = EvictByHits
+		case PolicyFIFO:
+			WithFIFOEviction()(c)
+		}
+	}
+}
+
+// Порядок вытеснения по умолчанию: раньше вытесняется тот, что раньше устареет,
+// а элементы, которые никогда не устаревают, - последними.
+func EvictByExpiry(a, b EvictionCandidate) bool {
+	return evictsBefore(a.Item, b.Item)
+}
+
+// Раньше вытесняется элемент, к которому дольше всех не обращались (LRU), при равенстве -
+// тот, что раньше устареет. Обращения отслеживаются только с WithAccessTracking (или
+// WithEvictAfterIdle): без них LastAccess - момент добавления, и порядок совпадает с EvictByAge.
+func EvictByLRU(a, b EvictionCandidate) bool {
+	if !a.LastAccess.Equal(b.LastAccess) {
+		return a.LastAccess.Before(b.LastAccess)
+	}
+
+	return evictsBefore(a.Item, b.Item)
+}
+
+// Раньше вытесняется элемент с меньшим количеством попаданий (Item.Hits) - LFU,
+// при равенстве - тот, что раньше устареет.
+func EvictByHits(a, b EvictionCandidate) bool {
+	ah, bh := a.Item.Hits(), b.Item.Hits()
+	if ah != bh {
+		return ah < bh
+	}
+
+	return evictsBefore(a.Item, b.Item)
+}
+
+// Раньше вытесняется элемент, добавленный раньше.
+func EvictByAge(a, b EvictionCandidate) bool {
+	return a.Age > b.Age
+}
+
+// Собирает кандидата на вытеснение. size < 0 означает, что размер еще не посчитан:
+// он считается, только если задан свой порядок вытеснения.
+func (c *Cache) candidate(key string, item Item, size int, now int64) EvictionCandidate {
+	if size < 0 {
+		size = 0
+		if c.evictionLess != nil {
+			size = itemSize(key, item)
+		}
+	}
+
+	return EvictionCandidate{
+		Key:        key,
+		Item:       item,
+		Priority:   item.cost,
+		LastAccess: time.Unix(0, item.idleSince()),
+		Size:       size,
+		Age:        time.Duration(now - item.createdAt),
+	}
+}
+
+// Вытесняет примерно долю fraction (от 0 до 1) элементов кэша и вернет сколько элементов
+// вытеснено - например, из обработчика нехватки памяти, чтобы быстро сбросить нагрузку.
+// Вытесняется округленная вверх доля fraction от всех элементов, устаревших и нет, но
+// защищенные элементы (AddWithPriority) не вытесняются никогда, поэтому их может быть меньше.
+// Элементы выбираются по порядку вытеснения кэша: с WithFIFOEviction - добавленные раньше всех,
+// с WithEvictionComparator - по нему, иначе с WithAccessTracking (или WithEvictAfterIdle) -
+// те, к которым дольше всех не обращались, а без него - те, что устареют раньше всех
+// (элементы без времени жизни - последними, между собой - в произвольном порядке).
+// WithFairNamespaceEviction не учитывается. Для вытесненных элементов вызываются обработчики
+// удаления с причиной EvictEvicted, и они учитываются в Stats().Evicted.
+// Кандидаты собираются под блокировкой на чтение и упорядочиваются вне блокировки, а удаляются
+// пачками по flushBatchSize, каждая - под своей короткой блокировкой на запись. Элемент, который
+// за это время заменили или удалили, пропускается, поэтому вытеснено может быть меньше.
+func (c *Cache) Evict(fraction float64) int {
+	if !(fraction > 0) {
+		return 0
+	}
+	fraction = min(fraction, 1)
+
+	c.RLock()
+	now := c.now()
+	want := int(math.Ceil(fraction * float64(c.storage.Len())))
+	candidates := make([]EvictionCandidate, 0, c.storage.Len())
+	if c.fifo {
+		for element := c.order.keys.Front(); element != nil; element = element.Next() {
+			key := element.Value.(orderedKey).key
+			if item, found := c.storage.Get(key); found && !item.protected {
+				candidates = append(candidates, c.candidate(key, item, -1, now))
+			}
+		}
+	} else {
+		for key, item := range c.storage.Range {
+			if !item.protected {
+				candidates = append(candidates, c.candidate(key, item, -1, now))
+			}
+		}
+	}
+	c.RUnlock()
+
+	if !c.fifo {
+		sort.Slice(candidates, func(i, j int) bool {
+			return c.shedsFirst(candidates[i], candidates[j])
+		})
+	}
+	candidates = candidates[:min(want, len(candidates))]
+
+	evicted := 0
+	for len(candidates) > 0 {
+		batch := candidates[:min(flushBatchSize, len(candidates))]
+		candidates = candidates[len(batch):]
+
+		c.Lock()
+		c.unlockIfSealed()
+		for _, candidate := range batch {
+			// Пока блокировка была отпущена, элемент могли заменить или удалить.
+			if item, found := c.storage.Get(candidate.Key); found && item.version == candidate.Item.version {
+				c.remove(candidate.Key, item, EvictEvicted)
+				evicted++
+			}
+		}
+		c.unlock()
+	}
+
+	c.stats.evicted.Add(uint64(evicted))
+
+	return evicted
+}
+
+// Определяет должен ли Evict вытеснить кандидата a раньше кандидата b: без своего порядка
+// вытеснения и с отслеживанием обращений раньше вытесняется тот, к которому дольше не обращались.
+// С WithFIFOEviction не вызывается: кандидаты уже собраны в порядке добавления.
+func (c *Cache) shedsFirst(a, b EvictionCandidate) bool {
+	if c.evictionLess == nil && c.accessTracking {
+		if ai, bi := a.Item.idleSince(), b.Item.idleSince(); ai != bi {
+			return ai < bi
+		}
+	}
+
+	return c.evictsFirst(a, b)
+}
+
+// Определяет должен ли кандидат a вытесняться раньше кандидата b по порядку кэша.
+func (c *Cache) evictsFirst(a, b EvictionCandidate) bool {
+	if c.fifo {
+		return c.order.before(a.Key, b.Key)
+	}
+
+	if c.evictionLess != nil {
+		return c.evictionLess(a, b)
+	}
+
+	return EvictByExpiry(a, b)
+}
@@ -0,0 +1,34 @@
+package candycache
+
+import "expvar"
+
+// Публикует состояние кэша в expvar под именем name (то есть и в /debug/vars, если он подключен):
+// количество элементов, размер в байтах (как Size) и статистику (как Stats) в виде объекта JSON
+// с полями count, size, hits, misses, hit_ratio, expired, evicted, reclaimed_bytes и waiters.
+// Значения читаются заново при каждом обращении к переменной: размер - под блокировкой
+// на чтение, количество и статистика - под блокировкой на запись, поэтому они согласованы
+// между собой. Подсчет размера перебирает весь кэш, то есть работает за O(n).
+// Как и expvar.Publish, паникует, если переменная с таким именем уже опубликована, -
+// для нескольких кэшей выбирайте разные имена.
+func (c *Cache) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		size := c.Size()
+
+		c.Lock()
+		count := c.storage.Len()
+		stats := c.readStats()
+		c.Unlock()
+
+		return map[string]interface{}{
+			"count":           count,
+			"size":            size,
+			"hits":            stats.Hits,
+			"misses":          stats.Misses,
+			"hit_ratio":       stats.HitRatio(),
+			"expired":         stats.Expired,
+			"evicted":         stats.Evicted,
+			"reclaimed_bytes": stats.ReclaimedBytes,
+			"waiters":         stats.Waiters,
+		}
+	}))
+}
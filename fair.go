@@ -0,0 +1,96 @@
+package candycache
+
+import (
+	"slices"
+	"strings"
+)
+
+// Включает справедливое вытеснение между пространствами имен (Namespace), когда кэш упирается
+// в WithCapacity: вытесняется элемент из пространства, в котором сейчас больше всего элементов,
+// а внутри него - первый по порядку вытеснения кэша (WithEvictionComparator, WithFIFOEviction).
+// Так один шумный арендатор вытесняет сам себя, а не элементы остальных.
+// Алгоритм: при каждом вытеснении элементы кэша перебираются и группируются по самому длинному
+// подходящему префиксу среди пространств, созданных через Namespace, - ключи вне пространств
+// составляют отдельную группу "". Из групп, в которых есть незащищенные элементы, выбирается
+// самая большая (при равенстве - с меньшим префиксом), и из нее вытесняется один элемент.
+// Подсчет перебирает весь кэш, поэтому вытеснение работает за O(n). Пока не создано ни одного
+// пространства, опция ничего не меняет. Квоты самих пространств действуют как раньше.
+func WithFairNamespaceEviction() Option {
+	return func(c *Cache) {
+		c.fairNamespaces = true
+	}
+}
+
+// Запоминает префикс пространства имен. Под блокировкой.
+func (c *Cache) registerNamespace(prefix string) {
+	if slices.Contains(c.namespaces, prefix) {
+		return
+	}
+
+	c.namespaces = append(c.namespaces, prefix)
+
+	// Самые длинные префиксы - первыми, чтобы namespaceOf находила самое точное пространство.
+	slices.SortStableFunc(c.namespaces, func(a, b string) int {
+		return len(b) - len(a)
+	})
+}
+
+// Вернет префикс пространства имен, к которому относится ключ key ("" - ни к какому).
+func (c *Cache) namespaceOf(key string) string {
+	for _, prefix := range c.namespaces {
+		if strings.HasPrefix(key, prefix) {
+			return prefix
+		}
+	}
+
+	return ""
+}
+
+// Возвращает сколько элементов (включая устаревшие, но еще не удаленные очисткой) занимает
+// каждое пространство имен, созданное через Namespace, по его префиксу. Ключи вне пространств
+// учитываются под префиксом "", если такие есть. Ключ относится к пространству с самым длинным
+// подходящим префиксом, как при WithFairNamespaceEviction. Перебирает весь кэш.
+func (c *Cache) NamespaceUsage() map[string]int {
+	c.RLock()
+	defer c.RUnlock()
+
+	usage := make(map[string]int, len(c.namespaces)+1)
+	for _, prefix := range c.namespaces {
+		usage[prefix] = 0
+	}
+
+	for key := range c.storage.Range {
+		usage[c.namespaceOf(key)]++
+	}
+
+	return usage
+}
+
+// Выбирает элемент для вытеснения из самого большого пространства имен. Без блокировки.
+func (c *Cache) fairVictim() (EvictionCandidate, bool) {
+	counts := make(map[string]int, len(c.namespaces)+1)
+	victims := make(map[string]EvictionCandidate, len(c.namespaces)+1)
+
+	now := c.now()
+	for key, item := range c.storage.Range {
+		prefix := c.namespaceOf(key)
+		counts[prefix]++
+		if item.protected {
+			continue
+		}
+
+		candidate := c.candidate(key, item, -1, now)
+		if victim, found := victims[prefix]; !found || c.evictsFirst(candidate, victim) {
+			victims[prefix] = candidate
+		}
+	}
+
+	largest, found := "", false
+	for prefix := range victims {
+		if !found || counts[prefix] > counts[largest] || (counts[prefix] == counts[largest] && prefix < largest) {
+			largest, found = prefix, true
+		}
+	}
+
+	return victims[largest], found
+}
@@ -0,0 +1,88 @@
+package candycache
+
+import "time"
+
+// Задает следующий уровень кэша: при промахе Get (и GetOrLoad до вызова загрузчика) ищет элемент
+// в next, а найденный там элемент поднимает в этот кэш и возвращает. next может сам иметь
+// следующий уровень, поэтому из нескольких кэшей строится цепочка L1 -> L2 -> ... -> загрузчик.
+// Поднятый элемент живет в этом кэше до того же момента, что и в next, но не дольше promoteTTL
+// (если promoteTTL <= 0 - столько же, сколько в next), поэтому верхний уровень можно держать
+// маленьким и короткоживущим. Значение, загруженное GetOrLoad, записывается во все уровни
+// цепочки с временем жизни ttl, ограниченным promoteTTL каждого уровня, у которого есть следующий.
+// С опцией Get этого кэша не возвращает устаревшие, но еще не удаленные элементы, а ищет дальше.
+// Отрицательный результат (AddNegative) на любом уровне останавливает поиск: вернется ErrNegative.
+// Остальные методы чтения (Has, GetMany, GetOrLoadMany и т.д.) и все методы записи и удаления
+// работают только с этим кэшем. В частности, Delete удаляет элемент только из этого уровня:
+// следующий Get снова поднимет его из next, поэтому чтобы удалить элемент из всей цепочки,
+// удалите его на каждом уровне.
+func WithFallback(next *Cache, promoteTTL time.Duration) Option {
+	return func(c *Cache) {
+		c.fallback = next
+		c.promoteTTL = promoteTTL
+	}
+}
+
+// Получение неустаревшего элемента по ключу из кэша, а при промахе - из следующих уровней
+// (WithFallback), с подъемом найденного. Вернет данные и сколько еще проживет элемент
+// (0 - никогда не устареет).
+func (c *Cache) lookup(key string) (interface{}, time.Duration, error) {
+	c.RLock()
+	now := c.now()
+	item, found := c.storage.Get(c.resolve(key))
+	found = found && !item.expired(now) && !c.expiresEarly(item)
+	c.stats.lookup(found)
+
+	switch {
+	case !found:
+		c.ghostMiss(key)
+	case item.negative:
+		c.RUnlock()
+		return nil, 0, ErrNegative
+	default:
+		c.hit(item)
+		data, ttl := c.copyData(item.data), time.Duration(0)
+		if item.destroyTimestamp != 0 {
+			ttl = time.Duration(max(item.destroyTimestamp-now, 1))
+		}
+		c.RUnlock()
+		return data, ttl, nil
+	}
+	c.RUnlock()
+
+	if c.fallback == nil {
+		return nil, 0, ErrKeyNotFound
+	}
+
+	return c.promote(key)
+}
+
+// Ищет элемент по ключу в следующих уровнях и поднимает найденный в кэш.
+// Вернет данные и время жизни, с которым элемент поднят.
+func (c *Cache) promote(key string) (interface{}, time.Duration, error) {
+	data, ttl, err := c.fallback.lookup(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ttl = c.promotedTTL(ttl)
+	c.setUnlessSealed(key, data, ttl)
+
+	return data, ttl, nil
+}
+
+// Ограничивает время жизни ttl элемента, пришедшего со следующего уровня, значением promoteTTL.
+func (c *Cache) promotedTTL(ttl time.Duration) time.Duration {
+	if c.fallback != nil && c.promoteTTL > 0 && (ttl <= 0 || ttl > c.promoteTTL) {
+		return c.promoteTTL
+	}
+
+	return ttl
+}
+
+// Записывает элемент в кэш и во все следующие уровни (WithFallback), ограничивая время жизни
+// на каждом уровне его promoteTTL.
+func (c *Cache) setThrough(key string, data interface{}, ttl time.Duration) {
+	for level := c; level != nil; level = level.fallback {
+		level.setUnlessSealed(key, data, level.promotedTTL(ttl))
+	}
+}
@@ -0,0 +1,33 @@
+package candycache
+
+// Включает вытеснение в порядке добавления (FIFO): когда кэш упирается в WithCapacity,
+// WithSoftByteTarget или квоту Namespace, первым вытесняется незащищенный элемент,
+// добавленный раньше всех, независимо от того, как часто и как давно к нему обращались
+// и когда он устареет. Подходит для потоковых нагрузок, где недавние обращения не предсказывают
+// следующие. Чтение (Get и т.д.) порядок не меняет; место ключа определяется первым добавлением,
+// как в ListInsertionOrder, а замена элемента по тому же ключу его не меняет.
+// Опция включает WithInsertionOrder (со всеми ее расходами памяти) и действует вместо
+// WithEvictionComparator. Вытеснение ради WithCapacity при этом берет элемент из начала
+// порядка, а не перебирает весь кэш. Устаревшие элементы вытесняются в общем порядке;
+// чтобы сначала удалялись они, добавьте WithSweepOnFull. То же включает WithEvictionPolicy(PolicyFIFO).
+func WithFIFOEviction() Option {
+	return func(c *Cache) {
+		c.fifo = true
+		if c.order == nil {
+			WithInsertionOrder()(c)
+		}
+	}
+}
+
+// Вернет незащищенный элемент, добавленный раньше всех (см. WithFIFOEviction). Без блокировки.
+func (c *Cache) oldestUnprotected() (EvictionCandidate, bool) {
+	now := c.now()
+	for element := c.order.keys.Front(); element != nil; element = element.Next() {
+		key := element.Value.(orderedKey).key
+		if item, found := c.storage.Get(key); found && !item.protected {
+			return c.candidate(key, item, -1, now), true
+		}
+	}
+
+	return EvictionCandidate{}, false
+}
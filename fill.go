@@ -0,0 +1,44 @@
+package candycache
+
+// Насколько заполненность должна опуститься ниже порога OnFillThreshold,
+// чтобы кэш снова считался незаполненным. Не дает обработчику срабатывать на каждом колебании у порога.
+const fillHysteresis = 0.05
+
+// Порог заполненности кэша (см. OnFillThreshold).
+type fillThreshold struct {
+	fraction float64         // Доля ограничения, при которой кэш считается заполненным
+	fn       func(over bool) // Обработчик пересечения порога
+	over     bool            // Кэш сейчас считается заполненным
+}
+
+// Задает обработчик пересечения порога заполненности: fn(true) вызывается, когда кэш
+// заполняется до fraction от ограничения, а fn(false) - когда заполненность опускается
+// ниже fraction - 0.05. Зазор не дает обработчику срабатывать на каждом колебании у порога.
+// Ограничение - WithCapacity (заполненность проверяется при каждом изменении кэша), а если
+// оно не задано - WithSoftByteTarget (проверяется при каждой очистке, когда кэш считает свой размер).
+// Если не задано ни то, ни другое, обработчик никогда не вызывается.
+// Обработчик вызывается вне блокировки, поэтому может обращаться к кэшу. Повторный вызов
+// заменяет обработчик; если кэш уже заполнен, обработчик сразу будет вызван с true.
+func (c *Cache) OnFillThreshold(fraction float64, fn func(over bool)) {
+	c.Lock()
+	defer c.unlock()
+
+	c.fill = &fillThreshold{fraction: fraction, fn: fn}
+}
+
+// Учитывает текущую заполненность usage (доля ограничения). Без блокировки.
+// Если порог пересечен, запоминает событие, чтобы вызвать обработчик в unlock.
+func (c *Cache) observeFill(usage float64) {
+	f := c.fill
+
+	switch {
+	case !f.over && usage >= f.fraction:
+		f.over = true
+	case f.over && usage < f.fraction-fillHysteresis:
+		f.over = false
+	default:
+		return
+	}
+
+	c.fillEvents = append(c.fillEvents, f.over)
+}
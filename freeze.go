@@ -0,0 +1,89 @@
+package candycache
+
+// Замораживает неустаревший элемент с ключом key: пока он заморожен, он не считается
+// устаревшим (Get, Has, CountLive и т.д.) и не удаляется очисткой, даже если его время жизни
+// или WithMaxAge истекли. Само время жизни при этом не меняется.
+// Заморозка не защищает от вытеснения ради WithCapacity, WithSoftByteTarget и квоты
+// Namespace - для этого элемент нужно добавить через AddWithPriority. Продление времени жизни
+// (GetExtend, GetRefresh, TouchMany) и Expire элемент не размораживают: новый срок начнет
+// действовать после Unfreeze. Замена элемента через Set снимает заморозку.
+// Вернет false, если элемента нет или он уже устарел.
+func (c *Cache) Freeze(key string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	c.checkSealed()
+
+	item, found := c.storage.Get(key)
+	if !found || item.expired(c.now()) {
+		return false
+	}
+
+	if c.buckets != nil {
+		c.buckets.remove(key, item.destroyTimestamp)
+	}
+
+	item.frozen = true
+	c.storage.Set(key, item)
+
+	return true
+}
+
+// Размораживает элемент с ключом key (см. Freeze): дальше он устаревает как обычно,
+// и если его время жизни уже истекло, он будет удален ближайшей очисткой.
+// Вернет false, если элемента нет или он не заморожен.
+func (c *Cache) Unfreeze(key string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	c.checkSealed()
+
+	item, found := c.storage.Get(key)
+	if !found || !item.frozen {
+		return false
+	}
+
+	item.frozen = false
+	if c.buckets != nil {
+		c.buckets.add(key, item.destroyTimestamp)
+	}
+	c.storage.Set(key, item)
+	c.wakeGC(item.destroyTimestamp)
+
+	if c.empty != nil {
+		close(c.empty)
+		c.empty = nil
+	}
+
+	return true
+}
+
+// Определяет заморожен ли элемент (см. Cache.Freeze).
+func (i *Item) IsFrozen() bool {
+	return i.frozen
+}
+
+// Получение элемента по ключу с признаком "устарел, но заморожен". Get возвращает замороженный
+// элемент и после того, как его срок истек (в этом смысл заморозки), и не отличает его
+// от неустаревшего. GetFrozen возвращает его так же, но с pinned == true, если срок элемента
+// (время жизни, WithIdleTTL или WithMaxAge) уже истек и в кэше его держит только заморозка:
+// после Unfreeze такой элемент удалит ближайшая очистка. Для незамороженного элемента
+// pinned == false. Если элемента нет, это отрицательный результат или незамороженный элемент,
+// устаревший по WithIdleTTL (его не возвращает и Get), found == false.
+func (c *Cache) GetFrozen(key string) (data interface{}, found bool, pinned bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	item, found := c.storage.Get(key)
+	found = found && !item.negative && !c.idleLapsed(item)
+	c.stats.lookup(found)
+	if !found {
+		return nil, false, false
+	}
+
+	now, maxAge := c.now(), int64(c.maxAge)
+	pinned = item.frozen && (item.lapsed(now) || (maxAge > 0 && now-item.createdAt > maxAge))
+	c.hit(item)
+
+	return c.copyData(item.data), true, pinned
+}
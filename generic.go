@@ -0,0 +1,174 @@
+package candycache
+
+import (
+	"sync"
+	"time"
+)
+
+// Элемент типизированного кэша - это данные типа V и время их жизни.
+type itemOf[V any] struct {
+	destroyTimestamp int64 // Момент в Unix-наносекундах, когда элемент становится устаревшим (0 - никогда)
+	data             V     // Данные
+}
+
+// Определяет является ли элемент устаревшим на момент now.
+func (i *itemOf[V]) expired(now int64) bool {
+	return i.destroyTimestamp != 0 && i.destroyTimestamp <= now
+}
+
+// Типизированный кэш с ключами типа K и значениями типа V.
+// Повторяет API Cache, но не требует приведения типов и приведения ключей к строкам.
+type KCache[K comparable, V any] struct {
+	sync.RWMutex                    // Мьютекс для реализации безопасного доступа к общим данным
+	storage         map[K]itemOf[V] // Хранилище элементов
+	cleanupInterval time.Duration   // Интервал очистки хранилища в наносекундах
+}
+
+// Создает новый экземпляр KCache с интервалом очистки cleanupInterval.
+// Если cleanupInterval <= 0, то кэш не будет очищаться автоматически.
+func KCacher[K comparable, V any](cleanupInterval time.Duration) *KCache[K, V] {
+	cache := &KCache[K, V]{
+		storage:         make(map[K]itemOf[V]),
+		cleanupInterval: cleanupInterval,
+	}
+
+	if cleanupInterval > 0 {
+		go cache.gc(cleanupInterval)
+	}
+
+	return cache
+}
+
+// gc = Garbage Collector.
+func (c *KCache[K, V]) gc(cleanupInterval time.Duration) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.Cleanup()
+	}
+}
+
+// Перебирает все элементы в кэше, удаляет устаревшие.
+func (c *KCache[K, V]) Cleanup() {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now().UnixNano()
+	for key, item := range c.storage {
+		if item.expired(now) {
+			delete(c.storage, key)
+		}
+	}
+}
+
+// Удаление всех элементов из кэша.
+func (c *KCache[K, V]) Flush() {
+	c.Lock()
+	defer c.Unlock()
+
+	clear(c.storage)
+}
+
+// Получение элемента из кэша по ключу.
+func (c *KCache[K, V]) Get(key K) (V, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	item, found := c.storage[key]
+
+	if !found {
+		var zero V
+		return zero, ErrKeyNotFound
+	}
+
+	return item.data, nil
+}
+
+// Получение неустаревшего элемента по ключу.
+// Вторым аргументом возвращается найден ли элемент.
+func (c *KCache[K, V]) get(key K) (V, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	item, found := c.storage[key]
+	if !found || item.expired(time.Now().UnixNano()) {
+		var zero V
+		return zero, false
+	}
+
+	return item.data, true
+}
+
+// Определяет есть ли в кэше неустаревший элемент с ключом key.
+func (c *KCache[K, V]) Has(key K) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	item, found := c.storage[key]
+
+	return found && !item.expired(time.Now().UnixNano())
+}
+
+// Определяет является ли элемент устаревшим.
+// Вторым аргументов возвращается есть элемент в кэше или нет.
+func (c *KCache[K, V]) IsExpired(key K) (bool, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	item, found := c.storage[key]
+
+	if !found {
+		return false, ErrKeyNotFound
+	}
+
+	return item.expired(time.Now().UnixNano()), nil
+}
+
+// Удаление элемента по ключу.
+func (c *KCache[K, V]) Delete(key K) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, found := c.storage[key]; !found {
+		return ErrKeyNotFound
+	}
+
+	delete(c.storage, key)
+
+	return nil
+}
+
+// Добавление элемента в кэш.
+// Если ttl <= 0, элемент никогда не устаревает.
+func (c *KCache[K, V]) Set(key K, data V, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.storage[key] = itemOf[V]{
+		destroyTimestamp: deadline(time.Now().UnixNano(), ttl),
+		data:             data,
+	}
+}
+
+// Вернет количество элементов в кэше.
+func (c *KCache[K, V]) Count() int {
+	c.RLock()
+	defer c.RUnlock()
+
+	return len(c.storage)
+}
+
+// Возвращает список ключей всех элементов кэша.
+func (c *KCache[K, V]) Keys() []K {
+	c.RLock()
+	defer c.RUnlock()
+
+	keys := make([]K, 0, len(c.storage))
+
+	for key := range c.storage {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
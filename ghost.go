@@ -0,0 +1,79 @@
+package candycache
+
+// Ключи недавно вытесненных элементов без данных (см. WithGhostKeys): кольцевой буфер
+// на size ключей и индекс ключей, которые в нем сейчас есть.
+type ghostKeys struct {
+	ring []ghostKey        // Кольцевой буфер ключей в порядке вытеснения
+	next int               // Позиция в ring для следующего вытесненного ключа
+	seq  uint64            // Номер последнего вытесненного ключа
+	keys map[string]uint64 // Ключ -> номер его последнего вытеснения
+}
+
+// Вытесненный ключ и номер вытеснения, чтобы старая запись буфера не удалила из индекса новую.
+type ghostKey struct {
+	key string
+	seq uint64
+}
+
+// Включает подсчет "призрачных попаданий" (см. GhostHits): кэш помнит ключи (без данных)
+// последних size элементов, вытесненных ради WithCapacity, WithSoftByteTarget или квоты Namespace,
+// и считает промахи по этим ключам. Такой промах - попадание, которое было бы, будь кэш больше,
+// поэтому GhostHits позволяет оценить пользу от увеличения кэша до того, как его увеличивать.
+// Память - порядка size ключей и записей индекса. Если size <= 0, подсчет выключен (по умолчанию).
+func WithGhostKeys(size int) Option {
+	return func(c *Cache) {
+		if size <= 0 {
+			c.ghosts = nil
+			return
+		}
+
+		c.ghosts = &ghostKeys{ring: make([]ghostKey, size), keys: make(map[string]uint64, size)}
+	}
+}
+
+// Забывает все вытесненные ключи. Только под блокировкой на запись.
+func (g *ghostKeys) reset() {
+	clear(g.ring)
+	clear(g.keys)
+	g.next = 0
+}
+
+// Запоминает вытесненный ключ, вытесняя из буфера самый старый. Только под блокировкой на запись.
+func (g *ghostKeys) add(key string) {
+	if old := g.ring[g.next]; g.keys[old.key] == old.seq {
+		delete(g.keys, old.key)
+	}
+
+	g.seq++
+	g.ring[g.next] = ghostKey{key: key, seq: g.seq}
+	g.keys[key] = g.seq
+	g.next = (g.next + 1) % len(g.ring)
+}
+
+// Забывает ключ, который снова записан в кэш. Только под блокировкой на запись.
+func (g *ghostKeys) remove(key string) {
+	delete(g.keys, key)
+}
+
+// Определяет был ли ключ недавно вытеснен. Достаточно блокировки на чтение.
+func (g *ghostKeys) has(key string) bool {
+	_, found := g.keys[key]
+
+	return found
+}
+
+// Учитывает промах по ключу key: если ключ недавно вытеснен, это призрачное попадание.
+func (c *Cache) ghostMiss(key string) {
+	if c.ghosts != nil && c.ghosts.has(key) {
+		c.stats.ghostHits.Add(1)
+	}
+}
+
+// Вернет сколько промахов пришлось на ключи недавно вытесненных элементов (см. WithGhostKeys),
+// то есть сколько попаданий добавилось бы, если бы кэш вмещал еще примерно столько элементов,
+// сколько помнит WithGhostKeys. Это оценка: учитываются только вытеснения ради ограничений размера,
+// каждый промах по такому ключу считается отдельно, пока ключ не записан снова, а вытеснения
+// больше последних size в оценку не попадают. Без WithGhostKeys всегда 0.
+func (c *Cache) GhostHits() uint64 {
+	return c.stats.ghostHits.Load()
+}
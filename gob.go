@@ -0,0 +1,93 @@
+package candycache
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Представление элемента для gob: поля Item не экспортируются, и gob не видит их напрямую.
+type itemGob struct {
+	DestroyTimestamp int64
+	CreatedAt        int64
+	Negative         bool
+	Version          uint64
+	Protected        bool
+	Tags             []string
+	Cost             int64
+	Data             interface{}
+}
+
+// Кодирует элемент в gob вместе со всеми метаданными.
+// Конкретные типы данных, хранящихся в interface{}, должны быть зарегистрированы через gob.Register.
+func (i Item) GobEncode() ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := gob.NewEncoder(&buf).Encode(itemGob{
+		DestroyTimestamp: i.destroyTimestamp,
+		CreatedAt:        i.createdAt,
+		Negative:         i.negative,
+		Version:          i.version,
+		Protected:        i.protected,
+		Tags:             i.tags,
+		Cost:             i.cost,
+		Data:             i.data,
+	})
+	return buf.Bytes(), err
+}
+
+// Декодирует элемент, закодированный через GobEncode.
+func (i *Item) GobDecode(data []byte) error {
+	entry := itemGob{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		return err
+	}
+
+	*i = Item{
+		destroyTimestamp: entry.DestroyTimestamp,
+		createdAt:        entry.CreatedAt,
+		negative:         entry.Negative,
+		version:          entry.Version,
+		protected:        entry.Protected,
+		tags:             entry.Tags,
+		cost:             entry.Cost,
+		data:             entry.Data,
+	}
+
+	return nil
+}
+
+// Кодирует все элементы кэша в gob, включая устаревшие. Настройки кэша не кодируются.
+func (c *Cache) GobEncode() ([]byte, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	storage := make(map[string]Item, c.storage.Len())
+	for key, item := range c.storage.Range {
+		storage[key] = item
+	}
+
+	buf := bytes.Buffer{}
+	err := gob.NewEncoder(&buf).Encode(storage)
+	return buf.Bytes(), err
+}
+
+// Добавляет в кэш элементы, закодированные через GobEncode, как Load:
+// элементы с совпадающими ключами заменяются, а версии выдаются заново.
+// Если задана WithCapacity и места для очередного элемента не нашлось, вернет ErrCacheFull.
+func (c *Cache) GobDecode(data []byte) error {
+	storage := map[string]Item{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&storage); err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.unlock()
+
+	for key, item := range storage {
+		item.version = c.nextVersion()
+		if err := c.store(key, item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package candycache
+
+import (
+	"container/heap"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Возвращает сколько раз элемент был найден при получении (Get, TryGet, GetExtend,
+// GetRefresh, GetAllowStale, транзакции) с момента последней записи по его ключу.
+func (i *Item) Hits() uint64 {
+	if i.hits == nil {
+		return 0
+	}
+	return i.hits.Load()
+}
+
+// Учитывает попадание в элемент. Счетчик атомарный, поэтому достаточно блокировки на чтение.
+func (i *Item) hit() {
+	if i.hits != nil {
+		i.hits.Add(1)
+	}
+}
+
+// Учитывает попадание в элемент и, если у элемента задан WithIdleTTL или включен
+// WithAccessTracking, обращение к нему. Элемент, чей WithIdleTTL уже истек (читается он,
+// только если заморожен), обращение не продлевает: после Unfreeze он устареет как должен.
+// Достаточно блокировки на чтение.
+func (c *Cache) hit(item Item) {
+	item.hit()
+
+	if item.lastAccess == nil {
+		return
+	}
+
+	now := c.now()
+	if item.idleTTL > 0 && now-item.lastAccess.Load() >= item.idleTTL {
+		return
+	}
+	item.lastAccess.Store(now)
+}
+
+// Заводит элементу отметку последнего обращения, если включен WithAccessTracking
+// (или создано пространство с квотой), а у элемента ее еще нет.
+func (c *Cache) trackAccess(i *Item) {
+	if (c.accessTracking || c.quotaTracking) && i.lastAccess == nil {
+		i.lastAccess = new(atomic.Int64)
+	}
+}
+
+// Включает отслеживание момента последнего обращения к каждому элементу (Item.LastAccess) -
+// например, чтобы найти неустаревшие элементы, которые давно никто не читает. Обращение - это
+// попадание (Get, TryGet, GetMany, GetOrLoad и т.д.), а не запись и не перебор (List, Keys).
+// Каждая запись заводит элементу отметку заново, поэтому к замененному элементу еще не обращались.
+// Цена - один атомарный счетчик на элемент и одна атомарная запись на каждое попадание,
+// которой достаточно блокировки на чтение.
+func WithAccessTracking() Option {
+	return func(c *Cache) {
+		c.accessTracking = true
+	}
+}
+
+// Возвращает момент последнего обращения к элементу (см. WithAccessTracking).
+// Для элемента с WithIdleTTL отсчет начинается с момента добавления. Если обращения
+// не отслеживаются или к элементу еще не обращались, вернет нулевое время (IsZero() == true).
+func (i *Item) LastAccess() time.Time {
+	if i.lastAccess == nil {
+		return time.Time{}
+	}
+
+	last := i.lastAccess.Load()
+	if last == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, last)
+}
+
+// Заводит счетчик попаданий элементу, у которого его еще нет.
+func (i *Item) trackHits() {
+	if i.hits == nil {
+		i.hits = new(atomic.Uint64)
+	}
+}
+
+// Возвращает до n неустаревших элементов с наибольшим количеством попаданий (Item.Hits),
+// по убыванию попаданий. Выбор делается через кучу размера n, без сортировки всего кэша.
+func (c *Cache) TopN(n int) []KeyItemPair {
+	if n <= 0 {
+		return []KeyItemPair{}
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	now := c.now()
+	top := &hitsHeap{}
+
+	for key, item := range c.storage.Range {
+		if item.expired(now) {
+			continue
+		}
+
+		pair := KeyItemPair{Key: key, Item: item}
+		if top.Len() < n {
+			heap.Push(top, pair)
+		} else if item.Hits() > (*top)[0].Item.Hits() {
+			(*top)[0] = pair
+			heap.Fix(top, 0)
+		}
+	}
+
+	slices.SortFunc(*top, func(a, b KeyItemPair) int {
+		ah, bh := a.Item.Hits(), b.Item.Hits()
+		switch {
+		case ah > bh:
+			return -1
+		case ah < bh:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return *top
+}
+
+// Куча элементов с минимальным количеством попаданий на вершине.
+type hitsHeap []KeyItemPair
+
+func (h hitsHeap) Len() int           { return len(h) }
+func (h hitsHeap) Less(i, j int) bool { return h[i].Item.Hits() < h[j].Item.Hits() }
+func (h hitsHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *hitsHeap) Push(x any) { *h = append(*h, x.(KeyItemPair)) }
+
+func (h *hitsHeap) Pop() any {
+	old := *h
+	pair := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return pair
+}
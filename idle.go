@@ -0,0 +1,120 @@
+package candycache
+
+import "time"
+
+// Запоминает ключ элемента со скользящим временем жизни (WithIdleTTL), если включены корзины
+// устаревания: корзины знают только предельный срок, и очистка по корзинам не нашла бы
+// элементы, устаревшие без обращений. Без блокировки.
+func (c *Cache) trackIdle(key string, item Item) {
+	if c.buckets == nil {
+		return
+	}
+
+	if item.idleTTL == 0 {
+		delete(c.idleKeys, key)
+		return
+	}
+
+	if c.idleKeys == nil {
+		c.idleKeys = make(map[string]struct{})
+	}
+	c.idleKeys[key] = struct{}{}
+}
+
+// Определяет устарел ли элемент со скользящим временем жизни (WithIdleTTL) - без обращений
+// или по предельному сроку. Такой элемент не находится даже методами, которые возвращают
+// устаревшие, но еще не удаленные элементы (Get, TryGet), и обращение к нему не продлевает его.
+// Достаточно блокировки на чтение.
+func (c *Cache) idleLapsed(item Item) bool {
+	return item.idleTTL > 0 && item.expired(c.now())
+}
+
+// Вызывает fn для элементов со скользящим временем жизни, которые устарели без обращений,
+// но предельный срок которых еще не наступил (их не найдут корзины). Без блокировки.
+// fn не должна менять кэш.
+func (c *Cache) idleExpired(now int64, fn func(key string, item Item)) {
+	for key := range c.idleKeys {
+		item, found := c.storage.Get(key)
+		if !found || item.idleTTL == 0 {
+			continue
+		}
+
+		if item.expired(now) && (item.destroyTimestamp == 0 || item.destroyTimestamp > now) {
+			fn(key, item)
+		}
+	}
+}
+
+// Задает предельное время без обращений для всех элементов кэша: очистка (автоматическая,
+// Cleanup и т.д.) удаляет элементы, к которым не обращались дольше d, даже если их время жизни
+// еще не истекло, - например, чтобы ограничить память кэша с долгими временами жизни и редкими
+// чтениями. Обращение - то же, что для WithAccessTracking (попадание, а не перебор); запись
+// по ключу начинает отсчет заново. Опция включает WithAccessTracking.
+// Как и WithMaxAge, ограничение применяется только при очистке - до нее такие элементы остаются
+// доступными, а замороженные (Freeze) не удаляются. Скользящее время жизни элемента (WithIdleTTL)
+// действует независимо: элемент удаляется по тому сроку, что наступит раньше, но WithIdleTTL
+// скрывает элемент от чтения сразу, а WithEvictAfterIdle - только удаляет при очистке.
+// Если d <= 0, ограничения нет. С WithExpiryBuckets очистка с этой опцией перебирает весь кэш.
+func WithEvictAfterIdle(d time.Duration) Option {
+	return func(c *Cache) {
+		c.evictAfterIdle = d
+		if d > 0 {
+			WithAccessTracking()(c)
+		}
+	}
+}
+
+// Ограничения, по которым очистка удаляет неустаревшие элементы (WithMaxAge, WithEvictAfterIdle),
+// в наносекундах (0 - не ограничено).
+type ageLimits struct {
+	maxAge  int64
+	maxIdle int64
+}
+
+// Вернет ограничения очистки кэша.
+func (c *Cache) limits() ageLimits {
+	return ageLimits{maxAge: int64(c.maxAge), maxIdle: int64(c.evictAfterIdle)}
+}
+
+// Определяет задано ли хоть одно ограничение.
+func (l ageLimits) any() bool {
+	return l.maxAge > 0 || l.maxIdle > 0
+}
+
+// Определяет превысил ли элемент item на момент now предельный возраст или время без обращений.
+func (l ageLimits) exceeded(item *Item, now int64) bool {
+	if aged := l.agedAt(item); aged != 0 && now > aged {
+		return true
+	}
+
+	idled := l.idledAt(item)
+	return idled != 0 && now >= idled
+}
+
+// Момент, когда элемент item достигнет предельного возраста (0 - возраст не ограничен).
+func (l ageLimits) agedAt(item *Item) int64 {
+	if l.maxAge <= 0 {
+		return 0
+	}
+
+	return item.createdAt + l.maxAge
+}
+
+// Момент, когда элемент item пробудет без обращений предельное время (0 - не ограничено).
+func (l ageLimits) idledAt(item *Item) int64 {
+	if l.maxIdle <= 0 {
+		return 0
+	}
+
+	return item.idleSince() + l.maxIdle
+}
+
+// Момент, с которого элемент не используется: последнее обращение, а если обращений
+// не было или они не отслеживаются - добавление.
+func (i *Item) idleSince() int64 {
+	if i.lastAccess == nil {
+		return i.createdAt
+	}
+
+	return max(i.createdAt, i.lastAccess.Load())
+}
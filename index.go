@@ -0,0 +1,93 @@
+package candycache
+
+// Вторичный индекс: отображение значения, извлеченного из данных элемента, в ключ элемента.
+type index struct {
+	extractor func(data interface{}) (string, bool) // Извлекает значение из данных элемента
+	keys      map[string]string                     // Значение -> ключ элемента
+}
+
+// Создает (или пересоздает) вторичный индекс с именем name.
+// extractor извлекает из данных элемента значение, по которому его можно найти через GetByIndex;
+// если extractor вернул false, элемент в индекс не попадает. Индекс сразу строится по всем
+// элементам кэша и затем обновляется при каждой записи и удалении.
+// Значение должно быть уникальным: если оно совпадает у нескольких элементов, индекс указывает
+// на записанный последним. extractor должен быть детерминированным и быстрым - он вызывается
+// под блокировкой при каждой записи, в том числе для старых данных заменяемого элемента.
+// Каждый индекс хранит по строке значения и ключа на каждый проиндексированный элемент.
+func (c *Cache) Index(name string, extractor func(data interface{}) (string, bool)) {
+	c.Lock()
+	defer c.Unlock()
+
+	idx := &index{extractor: extractor, keys: make(map[string]string)}
+	for key, item := range c.storage.Range {
+		idx.add(key, item)
+	}
+
+	if c.indexes == nil {
+		c.indexes = make(map[string]*index)
+	}
+	c.indexes[name] = idx
+}
+
+// Удаляет вторичный индекс с именем name.
+func (c *Cache) DropIndex(name string) {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.indexes, name)
+}
+
+// Получение неустаревшего элемента по значению value вторичного индекса name.
+// Вторым аргументом возвращается найден ли элемент. Если индекса нет, элемент не найден.
+func (c *Cache) GetByIndex(name, value string) (interface{}, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	idx, found := c.indexes[name]
+	if !found {
+		return nil, false
+	}
+
+	item, found := c.storage.Get(idx.keys[value])
+	found = found && !item.negative && !item.expired(c.now())
+	c.stats.lookup(found)
+	if !found {
+		return nil, false
+	}
+
+	c.hit(item)
+
+	return c.copyData(item.data), true
+}
+
+// Добавляет элемент в индекс.
+func (idx *index) add(key string, item Item) {
+	if item.negative {
+		return
+	}
+
+	if value, ok := idx.extractor(item.data); ok {
+		idx.keys[value] = key
+	}
+}
+
+// Удаляет элемент из индекса, если индекс указывает на него.
+func (idx *index) remove(key string, item Item) {
+	if item.negative {
+		return
+	}
+
+	if value, ok := idx.extractor(item.data); ok && idx.keys[value] == key {
+		delete(idx.keys, value)
+	}
+}
+
+// Перестраивает все индексы по текущему хранилищу. Без блокировки.
+func (c *Cache) reindex() {
+	for _, idx := range c.indexes {
+		clear(idx.keys)
+		for key, item := range c.storage.Range {
+			idx.add(key, item)
+		}
+	}
+}
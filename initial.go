@@ -0,0 +1,65 @@
+package candycache
+
+import "time"
+
+// Группа начальных элементов с общим временем жизни (см. WithInitialEntries).
+type initialEntries struct {
+	entries map[string]interface{}
+	ttl     time.Duration
+}
+
+// Заполняет кэш элементами entries со временем жизни ttl при создании, до того как кэш
+// вернется из Cacher, поэтому никакая горутина не увидит его пустым. Если ttl <= 0, элементы
+// никогда не устаревают. Элементы добавляются как через Set, с учетом остальных опций
+// (WithCapacity, WithPrefixPolicy, WithStore и т.д.), в каком бы порядке ни были заданы опции.
+// Опцию можно задать несколько раз: группы добавляются по порядку, и более поздние значения
+// заменяют ранее добавленные по тем же ключам.
+// Если элементов больше чем WithCapacity, Cacher вытеснит лишние, а New вернет ErrCacheFull.
+func WithInitialEntries(entries map[string]interface{}, ttl time.Duration) Option {
+	return func(c *Cache) {
+		c.initial = append(c.initial, initialEntries{entries: entries, ttl: ttl})
+	}
+}
+
+// Создает новый экземпляр Cache так же, как Cacher, но проверяет, что начальные элементы
+// (WithInitialEntries) помещаются в ограничения кэша: если разных ключей среди них больше
+// чем WithCapacity, вернет ErrCacheFull и не запустит автоматическую очистку.
+func New(cleanupInterval time.Duration, opts ...Option) (*Cache, error) {
+	cache := newCache(cleanupInterval, opts...)
+
+	if cache.capacity > 0 {
+		keys := make(map[string]struct{})
+		for _, group := range cache.initial {
+			for key := range group.entries {
+				keys[key] = struct{}{}
+			}
+		}
+
+		if len(keys) > cache.capacity {
+			return nil, ErrCacheFull
+		}
+	}
+
+	cache.populate()
+	cache.start()
+
+	return cache, nil
+}
+
+// Добавляет в кэш начальные элементы (WithInitialEntries) и забывает их.
+func (c *Cache) populate() {
+	if len(c.initial) == 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.unlock()
+
+	for _, group := range c.initial {
+		for key, data := range group.entries {
+			c.store(key, c.newItem(data, group.ttl))
+		}
+	}
+
+	c.initial = nil
+}
@@ -0,0 +1,197 @@
+package candycache
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Ошибка, возвращаемая VerifyIntegrity, если внутренние структуры кэша расходятся между собой.
+var ErrCorrupted = errors.New("candycache: integrity check failed")
+
+// Проверяет согласованность внутренних структур кэша с хранилищем и вернет ошибку, обернутую
+// в ErrCorrupted, с описанием первого найденного расхождения (nil - расхождений нет). Проверяются
+// порядок добавления (WithInsertionOrder), корзины устаревания и ключи элементов со скользящим
+// временем жизни, зависимости (AddWithDeps), псевдонимы (AddWithAliases), вторичные индексы
+// и версии элементов. Размер и количество элементов кэш не хранит, а считает при каждом вызове,
+// поэтому сверять их не с чем.
+// Проверка - средство отладки (например, для отчета об ошибке): она проходит все элементы
+// и все структуры под блокировкой на запись, вызывая функции индексов для каждого
+// проиндексированного элемента, поэтому ее не стоит вызывать на горячем пути.
+func (c *Cache) VerifyIntegrity() error {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, check := range []func() error{
+		c.verifyItems,
+		c.verifyOrder,
+		c.verifyBuckets,
+		c.verifyDeps,
+		c.verifyAliases,
+		c.verifyIndexes,
+	} {
+		if err := check(); err != nil {
+			return fmt.Errorf("%w: %w", ErrCorrupted, err)
+		}
+	}
+
+	return nil
+}
+
+// Проверяет сами элементы. Без блокировки.
+func (c *Cache) verifyItems() error {
+	for key, item := range c.storage.Range {
+		if item.version > c.version {
+			return fmt.Errorf("item %q has version %d above the last issued %d", key, item.version, c.version)
+		}
+
+		if item.hits == nil {
+			return fmt.Errorf("item %q has no hit counter", key)
+		}
+
+		if item.idleTTL > 0 && item.lastAccess == nil {
+			return fmt.Errorf("item %q has an idle TTL but no last access", key)
+		}
+	}
+
+	return nil
+}
+
+// Проверяет порядок добавления. Без блокировки.
+func (c *Cache) verifyOrder() error {
+	if c.order == nil {
+		return nil
+	}
+
+	if c.order.keys.Len() != len(c.order.elements) {
+		return fmt.Errorf("insertion order has %d keys but %d indexed nodes", c.order.keys.Len(), len(c.order.elements))
+	}
+
+	if len(c.order.elements) != c.storage.Len() {
+		return fmt.Errorf("insertion order has %d keys but storage has %d items", len(c.order.elements), c.storage.Len())
+	}
+
+	seq := uint64(0)
+	for element := c.order.keys.Front(); element != nil; element = element.Next() {
+		ordered := element.Value.(orderedKey)
+		if c.order.elements[ordered.key] != element {
+			return fmt.Errorf("insertion order node of %q is not indexed", ordered.key)
+		}
+
+		if _, found := c.storage.Get(ordered.key); !found {
+			return fmt.Errorf("insertion order has key %q missing from storage", ordered.key)
+		}
+
+		if ordered.seq <= seq {
+			return fmt.Errorf("insertion order is not ascending at %q", ordered.key)
+		}
+		seq = ordered.seq
+	}
+
+	return nil
+}
+
+// Проверяет корзины устаревания и ключи элементов со скользящим временем жизни. Без блокировки.
+func (c *Cache) verifyBuckets() error {
+	if c.buckets == nil {
+		return nil
+	}
+
+	bucketed := 0
+	for id, bucket := range c.buckets.buckets {
+		for key := range bucket {
+			item, found := c.storage.Get(key)
+			if !found {
+				return fmt.Errorf("expiry bucket has key %q missing from storage", key)
+			}
+
+			if item.frozen || item.destroyTimestamp/c.buckets.width != id {
+				return fmt.Errorf("item %q is in the wrong expiry bucket", key)
+			}
+		}
+		bucketed += len(bucket)
+	}
+
+	expected := 0
+	for key, item := range c.storage.Range {
+		if !item.frozen && item.destroyTimestamp != 0 {
+			expected++
+		}
+
+		if _, found := c.idleKeys[key]; found != (item.idleTTL > 0) {
+			return fmt.Errorf("idle key tracking of %q does not match its idle TTL", key)
+		}
+	}
+
+	if bucketed != expected {
+		return fmt.Errorf("expiry buckets hold %d keys but %d items expire", bucketed, expected)
+	}
+
+	for key := range c.idleKeys {
+		if _, found := c.storage.Get(key); !found {
+			return fmt.Errorf("idle keys have key %q missing from storage", key)
+		}
+	}
+
+	return nil
+}
+
+// Проверяет зависимости между элементами в обе стороны. Без блокировки.
+func (c *Cache) verifyDeps() error {
+	for base, dependents := range c.dependents {
+		for key := range dependents {
+			item, found := c.storage.Get(key)
+			if !found {
+				return fmt.Errorf("dependent %q of %q is missing from storage", key, base)
+			}
+
+			if !slices.Contains(item.dependsOn, base) {
+				return fmt.Errorf("%q is linked as dependent of %q but does not depend on it", key, base)
+			}
+		}
+	}
+
+	for key, item := range c.storage.Range {
+		for _, base := range item.dependsOn {
+			if _, found := c.dependents[base][key]; !found {
+				return fmt.Errorf("dependency of %q on %q is not linked", key, base)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Проверяет псевдонимы ключей. Без блокировки.
+func (c *Cache) verifyAliases() error {
+	for alias, primary := range c.aliases {
+		item, found := c.storage.Get(primary)
+		if !found {
+			return fmt.Errorf("alias %q points to %q missing from storage", alias, primary)
+		}
+
+		if !slices.Contains(item.aliases, alias) {
+			return fmt.Errorf("alias %q points to %q which does not declare it", alias, primary)
+		}
+	}
+
+	return nil
+}
+
+// Проверяет вторичные индексы. Без блокировки.
+func (c *Cache) verifyIndexes() error {
+	for name, idx := range c.indexes {
+		for value, key := range idx.keys {
+			item, found := c.storage.Get(key)
+			if !found {
+				return fmt.Errorf("index %q maps %q to %q missing from storage", name, value, key)
+			}
+
+			if got, ok := idx.extractor(item.data); item.negative || !ok || got != value {
+				return fmt.Errorf("index %q maps %q to %q which no longer has that value", name, value, key)
+			}
+		}
+	}
+
+	return nil
+}
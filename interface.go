@@ -0,0 +1,21 @@
+package candycache
+
+import "time"
+
+// Минимальный общий контракт кэша, чтобы код мог работать с разными реализациями
+// (Cache, ShardedCache, кэш поверх Redis, заглушка в тестах) через один интерфейс.
+// Сигнатуры совпадают с методами Cache: Get возвращает ErrKeyNotFound при промахе,
+// Add - ErrKeyExists, если неустаревший элемент уже есть. Интерфейс намеренно мал
+// и не будет расширяться, чтобы сторонние реализации не ломались.
+type CacheInterface interface {
+	Get(key string) (interface{}, error)
+	Add(key string, data interface{}, ttl time.Duration) error
+	Delete(key string) error
+	Count() int
+	Flush()
+}
+
+var (
+	_ CacheInterface = (*Cache)(nil)
+	_ CacheInterface = (*ShardedCache)(nil)
+)
@@ -0,0 +1,85 @@
+package candycache
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Строка дампа в формате JSON Lines (см. WriteJSONL).
+// ExpiresAt не заполняется для элементов, которые никогда не устаревают.
+type jsonlEntry struct {
+	Key       string      `json:"key"`
+	Data      interface{} `json:"data"`
+	ExpiresAt *time.Time  `json:"expiresAt,omitempty"`
+}
+
+// Записывает неустаревшие элементы кэша в w в формате JSON Lines: по одному объекту
+// {"key":...,"data":...,"expiresAt":...} на строку, где expiresAt - момент устаревания
+// в RFC 3339 (для элементов, которые никогда не устаревают, его нет).
+// Элементы кодируются и пишутся по одному, поэтому дамп не собирается в памяти целиком,
+// но блокировка на чтение удерживается до конца записи.
+// Закэшированные отрицательные результаты (AddNegative) не записываются.
+func (c *Cache) WriteJSONL(w io.Writer) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	now := c.now()
+	encoder := json.NewEncoder(w)
+	for key, item := range c.storage.Range {
+		if item.negative || item.expired(now) {
+			continue
+		}
+
+		entry := jsonlEntry{Key: key, Data: item.data}
+		if item.destroyTimestamp != 0 {
+			expiresAt := time.Unix(0, item.destroyTimestamp)
+			entry.ExpiresAt = &expiresAt
+		}
+
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Загружает в кэш элементы из r в формате JSON Lines, записанном WriteJSONL.
+// Строки читаются и добавляются (как через Set) по одной, и блокировка берется отдельно
+// на каждый элемент, поэтому загрузка не держит весь дамп в памяти и не останавливает
+// чтение кэша. Элементы, устаревшие к моменту загрузки, пропускаются.
+// Если задана WithCapacity и места для очередного элемента не нашлось, вернет ErrCacheFull;
+// уже загруженные элементы при ошибке остаются в кэше.
+func (c *Cache) ReadJSONL(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	for {
+		entry := jsonlEntry{}
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := c.loadJSONL(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// Добавляет в кэш элемент, прочитанный ReadJSONL, если он еще не устарел.
+func (c *Cache) loadJSONL(entry jsonlEntry) error {
+	c.Lock()
+	defer c.unlock()
+
+	now := c.now()
+	item := c.newItem(entry.Data, 0)
+	if entry.ExpiresAt != nil {
+		item.destroyTimestamp = entry.ExpiresAt.UnixNano()
+		if item.expired(now) {
+			return nil
+		}
+	}
+
+	return c.store(entry.Key, item)
+}
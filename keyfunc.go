@@ -0,0 +1,57 @@
+package candycache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Функция, которая превращает ключ любого типа в строковый ключ кэша (см. WithKeyFunc).
+type KeyFunc func(key interface{}) string
+
+// Задает функцию, которой GetKey, AddKey и Key превращают ключи любых типов (структуры,
+// составные ключи и т.д.) в строковые ключи кэша, - без перехода на обобщенный KCache.
+// fn должна быть детерминированной и инъективной: одинаковые ключи всегда дают одну строку,
+// а разные - разные строки. Если два разных ключа дадут одну строку, они будут считаться
+// одним ключом и затирать данные друг друга, и кэш этого не заметит. fn вызывается
+// вне блокировки кэша.
+// Без опции строка передается как есть, а другие значения превращаются в строку вида
+// "тип:значение" (fmt.Sprintf("%T:%#v")), например "main.point:main.point{X:1, Y:2}": это
+// различает значения разных типов, но не годится для ключей с указателями и картами (в строку
+// попадет адрес или порядок перебора) и совпадет со строковым ключом, равным такой строке.
+func WithKeyFunc(fn KeyFunc) Option {
+	return func(c *Cache) {
+		c.keyFunc = fn
+	}
+}
+
+// Вернет строковый ключ кэша для ключа key (см. WithKeyFunc) - например, чтобы передать
+// составной ключ в методы, принимающие строку: cache.Delete(cache.Key(k)).
+func (c *Cache) Key(key interface{}) string {
+	if c.keyFunc != nil {
+		return c.keyFunc(key)
+	}
+
+	if s, ok := key.(string); ok {
+		return s
+	}
+
+	return fmt.Sprintf("%T:%#v", key, key)
+}
+
+// Получение элемента по ключу любого типа, как Get для строки Key(key), но в отличие от Get
+// устаревший, еще не удаленный очисткой элемент не возвращается.
+// Если неустаревшего элемента нет (или это отрицательный результат), found == false.
+func (c *Cache) GetKey(key interface{}) (data interface{}, found bool) {
+	data, _, err := c.lookup(c.Key(key))
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// Добавление элемента по ключу любого типа, как Add для строки Key(key): только если
+// по ключу нет неустаревшего элемента, иначе вернет ErrKeyExists.
+func (c *Cache) AddKey(key interface{}, data interface{}, ttl time.Duration) error {
+	return c.Add(c.Key(key), data, ttl)
+}
@@ -0,0 +1,74 @@
+package candycache
+
+import "time"
+
+// Ожидание значения, которое вычисляет лидер (см. GetOrWait).
+type leaderWait struct {
+	done     chan struct{} // Закрывается, когда по ключу записано значение
+	deadline int64         // Момент в Unix-наносекундах, после которого лидер считается пропавшим
+}
+
+// Получение неустаревшего элемента с выбором лидера при промахе.
+// Если элемент есть, вернет его с found == true. Если нет, первый вызвавший становится лидером:
+// получает isLeader == true и должен сам вычислить значение и записать его (Set, Add и т.д.).
+// Остальные ждут этой записи не дольше timeout и получают записанное значение с found == true
+// либо, если лидер не успел, found == false. Если лидер не записал значение за timeout,
+// следующий вызов после этого срока становится новым лидером. Если ждущих вызовов уже столько,
+// сколько разрешает WithMaxWaiters, вызов не ждет и сразу вернет found == false.
+// В отличие от LoadingCache, загрузчик остается у вызывающего кода.
+func (c *Cache) GetOrWait(key string, timeout time.Duration) (data interface{}, isLeader bool, found bool) {
+	c.Lock()
+
+	now := c.now()
+	if item, ok := c.storage.Get(key); ok && !item.negative && !item.expired(now) {
+		c.stats.lookup(true)
+		c.hit(item)
+		data = c.copyData(item.data)
+		c.unlock()
+		return data, false, true
+	}
+	c.stats.lookup(false)
+
+	wait, waiting := c.waits[key]
+	if !waiting || wait.deadline <= now {
+		if c.waits == nil {
+			c.waits = make(map[string]*leaderWait)
+		}
+		c.waits[key] = &leaderWait{done: make(chan struct{}), deadline: now + int64(timeout)}
+		c.unlock()
+		return nil, true, false
+	}
+	c.unlock()
+
+	if !c.enterWait() {
+		return nil, false, false
+	}
+	defer c.exitWait()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-wait.done:
+	case <-timer.C:
+		return nil, false, false
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	item, ok := c.storage.Get(key)
+	if !ok || item.negative || item.expired(c.now()) {
+		return nil, false, false
+	}
+
+	return c.copyData(item.data), false, true
+}
+
+// Будит ждущих записи по ключу key (см. GetOrWait). Без блокировки.
+func (c *Cache) releaseWaiters(key string) {
+	if wait, found := c.waits[key]; found {
+		close(wait.done)
+		delete(c.waits, key)
+	}
+}
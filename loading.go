@@ -0,0 +1,487 @@
+package candycache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Типизированный кэш со сквозным чтением: при промахе Get сам загружает значение через loader
+// и кладет его в кэш. Остальные методы (Set, Delete, Has и т.д.) - как у KCache.
+type LoadingCache[K comparable, V any] struct {
+	*KCache[K, V]
+	loader   func(key K) (V, time.Duration, error) // Загружает значение и его время жизни
+	mu       sync.Mutex                            // Мьютекс для calls и failures
+	calls    map[K]*loadCall[V]                    // Идущие загрузки по ключам
+	failures map[K]loadFailure                     // Запомненные ошибки загрузки по ключам (см. SetErrorTTL)
+	errorTTL atomic.Int64                          // Сколько наносекунд помнить ошибку загрузки (0 - не помнить)
+	observer atomic.Pointer[LoadObserver]          // Получает сведения о вызовах Get (nil - никто, см. SetLoadObserver)
+}
+
+// Запомненная ошибка загрузки (см. LoadingCache.SetErrorTTL).
+type loadFailure struct {
+	err   error
+	until int64 // Момент в Unix-наносекундах, до которого ошибка возвращается без загрузки
+}
+
+// Идущая загрузка значения, которой ждут все одновременные Get по этому ключу.
+type loadCall[V any] struct {
+	done chan struct{} // Закрывается, когда загрузка завершена
+	data V
+	err  error
+}
+
+// Создает новый экземпляр LoadingCache с интервалом очистки cleanupInterval и загрузчиком loader.
+// loader возвращает значение для ключа и время его жизни (если ttl <= 0, значение никогда не устаревает).
+// Если cleanupInterval <= 0, то кэш не будет очищаться автоматически.
+func LoadingCacher[K comparable, V any](cleanupInterval time.Duration, loader func(key K) (V, time.Duration, error)) *LoadingCache[K, V] {
+	return &LoadingCache[K, V]{
+		KCache: KCacher[K, V](cleanupInterval),
+		loader: loader,
+		calls:  make(map[K]*loadCall[V]),
+	}
+}
+
+// Получение неустаревшего значения по ключу. При промахе значение загружается через loader
+// и кладется в кэш. Одновременные промахи по одному ключу ждут одной загрузки, поэтому loader
+// не вызывается для ключа повторно, пока идет его загрузка.
+// Ошибка загрузки возвращается всем ожидавшим и не кэшируется.
+func (c *LoadingCache[K, V]) Get(key K) (V, error) {
+	if data, found := c.get(key); found {
+		c.observe(key, true, false, time.Time{}, nil)
+		return data, nil
+	}
+
+	c.mu.Lock()
+	if call, found := c.calls[key]; found {
+		c.mu.Unlock()
+		start := time.Now()
+		<-call.done
+		c.observe(key, false, true, start, call.err)
+		return call.data, call.err
+	}
+
+	// Пока мы ждали мьютекс, значение могла загрузить другая горутина.
+	if data, found := c.get(key); found {
+		c.mu.Unlock()
+		c.observe(key, true, false, time.Time{}, nil)
+		return data, nil
+	}
+
+	if failure, found := c.failures[key]; found {
+		if failure.until > time.Now().UnixNano() {
+			c.mu.Unlock()
+			c.observe(key, true, false, time.Time{}, failure.err)
+			var zero V
+			return zero, failure.err
+		}
+		delete(c.failures, key)
+	}
+
+	call := &loadCall[V]{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.remember(key, call.err)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	start := time.Now()
+	data, ttl, err := c.loader(key)
+	call.data, call.err = data, err
+	if err == nil {
+		c.Set(key, data, ttl)
+	}
+	c.observe(key, false, false, start, err)
+
+	return data, err
+}
+
+// Задает сколько помнить ошибку загрузки, как WithErrorTTL для Cache: пока d не истекло,
+// Get по этому ключу сразу возвращает ту же ошибку (и нулевое значение), не вызывая loader,
+// чтобы промахи не добивали отказавший источник. Следующая удачная загрузка или Set по ключу
+// заменяет ошибку значением. Новое время действует для ошибок, случившихся после вызова.
+// Если d <= 0, ошибки не запоминаются (по умолчанию). Безопасно вызывать одновременно с Get.
+func (c *LoadingCache[K, V]) SetErrorTTL(d time.Duration) {
+	c.errorTTL.Store(int64(max(d, 0)))
+}
+
+// Запоминает ошибку загрузки err по ключу key (если SetErrorTTL задан) или забывает прежнюю,
+// если загрузка удалась, и заодно забывает устаревшие ошибки других ключей. Под мьютексом.
+func (c *LoadingCache[K, V]) remember(key K, err error) {
+	ttl := c.errorTTL.Load()
+	if err == nil || ttl <= 0 {
+		delete(c.failures, key)
+		return
+	}
+
+	now := time.Now().UnixNano()
+	for k, failure := range c.failures {
+		if failure.until <= now {
+			delete(c.failures, k)
+		}
+	}
+
+	if c.failures == nil {
+		c.failures = make(map[K]loadFailure)
+	}
+	c.failures[key] = loadFailure{err: err, until: now + ttl}
+}
+
+// Задает функцию, которая получает сведения о каждом вызове Get, как WithLoadObserver
+// для Cache; ключ передается в LoadEvent.Keys в формате fmt.Sprint. nil отключает передачу.
+// Безопасно вызывать одновременно с Get.
+func (c *LoadingCache[K, V]) SetLoadObserver(fn LoadObserver) {
+	if fn == nil {
+		c.observer.Store(nil)
+		return
+	}
+
+	c.observer.Store(&fn)
+}
+
+// Передает событие вызова Get по ключу key в функцию SetLoadObserver, если она задана.
+func (c *LoadingCache[K, V]) observe(key K, hit, shared bool, start time.Time, err error) {
+	if fn := c.observer.Load(); fn != nil {
+		observeKey(*fn, fmt.Sprint(key), hit, shared, start, err)
+	}
+}
+
+// Получение неустаревшего значения по ключу со сквозным чтением без отдельного загрузчика:
+// при промахе вызывает load, кладет результат в кэш на время ttl (если ttl <= 0, значение
+// никогда не устаревает) и возвращает его. Одновременные промахи по одному ключу ждут одной
+// загрузки, поэтому load не вызывается для ключа повторно, пока идет его загрузка.
+// Ошибка загрузки возвращается всем ожидавшим, и в кэш ничего не записывается. Если ждущих вызовов
+// уже столько, сколько разрешает WithMaxWaiters, вызов не ждет чужой загрузки и вернет ErrTooManyWaiters.
+// Устаревшие элементы и отрицательные результаты (AddNegative) считаются промахом.
+// С WithFallback перед вызовом load элемент ищется в следующих уровнях кэша, а загруженное
+// значение записывается во все уровни. С WithErrorTTL ошибка загрузки запоминается, и пока
+// она не устарела, GetOrLoad по этому ключу возвращает ее, не вызывая load.
+func (c *Cache) GetOrLoad(key string, ttl time.Duration, load func() (interface{}, error)) (interface{}, error) {
+	if data, found, err := c.getLoaded(key, true); found {
+		observeKey(c.observeLoad, key, true, false, time.Time{}, err)
+		return data, err
+	}
+
+	c.loadMu.Lock()
+	if call, found := c.loads[key]; found {
+		c.loadMu.Unlock()
+		if !c.enterWait() {
+			return nil, ErrTooManyWaiters
+		}
+		defer c.exitWait()
+
+		start := time.Now()
+		<-call.done
+		observeKey(c.observeLoad, key, false, true, start, call.err)
+		return c.copyData(call.data), call.err
+	}
+
+	// Пока мы ждали мьютекс, значение могла загрузить другая горутина. Промах уже учтен
+	// первой проверкой, поэтому повторная в статистику не попадает.
+	if data, found, err := c.getLoaded(key, false); found {
+		c.loadMu.Unlock()
+		observeKey(c.observeLoad, key, true, false, time.Time{}, err)
+		return data, err
+	}
+
+	call := &loadCall[interface{}]{done: make(chan struct{})}
+	if c.loads == nil {
+		c.loads = make(map[string]*loadCall[interface{}])
+	}
+	c.loads[key] = call
+	c.loadMu.Unlock()
+
+	defer func() {
+		c.loadMu.Lock()
+		delete(c.loads, key)
+		c.loadMu.Unlock()
+		close(call.done)
+	}()
+
+	// Следующие уровни (WithFallback) проверяются до загрузчика, пока одновременные вызовы ждут.
+	if c.fallback != nil {
+		if data, _, err := c.promote(key); err == nil {
+			call.data = data
+			observeKey(c.observeLoad, key, true, false, time.Time{}, nil)
+			return data, nil
+		}
+	}
+
+	start := time.Now()
+	data, err := load()
+	call.data, call.err = data, err
+	if err == nil {
+		c.setThrough(key, data, ttl)
+	} else {
+		c.rememberError(key, err)
+	}
+	observeKey(c.observeLoad, key, false, false, start, err)
+
+	return data, err
+}
+
+// Сквозное чтение по схеме stale-while-revalidate: как GetOrLoad, но устаревший, еще не удаленный
+// очисткой элемент (см. GetAllowStale) возвращается сразу с stale == true, а load для него
+// вызывается в фоне, и новое значение записывается в кэш на время ttl. Пока фоновая загрузка
+// идет, следующие чтения тоже получают устаревшее значение и новую загрузку не начинают,
+// а GetOrLoad по ключу дожидается ее, как чужой загрузки. Ошибка фоновой загрузки никому
+// не возвращается и не запоминается (WithErrorTTL): устаревшее значение остается, и следующее
+// чтение попробует снова. Неустаревший элемент возвращается с stale == false, а при промахе
+// load вызывается синхронно, как в GetOrLoad.
+func (c *Cache) GetStaleOrLoad(key string, ttl time.Duration, load func() (interface{}, error)) (data interface{}, stale bool, err error) {
+	c.RLock()
+	item, found := c.storage.Get(key)
+	if found && !item.negative && item.expired(c.now()) {
+		c.stats.lookup(true)
+		item.hit()
+		data := c.copyData(item.data)
+		c.RUnlock()
+
+		c.refreshAhead(key, ttl, load)
+		return data, true, nil
+	}
+	c.RUnlock()
+
+	data, err = c.GetOrLoad(key, ttl, load)
+	return data, false, err
+}
+
+// Запускает фоновую загрузку значения по ключу key функцией load, если по ключу еще не идет
+// загрузка (см. GetStaleOrLoad).
+func (c *Cache) refreshAhead(key string, ttl time.Duration, load func() (interface{}, error)) {
+	c.loadMu.Lock()
+	if _, found := c.loads[key]; found {
+		c.loadMu.Unlock()
+		return
+	}
+
+	call := &loadCall[interface{}]{done: make(chan struct{})}
+	if c.loads == nil {
+		c.loads = make(map[string]*loadCall[interface{}])
+	}
+	c.loads[key] = call
+	c.loadMu.Unlock()
+
+	go func() {
+		defer func() {
+			c.loadMu.Lock()
+			delete(c.loads, key)
+			c.loadMu.Unlock()
+			close(call.done)
+		}()
+
+		start := time.Now()
+		data, err := load()
+		call.data, call.err = data, err
+		if err == nil {
+			c.setThrough(key, data, ttl)
+		}
+		observeKey(c.observeLoad, key, false, false, start, err)
+	}()
+}
+
+// Задает сколько GetOrLoad помнит ошибку загрузки: если load вернул ошибку, по ключу на время d
+// записывается отрицательный результат с этой ошибкой, и пока он не устарел, GetOrLoad по ключу
+// сразу возвращает ту же ошибку, не вызывая load, - так промахи не устраивают шторм повторных
+// запросов к отказавшему источнику. Удачная загрузка после этого срока (или Set по ключу)
+// заменяет запомненную ошибку значением. Для остальных методов такой элемент - обычный
+// отрицательный результат (AddNegative): Get вернет ErrNegative, GetOrLoadMany ошибки
+// не запоминает и такие ключи пропускает. Дампы сохраняют элемент без ошибки, и после загрузки
+// дампа GetOrLoad снова вызывает load. Если d <= 0, ошибки не запоминаются (по умолчанию).
+func WithErrorTTL(d time.Duration) Option {
+	return func(c *Cache) {
+		c.errorTTL = max(d, 0)
+	}
+}
+
+// Получение неустаревшего положительного значения по ключу, как getLive, а с WithErrorTTL -
+// и запомненной ошибки загрузки. found - найдено ли значение или ошибка.
+// Если record == false, обращение не учитывается в Stats и GhostHits.
+func (c *Cache) getLoaded(key string, record bool) (data interface{}, found bool, err error) {
+	if data, found := c.getLive(key, record); found {
+		return data, true, nil
+	}
+
+	if c.errorTTL <= 0 {
+		return nil, false, nil
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	item, found := c.storage.Get(key)
+	if !found || item.loadErr == nil || item.expired(c.now()) {
+		return nil, false, nil
+	}
+
+	return nil, true, item.loadErr
+}
+
+// Запоминает ошибку загрузки err по ключу key на время WithErrorTTL, если оно задано.
+// В закрытый и запечатанный кэш ничего не записывается.
+func (c *Cache) rememberError(key string, err error) {
+	if c.errorTTL <= 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.unlock()
+
+	if c.sealed {
+		return
+	}
+
+	item := c.newItem(nil, c.errorTTL)
+	item.negative = true
+	item.loadErr = err
+	c.store(key, item)
+}
+
+// Получение неустаревшего положительного значения по ключу.
+// Если record == false, обращение не учитывается в Stats и GhostHits.
+func (c *Cache) getLive(key string, record bool) (interface{}, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	item, found := c.storage.Get(key)
+	found = found && !item.negative && !item.expired(c.now()) && !c.expiresEarly(item)
+	if record {
+		c.stats.lookup(found)
+	}
+
+	if !found {
+		if record {
+			c.ghostMiss(key)
+		}
+		return nil, false
+	}
+
+	c.hit(item)
+
+	return c.copyData(item.data), true
+}
+
+// Пакетное сквозное чтение: возвращает данные неустаревших элементов с ключами keys, а для
+// отсутствующих и устаревших один раз вызывает loadMissing со списком только этих ключей
+// (каждый ключ - один раз, например, для одного запроса IN (...) к базе), кладет загруженное
+// в кэш на время ttl и возвращает все вместе. Ключи, которые loadMissing не вернул, в результат
+// не попадают; закэшированные отрицательные результаты (AddNegative) не загружаются и в результат
+// не попадают, как в GetManyWithMisses.
+// Ключи, которые уже загружаются другим GetOrLoad или GetOrLoadMany, не передаются в loadMissing:
+// вызов дожидается той загрузки (если ждущих вызовов уже столько, сколько разрешает WithMaxWaiters,
+// такие ключи пропускаются, и вернется ErrTooManyWaiters). Если загрузка вернула ошибку,
+// вернутся уже найденные данные и эта ошибка, а в кэш ничего из этой загрузки не записывается.
+func (c *Cache) GetOrLoadMany(keys []string, ttl time.Duration, loadMissing func(missing []string) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	found, missed := c.GetManyWithMisses(keys)
+	if len(missed) == 0 {
+		return found, nil
+	}
+
+	own := make(map[string]*loadCall[interface{}], len(missed))
+	waiting := make(map[string]*loadCall[interface{}])
+	load := make([]string, 0, len(missed))
+
+	c.loadMu.Lock()
+	if c.loads == nil {
+		c.loads = make(map[string]*loadCall[interface{}])
+	}
+	for _, key := range missed {
+		if _, dup := own[key]; dup {
+			continue
+		}
+
+		if call, found := c.loads[key]; found {
+			waiting[key] = call
+			continue
+		}
+
+		call := &loadCall[interface{}]{done: make(chan struct{})}
+		c.loads[key] = call
+		own[key] = call
+		load = append(load, key)
+	}
+	c.loadMu.Unlock()
+
+	// Свои загрузки завершаются до ожидания чужих, иначе два встречных вызова
+	// ждали бы друг друга.
+	err := c.loadMany(load, own, ttl, loadMissing, found)
+
+	for key, call := range waiting {
+		if !c.enterWait() {
+			if err == nil {
+				err = ErrTooManyWaiters
+			}
+			continue
+		}
+
+		start := time.Now()
+		<-call.done
+		c.exitWait()
+		observeKey(c.observeLoad, key, false, true, start, call.err)
+
+		switch {
+		case call.err == nil:
+			found[key] = c.copyData(call.data)
+		case err == nil && call.err != ErrKeyNotFound:
+			err = call.err
+		}
+	}
+
+	return found, err
+}
+
+// Загружает ключи keys через loadMissing, записывает результат в кэш и в found и завершает
+// загрузки own, которых ждут другие вызовы. Ключам, которые loadMissing не вернул,
+// ожидающие GetOrLoad получают ErrKeyNotFound.
+func (c *Cache) loadMany(keys []string, own map[string]*loadCall[interface{}], ttl time.Duration, loadMissing func(missing []string) (map[string]interface{}, error), found map[string]interface{}) (err error) {
+	defer func() {
+		c.loadMu.Lock()
+		for key, call := range own {
+			delete(c.loads, key)
+			close(call.done)
+		}
+		c.loadMu.Unlock()
+	}()
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	loaded, err := loadMissing(keys)
+	if err != nil {
+		for _, call := range own {
+			call.err = err
+		}
+		c.observe(LoadEvent{Keys: keys, Start: start, Duration: time.Since(start), Err: err})
+		return err
+	}
+
+	c.Lock()
+	defer func() {
+		c.unlock()
+		c.observe(LoadEvent{Keys: keys, Start: start, Duration: time.Since(start)})
+	}()
+
+	for key, call := range own {
+		data, ok := loaded[key]
+		if !ok {
+			call.err = ErrKeyNotFound
+			continue
+		}
+
+		call.data = data
+		found[key] = data
+		if !c.sealed {
+			c.set(key, data, ttl)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package candycache
+
+import "sync"
+
+// Блокировка кэша: по умолчанию sync.RWMutex, с WithoutLocking - пустая.
+// Набор методов повторяет sync.RWMutex, который раньше был встроен в Cache, поэтому
+// у Cache остаются все его методы, в том числе RLocker.
+type locker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+	TryLock() bool
+	TryRLock() bool
+	RLocker() sync.Locker
+}
+
+// Пустая блокировка, которая ничего не делает (см. WithoutLocking).
+type noLock struct{}
+
+func (noLock) Lock()          {}
+func (noLock) Unlock()        {}
+func (noLock) RLock()         {}
+func (noLock) RUnlock()       {}
+func (noLock) TryLock() bool  { return true }
+func (noLock) TryRLock() bool { return true }
+
+func (noLock) RLocker() sync.Locker { return noLock{} }
+
+// Отключает блокировку кэша: методы кэша больше не берут мьютекс и не выполняют атомарных
+// операций ради него, что ускоряет кэш в одной горутине.
+// Счетчики статистики, попаданий (Item.Hits) и отметки обращений при этом остаются атомарными:
+// это одна-две атомарные операции без конкуренции на каждое чтение.
+//
+// ВНИМАНИЕ: такой кэш НЕБЕЗОПАСНО использовать из нескольких горутин одновременно - это
+// гонка данных, которая может повредить хранилище или уронить программу. Используйте опцию,
+// только если к кэшу обращается одна горутина или доступ синхронизирован снаружи.
+// Автоматическая очистка такого кэша не запускается (она работает в отдельной горутине),
+// поэтому устаревшие элементы нужно удалять через Cleanup. По той же причине к нему нельзя
+// подключать InvalidationBus, а GetOrWait и WaitEmpty не дождутся других горутин.
+func WithoutLocking() Option {
+	return func(c *Cache) {
+		c.locker = noLock{}
+	}
+}
@@ -0,0 +1,67 @@
+package candycache
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Компилирует шаблон ключа в регулярное выражение.
+// Грамматика шаблона: '*' - любая последовательность символов (в том числе пустая),
+// '?' - ровно один символ (руна UTF-8), все остальные символы означают сами себя.
+// Экранирования и классов символов нет.
+func compileGlob(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+
+	expr.WriteString(`(?s)^`)
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(`.*`)
+		case '?':
+			expr.WriteString(`.`)
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString(`$`)
+
+	return regexp.MustCompile(expr.String())
+}
+
+// Возвращает все элементы кэша (включая устаревшие), ключи которых подходят под шаблон pattern.
+// '*' в шаблоне означает любую последовательность символов (в том числе пустую),
+// '?' - ровно один символ, все остальные символы означают сами себя.
+func (c *Cache) Match(pattern string) []KeyItemPair {
+	re := compileGlob(pattern)
+
+	c.RLock()
+	defer c.RUnlock()
+
+	items := []KeyItemPair{}
+	for key, item := range c.storage.Range {
+		if re.MatchString(key) {
+			items = append(items, KeyItemPair{Key: key, Item: item})
+		}
+	}
+
+	return items
+}
+
+// Удаляет все элементы кэша (включая устаревшие), ключи которых подходят под шаблон pattern.
+// Грамматика шаблона такая же, как в Match. Вернет количество удаленных элементов.
+func (c *Cache) DeleteMatch(pattern string) int {
+	re := compileGlob(pattern)
+
+	c.Lock()
+	defer c.unlock()
+
+	deleted := 0
+	for key, item := range c.storage.Range {
+		if re.MatchString(key) {
+			c.remove(key, item, EvictDeleted)
+			deleted++
+		}
+	}
+
+	return deleted
+}
@@ -0,0 +1,40 @@
+package candycache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Счетчик обернутых функций, чтобы ключи разных функций не пересекались.
+var memoizeID atomic.Uint64
+
+// Оборачивает функцию fn так, что ее результаты кэшируются в c на время ttl.
+// Ключ строится из номера обертки и аргументов в формате %#v, поэтому
+// разные обертки (даже одной и той же функции) не делят результаты между собой.
+// Аргументы с одинаковым представлением %#v считаются одинаковыми: например, для указателей
+// в ключ попадает адрес, а не значение, а значения типов со своим методом GoString могут совпасть.
+// Ошибки не кэшируются - при ошибке fn будет вызвана снова при следующем вызове.
+// Одновременные вызовы с одинаковыми аргументами при промахе могут вызвать fn несколько раз.
+func Memoize[T any](c *Cache, ttl time.Duration, fn func(args ...interface{}) (T, error)) func(args ...interface{}) (T, error) {
+	id := memoizeID.Add(1)
+
+	return func(args ...interface{}) (T, error) {
+		key := fmt.Sprintf("candycache.memoize:%d:%#v", id, args)
+
+		if data, err := c.Get(key); err == nil {
+			if result, ok := data.(T); ok {
+				return result, nil
+			}
+		}
+
+		result, err := fn(args...)
+		if err != nil {
+			return result, err
+		}
+
+		c.Set(key, result, ttl)
+
+		return result, nil
+	}
+}
@@ -0,0 +1,82 @@
+package candycache
+
+import "unsafe"
+
+// Атомарно переносит неустаревший элемент с ключом key из кэша c в кэш dst: удаляет его из c
+// (обработчик удаления вызывается как при Delete) и записывает в dst с тем же оставшимся
+// временем жизни, метками, стоимостью и защитой. Зависимости, заморозка и счетчик попаданий
+// не переносятся. Элемент с тем же ключом в dst заменяется.
+// Оба кэша блокируются на запись в одном и том же порядке, поэтому встречные переносы
+// между двумя кэшами не приводят к взаимной блокировке.
+// Вернет false, если элемента нет, он устарел или dst не принял его (ErrCacheFull, ErrClosed) -
+// тогда элемент остается в c. Если c или dst запечатан (Seal), паникует с ErrSealed,
+// не изменив ни один из кэшей.
+func (c *Cache) MoveTo(dst *Cache, key string) bool {
+	return c.transfer(dst, key, true, true)
+}
+
+// Атомарно копирует неустаревший элемент с ключом key из кэша c в кэш dst так же, как MoveTo,
+// но оставляет его в c. Вернет false, если элемента нет, он устарел или dst не принял его.
+func (c *Cache) CopyTo(dst *Cache, key string) bool {
+	return c.transfer(dst, key, false, true)
+}
+
+// Переносит (move == true) или копирует элемент с ключом key из c в dst.
+// Если replace == false и в dst уже есть неустаревший элемент с ключом key, он не заменяется,
+// а элемент из c при переносе просто удаляется; тогда вернет false.
+func (c *Cache) transfer(dst *Cache, key string, move, replace bool) bool {
+	if c == dst {
+		return c.Has(key)
+	}
+
+	first, second := c, dst
+	if uintptr(unsafe.Pointer(first)) > uintptr(unsafe.Pointer(second)) {
+		first, second = second, first
+	}
+	first.Lock()
+	defer first.unlock()
+	second.Lock()
+	defer second.unlock()
+
+	// Удаление из c идет после записи в dst, поэтому печать c проверяется до любых изменений.
+	if move {
+		c.checkSealed()
+	}
+
+	now := c.now()
+	item, found := c.storage.Get(key)
+	if !found || item.expired(now) {
+		return false
+	}
+
+	dstNow := dst.now()
+	if existing, found := dst.storage.Get(key); !replace && found && !existing.expired(dstNow) {
+		if move {
+			c.remove(key, item, EvictReplaced)
+		}
+		return false
+	}
+
+	moved := Item{
+		createdAt: dstNow - (now - item.createdAt),
+		negative:  item.negative,
+		version:   dst.nextVersion(),
+		protected: item.protected,
+		tags:      item.tags,
+		cost:      item.cost,
+		data:      dst.copyData(item.data),
+	}
+	if item.destroyTimestamp != 0 {
+		moved.destroyTimestamp = dstNow + (item.destroyTimestamp - now)
+	}
+
+	if err := dst.store(key, moved); err != nil {
+		return false
+	}
+
+	if move {
+		c.remove(key, item, EvictDeleted)
+	}
+
+	return true
+}
@@ -0,0 +1,237 @@
+package candycache
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Пространство имен - представление кэша, в котором ко всем ключам добавляется префикс.
+// Позволяет нескольким независимым частям программы (например, арендаторам)
+// делить один кэш, не пересекаясь по ключам и не вытесняя элементы друг друга сверх своей квоты.
+type Namespace struct {
+	cache      *Cache
+	prefix     string
+	maxItems   int
+	defaultTTL atomic.Int64 // Время жизни для записей с ttl == 0 в наносекундах (0 - не задано, см. SetDefaultTTL)
+	maxTTL     atomic.Int64 // Наибольшее время жизни записей в наносекундах (0 - не ограничено, см. SetMaxTTL)
+}
+
+// Возвращает пространство имен с префиксом prefix.
+// Ключ относится к пространству с самым длинным подходящим префиксом среди созданных через
+// Namespace, как в NamespaceUsage: ключи пространства "a:b:" не входят в пространство "a:",
+// поэтому его Count, Keys, Flush и квота их не затрагивают.
+// Если maxItems > 0, в пространстве не может быть больше maxItems элементов: при добавлении
+// нового ключа в заполненное пространство из него вытесняется незащищенный элемент этого же
+// пространства, к которому дольше всех не обращались (LRU), а с WithEvictionComparator или
+// WithFIFOEviction - первый по заданному порядку. Элементы других пространств не затрагиваются.
+// Для этого пространство с квотой включает отметки обращений к элементам (как WithAccessTracking,
+// но порядок Evict не меняется); элементы, записанные раньше, считаются неиспользуемыми с момента
+// добавления. Общие ограничения кэша (WithCapacity и т.д.) действуют поверх квоты.
+// Подсчет элементов пространства перебирает весь кэш, то есть работает за O(n).
+// Кэш запоминает префикс пространства для WithFairNamespaceEviction и NamespaceUsage.
+func (c *Cache) Namespace(prefix string, maxItems int) *Namespace {
+	c.Lock()
+	c.registerNamespace(prefix)
+	if maxItems > 0 {
+		c.quotaTracking = true
+	}
+	c.Unlock()
+
+	return &Namespace{cache: c, prefix: prefix, maxItems: maxItems}
+}
+
+// Задает время жизни, с которым Set и Add этого пространства записывают элементы, если передан
+// ttl == 0; отрицательный ttl по-прежнему означает, что элемент никогда не устаревает. Если d <= 0,
+// время жизни по умолчанию не задано, и ttl == 0 тоже означает "никогда".
+// Настройка меняется атомарно и действует на следующие записи, в том числе из других горутин;
+// уже записанные элементы сохраняют свой срок, пока их не перезапишут или не продлят.
+// Настройка принадлежит этому значению *Namespace: другие пространства, в том числе полученные
+// повторным вызовом Cache.Namespace с тем же префиксом, ее не видят.
+func (n *Namespace) SetDefaultTTL(d time.Duration) {
+	n.defaultTTL.Store(int64(max(d, 0)))
+}
+
+// Ограничивает время жизни элементов, которые записывают Set и Add этого пространства: элемент,
+// который устарел бы позже чем через d или никогда, устареет через d от момента записи, как с
+// WithMaxTTL для всего кэша (общий WithMaxTTL и правила WithPrefixPolicy действуют поверх).
+// Если d <= 0, ограничения нет. Настройка меняется атомарно, действует на следующие записи
+// и принадлежит этому значению *Namespace, как SetDefaultTTL.
+func (n *Namespace) SetMaxTTL(d time.Duration) {
+	n.maxTTL.Store(int64(max(d, 0)))
+}
+
+// Вернет время жизни записи в пространство с учетом SetDefaultTTL и SetMaxTTL.
+func (n *Namespace) ttl(ttl time.Duration) time.Duration {
+	if d := time.Duration(n.defaultTTL.Load()); ttl == 0 && d > 0 {
+		ttl = d
+	}
+
+	if limit := time.Duration(n.maxTTL.Load()); limit > 0 && (ttl <= 0 || ttl > limit) {
+		ttl = limit
+	}
+
+	return ttl
+}
+
+// Получение элемента из пространства по ключу.
+func (n *Namespace) Get(key string) (interface{}, error) {
+	return n.cache.Get(n.prefix + key)
+}
+
+// Определяет есть ли в пространстве неустаревший элемент с ключом key.
+func (n *Namespace) Has(key string) bool {
+	return n.cache.Has(n.prefix + key)
+}
+
+// Добавление элемента в пространство.
+// Если места для элемента не нашлось, элемент не будет добавлен.
+func (n *Namespace) Set(key string, data interface{}, ttl time.Duration) {
+	c := n.cache
+
+	c.Lock()
+	defer c.unlock()
+
+	if n.admit(n.prefix+key) == nil {
+		c.set(n.prefix+key, data, n.ttl(ttl))
+	}
+}
+
+// Добавление элемента в пространство, только если по ключу key нет неустаревшего элемента.
+// Если элемент уже есть, вернет ErrKeyExists, если места нет - ErrCacheFull.
+func (n *Namespace) Add(key string, data interface{}, ttl time.Duration) error {
+	c := n.cache
+
+	c.Lock()
+	defer c.unlock()
+
+	if item, found := c.storage.Get(n.prefix + key); found && !item.expired(c.now()) {
+		return ErrKeyExists
+	}
+
+	if err := n.admit(n.prefix + key); err != nil {
+		return err
+	}
+
+	return c.set(n.prefix+key, data, n.ttl(ttl))
+}
+
+// Удаление элемента из пространства по ключу.
+func (n *Namespace) Delete(key string) error {
+	return n.cache.Delete(n.prefix + key)
+}
+
+// Удаляет все элементы пространства. Вернет количество удаленных элементов.
+func (n *Namespace) Flush() int {
+	c := n.cache
+
+	c.Lock()
+	defer c.unlock()
+
+	deleted := 0
+	for key, item := range c.storage.Range {
+		if n.owns(key) {
+			c.remove(key, item, EvictDeleted)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// Вернет количество элементов в пространстве.
+func (n *Namespace) Count() int {
+	n.cache.RLock()
+	defer n.cache.RUnlock()
+
+	return n.count()
+}
+
+// Возвращает список ключей всех элементов пространства (без префикса).
+func (n *Namespace) Keys() []string {
+	n.cache.RLock()
+	defer n.cache.RUnlock()
+
+	keys := []string{}
+	for key := range n.cache.storage.Range {
+		if n.owns(key) {
+			keys = append(keys, key[len(n.prefix):])
+		}
+	}
+
+	return keys
+}
+
+// Определяет относится ли ключ key к пространству: из зарегистрированных префиксов
+// ему подходит как самый длинный именно префикс пространства. Под блокировкой.
+func (n *Namespace) owns(key string) bool {
+	return strings.HasPrefix(key, n.prefix) && n.cache.namespaceOf(key) == n.prefix
+}
+
+// Считает элементы пространства без блокировки.
+func (n *Namespace) count() int {
+	count := 0
+	for key := range n.cache.storage.Range {
+		if n.owns(key) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Определяет должен ли кандидат a вытесняться по квоте пространства раньше кандидата b:
+// без своего порядка вытеснения раньше вытесняется тот, к которому дольше не обращались.
+func (n *Namespace) evictsFirst(a, b EvictionCandidate) bool {
+	c := n.cache
+	if c.evictionLess == nil && !c.fifo {
+		return EvictByLRU(a, b)
+	}
+
+	return c.evictsFirst(a, b)
+}
+
+// Освобождает в пространстве место для нового элемента с ключом key, если квота исчерпана.
+// Без блокировки. Если освободить место нельзя, вернет ErrCacheFull.
+func (n *Namespace) admit(key string) error {
+	c := n.cache
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	if n.maxItems <= 0 {
+		return nil
+	}
+
+	if _, found := c.storage.Get(key); found {
+		return nil
+	}
+
+	for n.count() >= n.maxItems {
+		var victim EvictionCandidate
+		found := false
+
+		now := c.now()
+		for key, item := range c.storage.Range {
+			if item.protected || !n.owns(key) {
+				continue
+			}
+
+			candidate := c.candidate(key, item, -1, now)
+			if !found || n.evictsFirst(candidate, victim) {
+				victim = candidate
+				found = true
+			}
+		}
+
+		if !found {
+			return ErrCacheFull
+		}
+
+		c.remove(victim.Key, victim.Item, EvictEvicted)
+		c.stats.evicted.Add(1)
+	}
+
+	return nil
+}
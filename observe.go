@@ -0,0 +1,57 @@
+package candycache
+
+import "time"
+
+// Сведения об одном вызове сквозного чтения (GetOrLoad, GetOrLoadMany, LoadingCache.Get)
+// для WithLoadObserver.
+type LoadEvent struct {
+	Keys     []string      // Ключ GetOrLoad и LoadingCache.Get или ключи, которые GetOrLoadMany передал загрузчику
+	Hit      bool          // Значение нашлось в кэше, загрузчик не вызывался
+	Shared   bool          // Вызов дождался чужой загрузки того же ключа, а не загружал сам
+	Start    time.Time     // Когда началась загрузка или ожидание (для попадания - момент вызова)
+	Duration time.Duration // Сколько длилась загрузка или ожидание (для попадания - 0)
+	Err      error         // Ошибка загрузки (nil - загрузка удалась)
+}
+
+// Функция, которую кэш вызывает после каждого вызова сквозного чтения (см. WithLoadObserver).
+type LoadObserver func(event LoadEvent)
+
+// Задает функцию, которая получает сведения о каждом вызове GetOrLoad и GetOrLoadMany:
+// попадание или промах, длительность загрузчика и его ошибку, - например, чтобы записать
+// span трассировки (OpenTelemetry и т.п.) или метрику длительности промахов, не делая кэш
+// зависимым от библиотек трассировки. GetOrLoadMany сообщает об одном событии на вызов
+// загрузчика и об одном на каждый ключ, чужой загрузки которого он дождался, и ничего
+// не сообщает, если все ключи нашлись. Контекст вызова кэш не знает, поэтому span
+// по событию записывается задним числом по Start и Duration. fn вызывается синхронно
+// в горутине вызывающего, вне блокировки кэша, после того как результат записан в кэш,
+// поэтому должна быть быстрой. По умолчанию сведения никуда не передаются.
+func WithLoadObserver(fn LoadObserver) Option {
+	return func(c *Cache) {
+		c.observeLoad = fn
+	}
+}
+
+// Передает событие сквозного чтения в WithLoadObserver, если он задан.
+func (c *Cache) observe(event LoadEvent) {
+	if c.observeLoad != nil {
+		c.observeLoad(event)
+	}
+}
+
+// Передает в fn (если она задана) событие вызова по одному ключу key: попадание (hit),
+// ожидание чужой загрузки (shared) или своя загрузка, начавшиеся в start и завершившиеся с err.
+// Для попадания start не нужен.
+func observeKey(fn LoadObserver, key string, hit, shared bool, start time.Time, err error) {
+	if fn == nil {
+		return
+	}
+
+	event := LoadEvent{Keys: []string{key}, Hit: hit, Shared: shared, Start: start, Err: err}
+	if hit {
+		event.Start = time.Now()
+	} else {
+		event.Duration = time.Since(start)
+	}
+
+	fn(event)
+}
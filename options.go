@@ -0,0 +1,129 @@
+package candycache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Параметры отдельного элемента, задаваемые через AddOpts.
+type itemOptions struct {
+	now              int64 // Момент добавления по часам кэша
+	destroyTimestamp int64
+	tags             []string
+	protected        bool
+	cost             int64
+	onExpired        EvictedFunc
+	idleTTL          time.Duration
+}
+
+// Опция, настраивающая отдельный элемент при добавлении через AddOpts.
+type ItemOption func(*itemOptions)
+
+// Задает время жизни элемента. Если ttl <= 0, элемент никогда не устаревает.
+func WithItemTTL(ttl time.Duration) ItemOption {
+	return func(o *itemOptions) {
+		o.destroyTimestamp = deadline(o.now, ttl)
+	}
+}
+
+// Задает скользящее время жизни: элемент устаревает, если к нему не обращались d - каждое
+// попадание (Get, TryGet, GetMany, GetOrLoad и т.д.) отсчитывает d заново от момента обращения.
+// Вместе с WithMaxLifetime (или WithItemTTL, WithItemDeadline) элемент устаревает тогда, что
+// наступит раньше: истечет d без обращений или будет достигнут предельный срок, - поэтому
+// постоянно читаемый элемент не живет вечно. Без них элемент устаревает только без обращений.
+// Продление (GetExtend, GetRefresh, TouchMany) сдвигает только предельный срок, а Item.ExpiresAt,
+// TTLHistogram и адаптивная очистка не учитывают скользящее время жизни и показывают предельный
+// срок. Замена элемента (Set и т.д.), перенос (MoveTo) и дампы скользящее время жизни не сохраняют.
+// Устаревший элемент со скользящим временем жизни (по любому из сроков) сразу перестает
+// находиться при чтении, в том числе через Get и TryGet, которые отдают прочие устаревшие,
+// но еще не удаленные элементы, и обращение к нему его не оживляет; удаляет его очистка.
+// Если d <= 0, скользящего времени жизни нет.
+func WithIdleTTL(d time.Duration) ItemOption {
+	return func(o *itemOptions) {
+		o.idleTTL = max(d, 0)
+	}
+}
+
+// Задает предельный срок жизни элемента от момента добавления, который не продлевается
+// обращениями, - то же, что WithItemTTL, в паре с WithIdleTTL. Если d <= 0, срок не ограничен.
+func WithMaxLifetime(d time.Duration) ItemOption {
+	return WithItemTTL(d)
+}
+
+// Задает момент, когда элемент станет устаревшим.
+// Нулевое время означает, что элемент никогда не устаревает.
+func WithItemDeadline(at time.Time) ItemOption {
+	return func(o *itemOptions) {
+		if at.IsZero() {
+			o.destroyTimestamp = 0
+		} else {
+			o.destroyTimestamp = at.UnixNano()
+		}
+	}
+}
+
+// Задает метки элемента (см. Item.Tags).
+func WithItemTags(tags ...string) ItemOption {
+	return func(o *itemOptions) {
+		o.tags = append([]string(nil), tags...)
+	}
+}
+
+// Защищает элемент от вытеснения ради ограничений размера кэша, как AddWithPriority.
+func WithItemPriority(protected bool) ItemOption {
+	return func(o *itemOptions) {
+		o.protected = protected
+	}
+}
+
+// Задает стоимость элемента - например, сколько стоит получить его заново (см. Item.Cost).
+// Для WithEarlyExpiration стоимость - время пересчета элемента в наносекундах.
+func WithItemCost(cost int64) ItemOption {
+	return func(o *itemOptions) {
+		o.cost = cost
+	}
+}
+
+// Задает обработчик, который вызывается один раз, когда именно этот элемент устареет
+// и будет удален очисткой (Cleanup, автоматической очисткой или WithSweepOnFull) - например,
+// для одноразового таймера. При удалении элемента по другой причине (Delete, вытеснение,
+// Flush, замена через Set и т.д.) обработчик не вызывается. Обработчик вызывается вне
+// блокировки кэша, до общих обработчиков WithOnEvicted и WithOnEvictedReason.
+func WithItemExpiryCallback(fn EvictedFunc) ItemOption {
+	return func(o *itemOptions) {
+		o.onExpired = fn
+	}
+}
+
+// Добавление элемента в кэш с параметрами, заданными опциями, только если по ключу key
+// нет неустаревшего элемента, как в Add. Если время жизни не задано ни WithItemTTL,
+// ни WithItemDeadline, элемент никогда не устаревает. Если одна и та же характеристика
+// задана несколькими опциями, действует последняя.
+// Если элемент уже есть, вернет ErrKeyExists, если места нет - ErrCacheFull.
+func (c *Cache) AddOpts(key string, data interface{}, opts ...ItemOption) error {
+	options := itemOptions{now: c.now()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	c.Lock()
+	defer c.unlock()
+
+	if item, found := c.storage.Get(key); found && !item.expired(c.now()) {
+		return ErrKeyExists
+	}
+
+	item := c.newItem(data, 0)
+	item.destroyTimestamp = options.destroyTimestamp
+	item.tags = options.tags
+	item.protected = options.protected
+	item.cost = options.cost
+	item.onExpired = options.onExpired
+	if options.idleTTL > 0 {
+		item.idleTTL = int64(options.idleTTL)
+		item.lastAccess = new(atomic.Int64)
+		item.lastAccess.Store(c.now())
+	}
+
+	return c.store(key, item)
+}
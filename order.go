@@ -0,0 +1,104 @@
+package candycache
+
+import "container/list"
+
+// Порядок добавления ключей: двусвязный список ключей и индекс его узлов по ключу.
+type insertionOrder struct {
+	keys     *list.List               // Ключи (orderedKey) от добавленного раньше всех к добавленному последним
+	elements map[string]*list.Element // Ключ -> его узел в keys
+	seq      uint64                   // Номер последнего добавленного ключа
+}
+
+// Ключ в порядке добавления и его номер, который растет с каждым добавлением.
+type orderedKey struct {
+	key string
+	seq uint64
+}
+
+// Включает отслеживание порядка добавления элементов (см. ListInsertionOrder).
+// Порядок ключа определяется первым добавлением: замена элемента по существующему ключу
+// (Set, Update и т.д.) и продление времени жизни его не меняют, а после удаления ключ,
+// добавленный снова, становится последним.
+// Порядок хранится в двусвязном списке рядом с хранилищем, поэтому каждый элемент занимает
+// дополнительно узел списка и запись в индексе узлов - порядка 100 байт на 64-битной платформе
+// сверх самого элемента, - а каждое добавление и удаление ключа делает лишнюю аллокацию.
+func WithInsertionOrder() Option {
+	return func(c *Cache) {
+		c.order = &insertionOrder{keys: list.New(), elements: make(map[string]*list.Element)}
+	}
+}
+
+// Добавляет ключ в конец порядка, если его там еще нет.
+func (o *insertionOrder) push(key string) {
+	if _, found := o.elements[key]; !found {
+		o.seq++
+		o.elements[key] = o.keys.PushBack(orderedKey{key: key, seq: o.seq})
+	}
+}
+
+// Убирает ключ из порядка.
+func (o *insertionOrder) remove(key string) {
+	if element, found := o.elements[key]; found {
+		o.keys.Remove(element)
+		delete(o.elements, key)
+	}
+}
+
+// Определяет был ли ключ a добавлен раньше ключа b. Ключи, которых нет в порядке, считаются последними.
+func (o *insertionOrder) before(a, b string) bool {
+	ea, found := o.elements[a]
+	if !found {
+		return false
+	}
+
+	eb, found := o.elements[b]
+
+	return !found || ea.Value.(orderedKey).seq < eb.Value.(orderedKey).seq
+}
+
+// Оставляет в порядке только ключи, которые есть в storage, сохраняя их места,
+// и добавляет в конец остальные ключи storage.
+func (o *insertionOrder) rebuild(storage Store) {
+	for element := o.keys.Front(); element != nil; {
+		next := element.Next()
+		if key := element.Value.(orderedKey).key; !hasKey(storage, key) {
+			o.keys.Remove(element)
+			delete(o.elements, key)
+		}
+		element = next
+	}
+
+	for key := range storage.Range {
+		o.push(key)
+	}
+}
+
+// Определяет есть ли в storage элемент с ключом key.
+func hasKey(storage Store, key string) bool {
+	_, found := storage.Get(key)
+
+	return found
+}
+
+// Возвращает список всех элементов кэша (включая устаревшие, но еще не удаленные очисткой)
+// в порядке их добавления: от добавленного раньше всех к добавленному последним.
+// Порядок отслеживается только с опцией WithInsertionOrder, без нее вернет пустой список.
+// Список строится обходом порядка без сортировки, за O(n).
+func (c *Cache) ListInsertionOrder() []KeyItemPair {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.order == nil {
+		return []KeyItemPair{}
+	}
+
+	items := make([]KeyItemPair, 0, c.order.keys.Len())
+	for element := c.order.keys.Front(); element != nil; element = element.Next() {
+		key := element.Value.(orderedKey).key
+		if item, found := c.storage.Get(key); found {
+			items = append(items, KeyItemPair{Key: key, Item: item})
+		}
+	}
+
+	return items
+}
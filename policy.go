@@ -0,0 +1,86 @@
+package candycache
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Правила для элементов, ключи которых начинаются с определенного префикса (см. WithPrefixPolicy).
+type PrefixPolicy struct {
+	MaxTTL time.Duration // Наибольшее время жизни элемента (0 - не ограничено)
+}
+
+// Правило вместе с его префиксом.
+type prefixPolicy struct {
+	prefix string
+	PrefixPolicy
+}
+
+// Задает правило для элементов, ключи которых начинаются с prefix.
+// Время жизни таких элементов ограничивается policy.MaxTTL при любой записи и продлении
+// (Set, Add, GetExtend, GetRefresh, TouchMany, ReplaceAll и т.д.): элемент, который
+// устарел бы позже или никогда, устареет через MaxTTL от момента записи. Так данные
+// из таких пространств почти всегда загружаются заново, а остальные кэшируются как обычно.
+// Если ключ подходит под несколько префиксов, действует правило самого длинного из них.
+// Повторное правило для того же префикса заменяет предыдущее.
+func WithPrefixPolicy(prefix string, policy PrefixPolicy) Option {
+	return func(c *Cache) {
+		c.policies = slices.DeleteFunc(c.policies, func(p prefixPolicy) bool {
+			return p.prefix == prefix
+		})
+		c.policies = append(c.policies, prefixPolicy{prefix: prefix, PrefixPolicy: policy})
+
+		// Самые длинные префиксы - первыми, чтобы policy находила самое точное правило.
+		slices.SortStableFunc(c.policies, func(a, b prefixPolicy) int {
+			return len(b.prefix) - len(a.prefix)
+		})
+	}
+}
+
+// Вернет правило для ключа key (nil - правила нет).
+func (c *Cache) policy(key string) *PrefixPolicy {
+	for i := range c.policies {
+		if strings.HasPrefix(key, c.policies[i].prefix) {
+			return &c.policies[i].PrefixPolicy
+		}
+	}
+
+	return nil
+}
+
+// Ограничивает время жизни всех элементов кэша: при любой записи и продлении, как в WithPrefixPolicy,
+// элемент, который устарел бы позже чем через d или никогда (ttl <= 0), устареет через d от момента
+// записи. Ограничение действует вместе с правилами префиксов: из двух пределов выбирается меньший,
+// поэтому правило префикса не может разрешить элементу жить дольше d. Устаревание в заданный момент
+// (WithItemDeadline) и начальные элементы (WithInitialEntries) ограничиваются так же.
+// Если d <= 0, ограничения нет (по умолчанию).
+func WithMaxTTL(d time.Duration) Option {
+	return func(c *Cache) {
+		c.maxTTL = max(d, 0)
+	}
+}
+
+// Ограничивает момент устаревания destroyTimestamp элемента с ключом key правилом его префикса
+// и WithMaxTTL.
+func (c *Cache) clampDeadline(key string, destroyTimestamp int64) int64 {
+	if policy := c.policy(key); policy != nil && policy.MaxTTL > 0 {
+		destroyTimestamp = c.clampTo(destroyTimestamp, policy.MaxTTL)
+	}
+
+	if c.maxTTL > 0 {
+		destroyTimestamp = c.clampTo(destroyTimestamp, c.maxTTL)
+	}
+
+	return destroyTimestamp
+}
+
+// Ограничивает момент устаревания destroyTimestamp моментом через ttl от текущего.
+func (c *Cache) clampTo(destroyTimestamp int64, ttl time.Duration) int64 {
+	limit := c.now() + int64(ttl)
+	if destroyTimestamp == 0 || destroyTimestamp > limit {
+		return limit
+	}
+
+	return destroyTimestamp
+}
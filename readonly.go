@@ -0,0 +1,44 @@
+package candycache
+
+// Кэш, доступный только для чтения.
+// Позволяет передать кэш в код, которому запрещено его изменять.
+type ReadOnlyCache interface {
+	Get(key string) (interface{}, bool)
+	Has(key string) bool
+	Count() int
+	Keys() []string
+}
+
+// Обертка над Cache, реализующая ReadOnlyCache.
+type readOnlyCache struct {
+	cache *Cache
+}
+
+// Возвращает представление кэша, доступное только для чтения.
+// Представление не копирует данные - все изменения кэша сразу видны через него.
+func (c *Cache) ReadOnly() ReadOnlyCache {
+	return readOnlyCache{cache: c}
+}
+
+// Получение элемента из кэша по ключу.
+// Вторым аргументом возвращается есть элемент в кэше или нет.
+func (r readOnlyCache) Get(key string) (interface{}, bool) {
+	data, err := r.cache.Get(key)
+
+	return data, err == nil
+}
+
+// Определяет есть ли в кэше неустаревший элемент с ключом key.
+func (r readOnlyCache) Has(key string) bool {
+	return r.cache.Has(key)
+}
+
+// Вернет количество элементов в кэше.
+func (r readOnlyCache) Count() int {
+	return r.cache.Count()
+}
+
+// Возвращает список ключей всех элементов кэша.
+func (r readOnlyCache) Keys() []string {
+	return r.cache.Keys()
+}
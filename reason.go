@@ -0,0 +1,84 @@
+package candycache
+
+// Причина удаления элемента из кэша, которую получает обработчик WithOnEvictedReason.
+type EvictReason int
+
+const (
+	EvictExpired  EvictReason = iota // Устарел и удален очисткой (Cleanup, автоматическая очистка, WithSweepOnFull)
+	EvictDeleted                     // Удален явно: Delete, DeletePrefix, DeleteTag, DeleteMatch, транзакция, Update, GetValid, MoveTo
+	EvictEvicted                     // Вытеснен ради ограничений размера: WithCapacity, WithSoftByteTarget, квота Namespace, Evict
+	EvictFlushed                     // Удален вместе с остальными: Flush, FlushContext, FlushExcept, ReplaceAll
+	EvictReplaced                    // Заменен новой записью по тому же ключу: Set, Add, Append, Update, ReplaceAll и т.д.
+)
+
+// Вернет название причины удаления.
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictDeleted:
+		return "deleted"
+	case EvictEvicted:
+		return "evicted"
+	case EvictFlushed:
+		return "flushed"
+	case EvictReplaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// Функция, которую кэш вызывает для удаленного или замененного элемента с причиной удаления.
+type EvictedReasonFunc func(key string, data interface{}, reason EvictReason)
+
+// Задает обработчик, который, как WithOnEvicted, вызывается для каждого удаленного элемента,
+// но получает еще и причину удаления - например, чтобы загружать заново устаревшие элементы,
+// но не удаленные явно. В отличие от WithOnEvicted, он вызывается и при замене элемента новой
+// записью (EvictReplaced) - продление времени жизни (GetExtend, TouchMany и т.д.) заменой не считается.
+// Элементы, удаленные вместе с элементом, от которого они зависят (AddWithDeps), получают ту же причину.
+// Reset и Drain обработчик не вызывают. Обработчик вызывается вне блокировки кэша,
+// после WithOnEvicted, если задан и он.
+func WithOnEvictedReason(onEvicted EvictedReasonFunc) Option {
+	return func(c *Cache) {
+		c.onEvictedReason = onEvicted
+	}
+}
+
+// Удаленный под блокировкой элемент, для которого еще не вызваны обработчики удаления.
+type evictedItem struct {
+	key    string
+	item   Item
+	reason EvictReason
+}
+
+// Определяет заданы ли обработчики удаления.
+func (c *Cache) notifiesEvictions() bool {
+	return c.onEvicted != nil || c.onEvictedReason != nil
+}
+
+// Запоминает удаленный элемент, чтобы вызвать для него обработчики удаления в unlock. Без блокировки.
+func (c *Cache) evict(key string, item Item, reason EvictReason) {
+	if reason == EvictReplaced && c.onEvictedReason == nil {
+		return
+	}
+
+	c.evicted = append(c.evicted, evictedItem{key: key, item: item, reason: reason})
+}
+
+// Вызывает обработчики удаления для элемента. Вне блокировки.
+// WithOnEvicted не вызывается для замененных элементов, а обработчик самого элемента
+// (WithItemExpiryCallback) - для удаленных не по устареванию.
+func (c *Cache) notifyEvicted(key string, item Item, reason EvictReason) {
+	if reason == EvictExpired && item.onExpired != nil {
+		item.onExpired(key, item.data)
+	}
+
+	if c.onEvicted != nil && reason != EvictReplaced {
+		c.onEvicted(key, item.data)
+	}
+
+	if c.onEvictedReason != nil {
+		c.onEvictedReason(key, item.data, reason)
+	}
+}
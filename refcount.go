@@ -0,0 +1,62 @@
+package candycache
+
+import (
+	"errors"
+	"math"
+	"reflect"
+)
+
+// Ошибка, возвращаемая DecrementAndMaybeDelete, если по ключу хранится не целое число.
+var ErrNotInteger = errors.New("candycache: value is not an integer")
+
+// Атомарно уменьшает целое число, хранящееся по ключу key, на delta - примитив для счетчиков ссылок.
+// Если результат <= 0, элемент удаляется (обработчик удаления вызывается как при Delete)
+// и deleted == true: вызвавший отпустил последнюю ссылку. Иначе новое значение записывается
+// с тем же временем жизни и тем же типом, что и прежнее (int, int32, uint64 и т.д.).
+// Если неустаревшего элемента нет, вернет ErrKeyNotFound, если это отрицательный результат -
+// ErrNegative, если данные не целое число или значение не помещается в их тип или в int64 - ErrNotInteger;
+// во всех этих случаях кэш не меняется.
+func (c *Cache) DecrementAndMaybeDelete(key string, delta int64) (newVal int64, deleted bool, err error) {
+	c.Lock()
+	defer c.unlock()
+
+	item, found := c.storage.Get(key)
+	if !found || item.expired(c.now()) {
+		return 0, false, ErrKeyNotFound
+	}
+
+	if item.negative {
+		return 0, false, ErrNegative
+	}
+
+	val := reflect.ValueOf(item.data)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		newVal = val.Int() - delta
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if val.Uint() > math.MaxInt64 {
+			return 0, false, ErrNotInteger
+		}
+		newVal = int64(val.Uint()) - delta
+	default:
+		return 0, false, ErrNotInteger
+	}
+
+	if newVal <= 0 {
+		c.remove(key, item, EvictDeleted)
+		return newVal, true, nil
+	}
+
+	if val.CanInt() && val.OverflowInt(newVal) {
+		return 0, false, ErrNotInteger
+	}
+	if val.CanUint() && val.OverflowUint(uint64(newVal)) {
+		return 0, false, ErrNotInteger
+	}
+
+	item.data = reflect.ValueOf(newVal).Convert(val.Type()).Interface()
+	item.version = c.nextVersion()
+	c.put(key, item)
+
+	return newVal, false, nil
+}
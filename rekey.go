@@ -0,0 +1,74 @@
+package candycache
+
+import "time"
+
+// Переименовывает ключи всех элементов (и устаревших, и нет) функцией transform, например,
+// после смены формата ключей ("user_123" -> "user:123"). Элементы переносятся под новые ключи
+// как есть, с тем же временем жизни, версией, метками и счетчиком попаданий; элементы,
+// для которых transform вернет keep == false, удаляются. Новое хранилище строится и подменяется
+// под одной блокировкой на запись, поэтому читатели видят либо все старые ключи, либо все новые.
+// Если несколько ключей переходят в один и тот же новый ключ, остается элемент, записанный
+// последним (с наибольшей версией), а остальные считаются замененными.
+// Для удаленных и замененных элементов вызываются обработчики удаления (WithOnEvicted - только
+// для удаленных). Правила префиксов (WithPrefixPolicy) применяются к новым ключам, вторичные
+// индексы и корзины устаревания перестраиваются, а зависимости (AddWithDeps) и псевдонимы
+// (AddWithAliases) забываются, как в ReplaceAll. transform вызывается под блокировкой,
+// поэтому не должна обращаться к кэшу.
+// Вернет сколько элементов осталось в кэше. Если кэш закрыт, ничего не делает и вернет 0.
+func (c *Cache) Rekey(transform func(oldKey string) (newKey string, keep bool)) int {
+	c.Lock()
+	defer c.unlock()
+
+	if c.closed {
+		return 0
+	}
+	c.checkSealed()
+
+	storage := make(mapStore, c.storage.Len())
+	for key, item := range c.storage.Range {
+		newKey, keep := transform(key)
+		if !keep {
+			if c.notifiesEvictions() {
+				c.evict(key, item, EvictDeleted)
+			}
+			if item.signal != nil {
+				item.signal.fire()
+			}
+			continue
+		}
+
+		item.dependsOn = nil
+		item.aliases = nil
+		if c.policies != nil || c.maxTTL > 0 {
+			item.destroyTimestamp = c.clampDeadline(newKey, item.destroyTimestamp)
+		}
+
+		if other, found := storage[newKey]; found {
+			if other.version > item.version {
+				item, other = other, item
+			}
+			c.evict(newKey, other, EvictReplaced)
+			if other.signal != nil {
+				other.signal.fire()
+			}
+		}
+
+		storage[newKey] = item
+	}
+
+	c.swapStore(storage)
+	c.dependents = nil
+	c.aliases = nil
+	c.reindex()
+
+	if c.buckets != nil {
+		c.buckets = newExpiryBuckets(time.Duration(c.buckets.width))
+		for key, item := range storage {
+			if !item.frozen {
+				c.buckets.add(key, item.destroyTimestamp)
+			}
+		}
+	}
+
+	return len(storage)
+}
@@ -0,0 +1,57 @@
+package candycache
+
+import "time"
+
+// Функция, которую очистка вызывает для устаревшего элемента перед удалением.
+// Вернет на сколько продлить жизнь элемента (0 или меньше - удалить, как обычно).
+type RetainFunc func(key string, data interface{}) (retainFor time.Duration)
+
+// Задает функцию, которая может отложить удаление устаревшего элемента - например, если он
+// описывает ресурс, который сейчас используется. Очистка (Cleanup, автоматическая очистка,
+// CleanupFunc, WithSweepOnFull и FlushAndReturn) перед удалением каждого устаревшего элемента
+// вызывает fn, и если та вернет retainFor > 0, элемент не удаляется, а живет еще retainFor от
+// текущего момента, как после TouchMany. Обработчики удаления для него не вызываются, и в
+// Stats().Expired он не попадает. Чтобы элемент не удерживался вечно, один элемент продлевается
+// не больше maxRetains раз (0 - не ограничено): после этого он удаляется без вызова fn,
+// а в логгер (WithLogger) пишется событие "retain_limit". Новая запись по ключу сбрасывает счет.
+// Элементы, которые продление не спасет (устаревшие по WithIdleTTL, старше WithMaxAge
+// или без обращений дольше WithEvictAfterIdle), удаляются без вызова fn. fn вызывается под блокировкой, поэтому не должна обращаться к кэшу.
+func WithExpiryRetention(fn RetainFunc, maxRetains int) Option {
+	return func(c *Cache) {
+		c.retain = fn
+		c.maxRetains = maxRetains
+	}
+}
+
+// Продлевает устаревший элемент, если этого попросит функция WithExpiryRetention.
+// Вернет был ли элемент продлен. Без блокировки.
+func (c *Cache) retained(key string, item Item, now int64, limits ageLimits) bool {
+	if c.retain == nil {
+		return false
+	}
+
+	retained := item
+	retained.destroyTimestamp = now + 1
+	if retained.outlived(now, limits) {
+		return false
+	}
+
+	if c.maxRetains > 0 && item.retains >= c.maxRetains {
+		c.logLocked("retain_limit", map[string]interface{}{
+			"key":     key,
+			"retains": item.retains,
+		})
+		return false
+	}
+
+	retainFor := c.retain(key, item.data)
+	if retainFor <= 0 {
+		return false
+	}
+
+	retained.destroyTimestamp = deadline(now, retainFor)
+	retained.retains++
+	c.put(key, retained)
+
+	return true
+}
@@ -0,0 +1,131 @@
+package candycache
+
+import (
+	"container/heap"
+	"slices"
+	"strings"
+)
+
+// Возвращает очередную порцию из не более чем count ключей всех элементов кэша (как Keys)
+// и курсор, с которым нужно вызвать Scan за следующей порцией, - чтобы перебрать большой кэш
+// во внешнем цикле, не держа блокировку все это время и не собирая все ключи в память.
+// Перебор начинается с курсора 0 и закончен, когда вернулся курсор 0.
+// Ключи перебираются по возрастанию своего 64-битного хеша, а курсор - это хеш последнего
+// выданного ключа, поэтому перебор переживает любые изменения кэша между вызовами: ключ, который
+// был в кэше все время перебора, будет выдан ровно один раз, а ключи, добавленные или удаленные
+// во время перебора, могут быть выданы или нет. Порция может оказаться меньше count (или пустой
+// при ненулевом курсоре), если ключи удалялись, и немного больше - если у нескольких ключей
+// совпал хеш.
+// Каждый вызов проходит весь кэш под блокировкой на чтение, то есть стоит O(n log count),
+// и держит в памяти только count ключей. Если count <= 0, вернет пустую порцию и курсор 0.
+func (c *Cache) Scan(cursor uint64, count int) (keys []string, nextCursor uint64) {
+	if count <= 0 {
+		return []string{}, 0
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	batch := &scanHeap{}
+	more := false
+	for key := range c.storage.Range {
+		entry := scanEntry{key: key, hash: scanHash(key)}
+		if entry.hash <= cursor {
+			continue
+		}
+
+		switch {
+		case batch.Len() < count:
+			heap.Push(batch, entry)
+		case entry.less((*batch)[0]):
+			(*batch)[0] = entry
+			heap.Fix(batch, 0)
+			more = true
+		default:
+			more = true
+		}
+	}
+
+	slices.SortFunc(*batch, func(a, b scanEntry) int {
+		if a.less(b) {
+			return -1
+		}
+		return 1
+	})
+
+	entries := *batch
+	if more {
+		// Ключи с тем же хешем, что у последнего, могли не поместиться в порцию, а курсор
+		// не отличает их друг от друга, поэтому порция обрезается до предыдущего хеша.
+		last := entries[len(entries)-1].hash
+		end := len(entries)
+		for end > 0 && entries[end-1].hash == last {
+			end--
+		}
+
+		if end > 0 {
+			entries = entries[:end]
+		} else {
+			entries = c.scanHash(last)
+		}
+	}
+
+	keys = make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.key
+	}
+
+	if !more {
+		return keys, 0
+	}
+
+	return keys, entries[len(entries)-1].hash
+}
+
+// Возвращает все ключи с хешем hash. Без блокировки.
+func (c *Cache) scanHash(hash uint64) []scanEntry {
+	entries := []scanEntry{}
+	for key := range c.storage.Range {
+		if scanHash(key) == hash {
+			entries = append(entries, scanEntry{key: key, hash: hash})
+		}
+	}
+
+	return entries
+}
+
+// Хеш ключа, по которому Scan упорядочивает ключи. Никогда не равен 0, с которого начинается перебор.
+func scanHash(key string) uint64 {
+	return max(mix64(fnv1a(key)), 1)
+}
+
+// Ключ вместе с его хешем для Scan.
+type scanEntry struct {
+	key  string
+	hash uint64
+}
+
+// Определяет идет ли e в переборе раньше other.
+func (e scanEntry) less(other scanEntry) bool {
+	if e.hash != other.hash {
+		return e.hash < other.hash
+	}
+
+	return strings.Compare(e.key, other.key) < 0
+}
+
+// Куча ключей с самым поздним в переборе ключом на вершине.
+type scanHeap []scanEntry
+
+func (h scanHeap) Len() int           { return len(h) }
+func (h scanHeap) Less(i, j int) bool { return h[j].less(h[i]) }
+func (h scanHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *scanHeap) Push(x any) { *h = append(*h, x.(scanEntry)) }
+
+func (h *scanHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,84 @@
+package candycache
+
+import (
+	"errors"
+	"time"
+)
+
+// Значение паники при попытке изменить запечатанный кэш (см. Seal).
+var ErrSealed = errors.New("candycache: cache is sealed")
+
+// Запечатывает кэш: дальше его содержимое нельзя изменить, а чтение (Get, Has, List, Keys и т.д.)
+// работает как раньше. Удобно для кэшей настроек, которые после прогрева только читаются, - так
+// неизменность проверяется во время работы, а не держится на договоренности.
+// Любая попытка изменить содержимое запечатанного кэша - добавление, замена, удаление, продление,
+// Flush, Evict, транзакция, GetExtend, GetRefresh, GetValid с удалением и т.д. - паникует
+// со значением ErrSealed (его можно распознать через errors.Is после recover), ничего не изменив:
+// ошибку записи, которую никто не ждал, легко не заметить, а такая запись - ошибка в программе.
+// Исключения, чтобы чтение и фоновые задачи не падали: автоматическая очистка останавливается,
+// а Cleanup ничего не делает (устаревшие элементы остаются и возвращаются Get, как до очистки);
+// события InvalidationBus запечатанный кэш пропускает; GetOrLoad возвращает загруженное значение,
+// не записывая его, а с WithFallback найденное в следующих уровнях не поднимается в этот кэш.
+// Повторный вызов ничего не делает. Снять печать можно через Unseal.
+func (c *Cache) Seal() {
+	c.gcMu.Lock()
+	defer c.gcMu.Unlock()
+
+	c.Lock()
+	c.sealed = true
+	c.Unlock()
+
+	c.stopGC()
+}
+
+// Снимает печать (см. Seal) - например, для запланированного обновления содержимого - и снова
+// запускает автоматическую очистку, если кэш не закрыт. Если кэш не запечатан, ничего не делает.
+func (c *Cache) Unseal() {
+	c.gcMu.Lock()
+	defer c.gcMu.Unlock()
+
+	c.Lock()
+	sealed, closed, interval := c.sealed, c.closed, c.cleanupInterval
+	c.sealed = false
+	c.Unlock()
+
+	if sealed && !closed {
+		c.startGC(interval)
+	}
+}
+
+// Определяет запечатан ли кэш.
+func (c *Cache) IsSealed() bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.sealed
+}
+
+// Паникует с ErrSealed, если кэш запечатан. Под блокировкой на запись, которую отпустит
+// отложенный unlock или Unlock вызывающего.
+func (c *Cache) checkSealed() {
+	if c.sealed {
+		panic(ErrSealed)
+	}
+}
+
+// Паникует с ErrSealed, если кэш запечатан, предварительно отпустив блокировку на запись, -
+// для мест, где блокировка отпускается без defer.
+func (c *Cache) unlockIfSealed() {
+	if c.sealed {
+		c.Unlock()
+		panic(ErrSealed)
+	}
+}
+
+// Записывает элемент, как Set, если кэш не запечатан, иначе ничего не делает.
+// Для записей, которые делает чтение (GetOrLoad, WithFallback).
+func (c *Cache) setUnlessSealed(key string, data interface{}, ttl time.Duration) {
+	c.Lock()
+	defer c.unlock()
+
+	if !c.sealed {
+		c.set(key, data, ttl)
+	}
+}
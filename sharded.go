@@ -0,0 +1,328 @@
+package candycache
+
+import (
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Сколько точек на кольце консистентного хеширования приходится на один шард.
+// Чем их больше, тем равномернее ключи распределяются по шардам.
+const shardRingReplicas = 128
+
+// Кэш, разбитый на несколько независимых частей (шардов), у каждой из которых своя блокировка.
+// Ключ всегда попадает в один и тот же шард, который выбирается по хешу ключа.
+// При большом количестве горутин это снижает конкуренцию за блокировку.
+type ShardedCache struct {
+	ring            atomic.Pointer[shardRing] // Шарды и кольцо, по которому между ними распределяются ключи
+	hasher          func(key string) uint64   // Хеш-функция для выбора шарда
+	cleanupInterval time.Duration             // Интервал очистки шардов, в том числе добавленных через Reshard
+	reshardMu       sync.RWMutex              // Reshard держит на запись, а запись в кэш - на чтение от выбора шарда до записи
+}
+
+// Кольцо консистентного хеширования: у каждого шарда shardRingReplicas точек на кольце,
+// и ключ достается шарду первой точки, не меньшей перемешанного хеша ключа. Неизменяемо:
+// Reshard строит новое кольцо и подменяет его целиком.
+type shardRing struct {
+	shards []*Cache // Шарды
+	points []uint64 // Точки кольца по возрастанию
+	owners []int    // owners[i] - номер шарда, которому принадлежит точка points[i]
+}
+
+// Опция, настраивающая шардированный кэш при создании.
+type ShardedOption func(*ShardedCache)
+
+// Задает хеш-функцию, по которой ключ распределяется по шардам.
+// По умолчанию используется FNV-1a. Своя функция пригодится, если ключи
+// распределяются FNV-1a неравномерно (например, последовательные числа).
+// Если hasher == nil, остается FNV-1a.
+func WithHasher(hasher func(key string) uint64) ShardedOption {
+	return func(s *ShardedCache) {
+		if hasher == nil {
+			hasher = fnv1a
+		}
+		s.hasher = hasher
+	}
+}
+
+// Создает новый экземпляр ShardedCache из shards шардов с интервалом очистки cleanupInterval.
+// Если shards < 1, кэш будет состоять из одного шарда.
+// Если cleanupInterval <= 0, то кэш не будет очищаться автоматически.
+func Sharded(shards int, cleanupInterval time.Duration, opts ...ShardedOption) *ShardedCache {
+	if shards < 1 {
+		shards = 1
+	}
+
+	cache := &ShardedCache{
+		hasher:          fnv1a,
+		cleanupInterval: cleanupInterval,
+	}
+
+	for _, opt := range opts {
+		opt(cache)
+	}
+
+	caches := make([]*Cache, shards)
+	for i := range caches {
+		caches[i] = Cacher(cleanupInterval)
+	}
+	cache.ring.Store(newShardRing(caches))
+
+	return cache
+}
+
+// Строит кольцо консистентного хеширования для шардов shards.
+// Точки шарда зависят только от его номера, поэтому у шардов, которые остаются
+// при изменении их количества, точки не меняются.
+func newShardRing(shards []*Cache) *shardRing {
+	type point struct {
+		hash  uint64
+		owner int
+	}
+
+	points := make([]point, 0, len(shards)*shardRingReplicas)
+	for i := range shards {
+		for replica := range shardRingReplicas {
+			points = append(points, point{hash: mix64(uint64(i)<<32 | uint64(replica)), owner: i})
+		}
+	}
+
+	slices.SortFunc(points, func(a, b point) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		default:
+			return a.owner - b.owner
+		}
+	})
+
+	ring := &shardRing{
+		shards: shards,
+		points: make([]uint64, len(points)),
+		owners: make([]int, len(points)),
+	}
+	for i, p := range points {
+		ring.points[i], ring.owners[i] = p.hash, p.owner
+	}
+
+	return ring
+}
+
+// Вернет шард, которому принадлежит ключ с хешем hash.
+func (r *shardRing) shard(hash uint64) *Cache {
+	if len(r.shards) == 1 {
+		return r.shards[0]
+	}
+
+	i, _ := slices.BinarySearch(r.points, mix64(hash))
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.shards[r.owners[i]]
+}
+
+// Перемешивает биты x (финализатор SplitMix64), чтобы и хеш-функции с неравномерными
+// значениями (например, последовательными числами) равномерно ложились на кольцо.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return x
+}
+
+// FNV-1a, 64 бита.
+func fnv1a(key string) uint64 {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= 1099511628211
+	}
+
+	return hash
+}
+
+// Возвращает шард, в котором хранится ключ key.
+func (s *ShardedCache) shard(key string) *Cache {
+	return s.ring.Load().shard(s.hasher(key))
+}
+
+// Возвращает текущие шарды.
+func (s *ShardedCache) shards() []*Cache {
+	return s.ring.Load().shards
+}
+
+// Меняет количество шардов на n (если n < 1 - на один шард) и переносит ключи, которые
+// теперь относятся к другим шардам. Ключи распределяются по кольцу консистентного хеширования,
+// поэтому переезжает только их часть: при увеличении с k до n шардов - примерно (n-k)/n ключей,
+// все в новые шарды, а при уменьшении - только ключи удаляемых шардов. Остальные ключи,
+// их время жизни и статистика шардов не меняются.
+// Новое распределение начинает действовать сразу, а ключи переносятся следом в том же вызове:
+// перебираются все ключи всех прежних шардов, и каждый переезжающий ключ переносится атомарно
+// (как MoveTo) под блокировками двух шардов. Пока перенос не дошел до ключа, чтение по нему
+// дает промах.
+// Устаревшие элементы не переносятся. Удаляемые шарды после переноса закрываются.
+// Запись (Set, Add, Delete, Flush) на время Reshard ждет его окончания: иначе запись, выбравшая
+// шард по старому кольцу, могла бы попасть в уже перебранный шард и потеряться. Чтение не ждет.
+// Вернет сколько элементов было перенесено. Reshard не должен вызываться одновременно с Close.
+func (s *ShardedCache) Reshard(n int) int {
+	if n < 1 {
+		n = 1
+	}
+
+	s.reshardMu.Lock()
+	defer s.reshardMu.Unlock()
+
+	old := s.ring.Load()
+	if n == len(old.shards) {
+		return 0
+	}
+
+	shards := make([]*Cache, n)
+	copy(shards, old.shards)
+	for i := len(old.shards); i < n; i++ {
+		shards[i] = Cacher(s.cleanupInterval)
+	}
+
+	ring := newShardRing(shards)
+	s.ring.Store(ring)
+
+	moved := 0
+	for i, shard := range old.shards {
+		for _, key := range shard.Keys() {
+			if dst := ring.shard(s.hasher(key)); dst != shard && shard.transfer(dst, key, true, false) {
+				moved++
+			}
+		}
+
+		if i >= n {
+			shard.Close()
+		}
+	}
+
+	return moved
+}
+
+// Получение элемента из кэша по ключу.
+func (s *ShardedCache) Get(key string) (interface{}, error) {
+	return s.shard(key).Get(key)
+}
+
+// Определяет есть ли в кэше неустаревший элемент с ключом key.
+func (s *ShardedCache) Has(key string) bool {
+	return s.shard(key).Has(key)
+}
+
+// Добавление элемента в кэш.
+// Если ttl <= 0, элемент никогда не устаревает.
+func (s *ShardedCache) Set(key string, data interface{}, ttl time.Duration) {
+	s.reshardMu.RLock()
+	defer s.reshardMu.RUnlock()
+
+	s.shard(key).Set(key, data, ttl)
+}
+
+// Добавление элемента в кэш, только если по ключу key нет неустаревшего элемента.
+// Если элемент уже есть, вернет ErrKeyExists.
+func (s *ShardedCache) Add(key string, data interface{}, ttl time.Duration) error {
+	s.reshardMu.RLock()
+	defer s.reshardMu.RUnlock()
+
+	return s.shard(key).Add(key, data, ttl)
+}
+
+// Удаление элемента по ключу.
+func (s *ShardedCache) Delete(key string) error {
+	s.reshardMu.RLock()
+	defer s.reshardMu.RUnlock()
+
+	return s.shard(key).Delete(key)
+}
+
+// Перебирает все элементы во всех шардах, удаляет устаревшие.
+// Шарды очищаются параллельно не более чем GOMAXPROCS горутинами: каждая берет следующий
+// еще не очищенный шард из общей очереди, поэтому если в одном шарде устаревших элементов
+// намного больше, остальные шарды достаются свободным горутинам, а не ждут его.
+func (s *ShardedCache) Cleanup() {
+	shards := s.shards()
+	workers := min(runtime.GOMAXPROCS(0), len(shards))
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(shards) {
+					return
+				}
+				shards[i].Cleanup()
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Удаление всех элементов из кэша.
+func (s *ShardedCache) Flush() {
+	s.reshardMu.RLock()
+	defer s.reshardMu.RUnlock()
+
+	for _, shard := range s.shards() {
+		shard.Flush()
+	}
+}
+
+// Закрывает все шарды (см. Cache.Close).
+func (s *ShardedCache) Close() {
+	for _, shard := range s.shards() {
+		shard.Close()
+	}
+}
+
+// Вернет количество элементов в кэше.
+// Шарды блокируются по очереди, поэтому при одновременной записи результат приблизительный.
+func (s *ShardedCache) Count() int {
+	count := 0
+	for _, shard := range s.shards() {
+		count += shard.Count()
+	}
+
+	return count
+}
+
+// Вернет приблизительное количество элементов в кэше - сумму Cache.ApproxCount всех шардов,
+// без блокировок. В отличие от Count, не ждет блокировку ни одного шарда, поэтому подходит
+// для частого опроса нагруженного кэша. Помимо расхождения каждого шарда (см. Cache.ApproxCount)
+// сумма может учесть один шард до записи, а другой после, поэтому расхождение с точным количеством
+// не больше, чем элементов добавили и удалили записи, шедшие во время вызова.
+func (s *ShardedCache) ApproxCount() int {
+	count := 0
+	for _, shard := range s.shards() {
+		count += shard.ApproxCount()
+	}
+
+	return count
+}
+
+// Вернет количество элементов в каждом шарде.
+// Помогает проверить, насколько равномерно хеш-функция распределяет ключи.
+func (s *ShardedCache) ShardCounts() []int {
+	shards := s.shards()
+	counts := make([]int, len(shards))
+	for i, shard := range shards {
+		counts[i] = shard.Count()
+	}
+
+	return counts
+}
@@ -0,0 +1,79 @@
+package candycache
+
+import "time"
+
+// Каналы, которые закрываются, когда элемент уходит из кэша (см. AddWithSignal).
+// Общий для всех копий Item, меняется только под блокировкой кэша на запись.
+type itemSignal struct {
+	chans []chan struct{}
+	fired bool
+}
+
+// Закрывает каналы сигнала, если они еще не закрыты. Под блокировкой на запись.
+func (s *itemSignal) fire() {
+	if s.fired {
+		return
+	}
+	s.fired = true
+
+	for _, ch := range s.chans {
+		close(ch)
+	}
+	s.chans = nil
+}
+
+// Добавление элемента, только если по ключу key нет неустаревшего элемента, как в Add,
+// но с каналом, который закроется, когда по ключу key не останется элемента: элемент устареет
+// и будет удален очисткой, будет удален (Delete, вытеснение, Flush, MoveTo и т.д.) или уйдет из кэша
+// при ReplaceAll, Reset, Drain, FlushAndReturn и Rekey. Канал позволяет ждать устаревания в select
+// без опроса и без общего обработчика удаления - например, для одноразового таймера.
+// Устаревший элемент закрывает канал, только когда его удалит очистка, поэтому канал закроется
+// с задержкой до интервала очистки; с WithAdaptiveCleanup очистка запускается к моменту устаревания.
+// Канал следует за ключом, а не за записью: если элемент заменить через Set (или продлить через
+// TouchMany), канал не закроется, а закроется по времени жизни нового элемента, когда тот будет удален.
+// Каждый канал закрывается ровно один раз, поэтому его можно ждать из нескольких горутин.
+// Если элемент уже есть, вернет ErrKeyExists, если места нет - ErrCacheFull; тогда канал равен nil.
+func (c *Cache) AddWithSignal(key string, data interface{}, ttl time.Duration) (<-chan struct{}, error) {
+	c.Lock()
+	defer c.unlock()
+
+	if item, found := c.storage.Get(key); found && !item.expired(c.now()) {
+		return nil, ErrKeyExists
+	}
+
+	ch := make(chan struct{})
+	item := c.newItem(data, ttl)
+	item.signal = &itemSignal{chans: []chan struct{}{ch}}
+	c.signals = true
+
+	if err := c.store(key, item); err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// Передает элементу, который заменяет old, каналы сигнала old. Без блокировки.
+func (i *Item) inheritSignal(old Item) {
+	switch {
+	case old.signal == nil || old.signal == i.signal:
+	case i.signal == nil:
+		i.signal = old.signal
+	default:
+		i.signal.chans = append(i.signal.chans, old.signal.chans...)
+		old.signal.chans = nil
+	}
+}
+
+// Закрывает каналы сигналов всех элементов storage, ушедших из кэша целиком. Без блокировки.
+func (c *Cache) fireSignals(storage Store) {
+	if !c.signals {
+		return
+	}
+
+	for _, item := range storage.Range {
+		if item.signal != nil {
+			item.signal.fire()
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package candycache
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Счетчики статистики кэша.
+// Все счетчики, кроме cleanupRuns и lastCleanup, меняются только под блокировкой кэша
+// (на чтение или на запись), поэтому под блокировкой на запись их можно прочитать согласованно.
+type stats struct {
+	hits           atomic.Uint64
+	misses         atomic.Uint64
+	expired        atomic.Uint64
+	evicted        atomic.Uint64
+	reclaimedBytes atomic.Uint64
+	cleanupRuns    atomic.Uint64
+	compactions    atomic.Uint64
+	ghostHits      atomic.Uint64
+	waiters        atomic.Int64 // Сколько вызовов ждут прямо сейчас (см. WithMaxWaiters)
+	lastCleanup    atomic.Int64 // Момент последней очистки в Unix-наносекундах (0 - очистки не было)
+}
+
+// Учитывает обращение к элементу: found - найден ли элемент.
+func (s *stats) lookup(found bool) {
+	if found {
+		s.hits.Add(1)
+	} else {
+		s.misses.Add(1)
+	}
+}
+
+// Обнуляет накопленные счетчики. waiters - не счетчик, а текущее значение, поэтому не меняется.
+// Только под блокировкой на запись.
+func (s *stats) reset() {
+	s.hits.Store(0)
+	s.misses.Store(0)
+	s.expired.Store(0)
+	s.evicted.Store(0)
+	s.reclaimedBytes.Store(0)
+	s.cleanupRuns.Store(0)
+	s.compactions.Store(0)
+	s.ghostHits.Store(0)
+	s.lastCleanup.Store(0)
+}
+
+// Статистика кэша с момента создания.
+type Stats struct {
+	Hits           uint64 // Сколько раз элемент был найден (Get, TryGet, GetExtend, GetRefresh, GetAllowStale, транзакции)
+	Misses         uint64 // Сколько раз элемент не был найден
+	Expired        uint64 // Сколько устаревших элементов удалено очисткой
+	Evicted        uint64 // Сколько элементов вытеснено, чтобы уложиться в WithCapacity и WithSoftByteTarget
+	ReclaimedBytes uint64 // Сколько байт освобождено, чтобы уложиться в WithSoftByteTarget
+	Waiters        uint64 // Сколько вызовов ждут прямо сейчас (WaitEmpty, GetOrWait, GetOrLoad); не накапливается
+}
+
+// Возвращает статистику кэша.
+// Счетчики читаются под блокировкой кэша на запись, поэтому согласованы между собой.
+func (c *Cache) Stats() Stats {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.readStats()
+}
+
+// Читает счетчики статистики. Для согласованности - под блокировкой на запись.
+func (c *Cache) readStats() Stats {
+	return Stats{
+		Hits:           c.stats.hits.Load(),
+		Misses:         c.stats.misses.Load(),
+		Expired:        c.stats.expired.Load(),
+		Evicted:        c.stats.evicted.Load(),
+		ReclaimedBytes: c.stats.reclaimedBytes.Load(),
+		Waiters:        uint64(max(c.stats.waiters.Load(), 0)),
+	}
+}
+
+// Возвращает изменение статистики с момента снимка prev, сделанного через Stats:
+// например, чтобы посчитать попадания в секунду за интервал между двумя снимками.
+// См. Stats.Sub.
+func (c *Cache) StatsDelta(prev Stats) Stats {
+	return c.Stats().Sub(prev)
+}
+
+// Возвращает разницу счетчиков s и более раннего снимка prev.
+// Если счетчик в s меньше чем в prev (например, кэш был пересоздан между снимками),
+// считается, что он начался заново с нуля, и разницей будет само значение из s,
+// а не огромное число после переполнения. Waiters - не счетчик, а текущее значение, и берется из s.
+func (s Stats) Sub(prev Stats) Stats {
+	return Stats{
+		Hits:           counterDelta(s.Hits, prev.Hits),
+		Misses:         counterDelta(s.Misses, prev.Misses),
+		Expired:        counterDelta(s.Expired, prev.Expired),
+		Evicted:        counterDelta(s.Evicted, prev.Evicted),
+		ReclaimedBytes: counterDelta(s.ReclaimedBytes, prev.ReclaimedBytes),
+		Waiters:        s.Waiters,
+	}
+}
+
+// Разница между значениями счетчика cur и prev с учетом его сброса.
+func counterDelta(cur, prev uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+
+	return cur - prev
+}
+
+// Возвращает долю обращений, в которых элемент был найден: Hits / (Hits + Misses).
+// Если обращений не было, вернет 0.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(total)
+}
+
+// Возвращает статистику в виде строки для логов.
+func (s Stats) String() string {
+	return fmt.Sprintf("hits=%d misses=%d hit_ratio=%.4f expired=%d evicted=%d reclaimed_bytes=%d waiters=%d",
+		s.Hits, s.Misses, s.HitRatio(), s.Expired, s.Evicted, s.ReclaimedBytes, s.Waiters)
+}
+
+// Возвращает момент завершения последней очистки - автоматической или ручной.
+// Если очистки еще не было, вернет нулевое время.
+func (c *Cache) LastCleanup() time.Time {
+	last := c.stats.lastCleanup.Load()
+	if last == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, last)
+}
+
+// Возвращает сколько раз выполнялась очистка - автоматическая или ручная.
+func (c *Cache) CleanupRuns() uint64 {
+	return c.stats.cleanupRuns.Load()
+}
+
+// Распределение размеров данных элементов в байтах (см. Size).
+type SizeStats struct {
+	Count int     // Сколько элементов учтено
+	Min   int     // Наименьший размер
+	Max   int     // Наибольший размер
+	Mean  float64 // Средний размер
+	P50   int     // Медиана
+	P95   int     // 95-й процентиль
+}
+
+// Возвращает распределение размеров данных элементов, включая устаревшие.
+// Размеры считаются так же, как в Size, но без ключей и служебных полей.
+// Процентили вычисляются по ближайшему рангу. Если кэш пуст, все поля равны нулю.
+func (c *Cache) SizeStats() SizeStats {
+	c.RLock()
+	sizes := make([]int, 0, c.storage.Len())
+	for _, item := range c.storage.Range {
+		sizes = append(sizes, isize(item.data))
+	}
+	c.RUnlock()
+
+	if len(sizes) == 0 {
+		return SizeStats{}
+	}
+
+	slices.Sort(sizes)
+
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+
+	return SizeStats{
+		Count: len(sizes),
+		Min:   sizes[0],
+		Max:   sizes[len(sizes)-1],
+		Mean:  float64(total) / float64(len(sizes)),
+		P50:   percentile(sizes, 50),
+		P95:   percentile(sizes, 95),
+	}
+}
+
+// Вернет p-й процентиль отсортированного непустого среза по ближайшему рангу.
+func percentile(sorted []int, p int) int {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// Возвращает до n элементов с самыми большими данными, включая устаревшие, по убыванию размера -
+// например, чтобы найти значения, которые стоит сжать или вытеснить. Размер данных считается
+// так же, как в SizeStats. Выбор делается за один проход через кучу размера n,
+// без сортировки всего кэша.
+func (c *Cache) LargestN(n int) []KeyItemPair {
+	if n <= 0 {
+		return []KeyItemPair{}
+	}
+
+	c.RLock()
+	largest := &sizeHeap{}
+	for key, item := range c.storage.Range {
+		entry := sizedPair{pair: KeyItemPair{Key: key, Item: item}, size: isize(item.data)}
+		if largest.Len() < n {
+			heap.Push(largest, entry)
+		} else if entry.size > (*largest)[0].size {
+			(*largest)[0] = entry
+			heap.Fix(largest, 0)
+		}
+	}
+	c.RUnlock()
+
+	slices.SortFunc(*largest, func(a, b sizedPair) int {
+		return b.size - a.size
+	})
+
+	pairs := make([]KeyItemPair, len(*largest))
+	for i, entry := range *largest {
+		pairs[i] = entry.pair
+	}
+
+	return pairs
+}
+
+// Элемент вместе с размером его данных.
+type sizedPair struct {
+	pair KeyItemPair
+	size int
+}
+
+// Куча элементов с наименьшим размером данных на вершине.
+type sizeHeap []sizedPair
+
+func (h sizeHeap) Len() int           { return len(h) }
+func (h sizeHeap) Less(i, j int) bool { return h[i].size < h[j].size }
+func (h sizeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *sizeHeap) Push(x any) { *h = append(*h, x.(sizedPair)) }
+
+func (h *sizeHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// Граница гистограммы TTLHistogram для элементов, которые устареют позже всех границ или никогда.
+const TTLInfinity = time.Duration(math.MaxInt64)
+
+// Распределяет неустаревшие элементы по оставшемуся времени жизни за один проход.
+// buckets - верхние границы корзин (в любом порядке): элемент попадает в корзину с наименьшей
+// границей, которая не меньше оставшегося времени жизни, то есть элемент ровно на границе
+// попадает в ее корзину. Элементы, которые устареют позже всех границ или никогда не устаревают,
+// попадают в корзину TTLInfinity. Корзины не накопительные. Вернет количество элементов
+// по границам; корзины без элементов в результат не попадают.
+func (c *Cache) TTLHistogram(buckets []time.Duration) map[time.Duration]int {
+	bounds := slices.Clone(buckets)
+	slices.Sort(bounds)
+
+	histogram := make(map[time.Duration]int, len(bounds)+1)
+
+	c.RLock()
+	defer c.RUnlock()
+
+	now := c.now()
+	for _, item := range c.storage.Range {
+		if item.expired(now) {
+			continue
+		}
+
+		bound := TTLInfinity
+		if item.destroyTimestamp != 0 {
+			if i, _ := slices.BinarySearch(bounds, time.Duration(item.destroyTimestamp-now)); i < len(bounds) {
+				bound = bounds[i]
+			}
+		}
+		histogram[bound]++
+	}
+
+	return histogram
+}
+
+// Вернет количество неустаревших элементов, которые устареют в течение d (оставшееся время
+// жизни <= d), за один проход под блокировкой на чтение. Элементы, которые никогда не устаревают,
+// и замороженные элементы не считаются.
+func (c *Cache) CountExpiringWithin(d time.Duration) int {
+	c.RLock()
+	defer c.RUnlock()
+
+	count := 0
+	c.expiringWithin(d, func(string) { count++ })
+
+	return count
+}
+
+// Возвращает ключи неустаревших элементов, которые устареют в течение d, как CountExpiringWithin.
+func (c *Cache) KeysExpiringWithin(d time.Duration) []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	keys := []string{}
+	c.expiringWithin(d, func(key string) { keys = append(keys, key) })
+
+	return keys
+}
+
+// Вызывает fn для ключа каждого неустаревшего элемента, который устареет в течение d. Без блокировки.
+func (c *Cache) expiringWithin(d time.Duration, fn func(key string)) {
+	now := c.now()
+	for key, item := range c.storage.Range {
+		if item.destroyTimestamp == 0 || item.frozen || item.expired(now) {
+			continue
+		}
+
+		if time.Duration(item.destroyTimestamp-now) <= d {
+			fn(key)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package candycache
+
+// Хранилище элементов кэша. По умолчанию это обычная карта, но через WithStore
+// можно подставить свою реализацию (например, на другой хэш-таблице или на диске).
+// Все методы вызываются под блокировкой кэша, поэтому реализация может не заботиться
+// о синхронизации. Range обходит элементы, пока fn возвращает true; во время обхода
+// кэш может вызывать Delete и Set для уже пройденных или текущего ключа, как это
+// допускает обход карты.
+type Store interface {
+	Get(key string) (Item, bool)
+	Set(key string, item Item)
+	Delete(key string)
+	Len() int
+	Range(fn func(key string, item Item) bool)
+}
+
+// Задает хранилище элементов вместо карты по умолчанию. Хранилище должно быть пустым:
+// корзины устаревания, индексы и зависимости строятся только по элементам, добавленным через кэш.
+func WithStore(store Store) Option {
+	return func(c *Cache) {
+		c.storage = store
+	}
+}
+
+// Хранилище по умолчанию - обычная карта.
+type mapStore map[string]Item
+
+func (m mapStore) Get(key string) (Item, bool) {
+	item, found := m[key]
+	return item, found
+}
+
+func (m mapStore) Set(key string, item Item) { m[key] = item }
+
+func (m mapStore) Delete(key string) { delete(m, key) }
+
+func (m mapStore) Len() int { return len(m) }
+
+func (m mapStore) Range(fn func(key string, item Item) bool) {
+	for key, item := range m {
+		if !fn(key, item) {
+			return
+		}
+	}
+}
+
+// Заменяет содержимое хранилища элементами storage и возвращает прежнее содержимое. Без блокировки.
+// Хранилище по умолчанию подменяется целиком, а свое (WithStore) очищается и заполняется поэлементно.
+func (c *Cache) swapStore(storage mapStore) Store {
+	c.checkSealed()
+
+	if c.empty != nil {
+		close(c.empty)
+		c.empty = nil
+	}
+
+	if c.order != nil {
+		c.order.rebuild(storage)
+	}
+
+	c.idleKeys = nil
+	if c.buckets != nil {
+		for key, item := range storage {
+			c.trackIdle(key, item)
+		}
+	}
+
+	if _, ok := c.storage.(mapStore); ok {
+		old := c.storage
+		c.storage = storage
+		return old
+	}
+
+	old := make(mapStore, c.storage.Len())
+	for key, item := range c.storage.Range {
+		old[key] = item
+	}
+	for key := range old {
+		c.storage.Delete(key)
+	}
+	for key, item := range storage {
+		c.storage.Set(key, item)
+	}
+
+	return old
+}
@@ -0,0 +1,63 @@
+package candycache
+
+import (
+	"errors"
+	"time"
+)
+
+// Ошибка, возвращаемая TryGet и TryAdd, если блокировку не удалось получить за отведенное время.
+var ErrBusy = errors.New("candycache: cache is busy")
+
+// Как часто повторяется попытка взять блокировку (см. WithLockTimeout).
+const tryLockRetryInterval = 50 * time.Microsecond
+
+// Получение элемента из кэша по ключу, как Get, но без бесконечного ожидания блокировки.
+// Если блокировку не удалось получить за время, заданное WithLockTimeout, вернет ErrBusy.
+func (c *Cache) TryGet(key string) (interface{}, error) {
+	if !c.tryLock(c.TryRLock) {
+		return nil, ErrBusy
+	}
+	defer c.RUnlock()
+
+	return c.get(key)
+}
+
+// Добавление элемента в кэш, как Add, но без бесконечного ожидания блокировки.
+// Проверки выполняются по порядку, и вызов возвращает ошибку первой неудачной из них
+// (все ошибки распознаются через errors.Is):
+//   - ErrBusy - блокировку не удалось получить за время, заданное WithLockTimeout;
+//   - ErrKeyExists - по ключу уже есть неустаревший элемент;
+//   - ErrInvalidData - данные не прошли WithValidateOnAdd; если они не кодируются в JSON,
+//     ошибка совпадает и с ErrNonSerializable;
+//   - ErrClosed - кэш закрыт (Close);
+//   - ErrValueTooLarge - данные больше WithMaxValueSize;
+//   - ErrCacheFull - кэш заполнен (WithCapacity), а вытеснить ради элемента нечего.
+//
+// Ограничение WithSoftByteTarget добавление не отклоняет - кэш ужимается при очистке.
+func (c *Cache) TryAdd(key string, data interface{}, ttl time.Duration) error {
+	if !c.tryLock(c.TryLock) {
+		return ErrBusy
+	}
+	defer c.unlock()
+
+	return c.add(key, data, ttl)
+}
+
+// Пытается взять блокировку функцией try до истечения lockTimeout.
+// Вернет взята ли блокировка.
+func (c *Cache) tryLock(try func() bool) bool {
+	if try() {
+		return true
+	}
+
+	deadline := time.Now().Add(c.lockTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(tryLockRetryInterval)
+
+		if try() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,37 @@
+package candycache
+
+import "time"
+
+// Транзакция - набор операций над кэшем, которые другие горутины видят как одну.
+// Методы Tx не берут блокировку: она удерживается методом Transaction на все время транзакции.
+type Tx struct {
+	cache *Cache
+}
+
+// Выполняет fn, удерживая блокировку кэша на запись.
+// Все операции, сделанные через tx, для остальных горутин выполняются атомарно.
+// Внутри fn нельзя вызывать методы самого кэша и запускать горутины, работающие с ним, -
+// это приведет к взаимной блокировке. Использовать tx после возврата из fn нельзя.
+// Обработчик удаления (WithOnEvicted) для удаленных в транзакции элементов вызывается после ее завершения.
+func (c *Cache) Transaction(fn func(tx *Tx)) {
+	c.Lock()
+	defer c.unlock()
+
+	fn(&Tx{cache: c})
+}
+
+// Получение элемента из кэша по ключу.
+func (tx *Tx) Get(key string) (interface{}, error) {
+	return tx.cache.get(key)
+}
+
+// Добавление элемента в кэш.
+// Если ttl <= 0, элемент никогда не устаревает.
+func (tx *Tx) Set(key string, data interface{}, ttl time.Duration) {
+	tx.cache.set(key, data, ttl)
+}
+
+// Удаление элемента по ключу.
+func (tx *Tx) Delete(key string) error {
+	return tx.cache.delete(key)
+}
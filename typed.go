@@ -0,0 +1,26 @@
+package candycache
+
+// Возвращает данные всех неустаревших элементов кэша c, приведенные к типу T, в произвольном порядке.
+// Элементы, данные которых не являются T (в том числе отрицательные результаты AddNegative),
+// молча пропускаются; чтобы узнать, сколько их, сравните длину результата с CountLive.
+// Данные копируются так же, как при Get (WithCopyOnGet, WithCopyTypes).
+// Функция, а не метод, потому что у методов в Go не бывает своих параметров типа.
+func ListAs[T any](c *Cache) []T {
+	c.RLock()
+	defer c.RUnlock()
+
+	result := []T{}
+
+	now := c.now()
+	for _, item := range c.storage.Range {
+		if item.expired(now) {
+			continue
+		}
+
+		if data, ok := item.data.(T); ok {
+			result = append(result, c.copyData(data).(T))
+		}
+	}
+
+	return result
+}
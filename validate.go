@@ -0,0 +1,147 @@
+package candycache
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// Ошибка, возвращаемая при добавлении с WithValidateOnAdd, если данные не будут работать
+// с возможностями кэша. Объединяется (errors.Join) с ошибкой, описывающей причину.
+var ErrInvalidData = errors.New("candycache: invalid data")
+
+// Ошибка, возвращаемая при добавлении с WithValidateOnAdd, если данные не кодируются в JSON
+// и их нельзя будет сохранить в дамп. Объединяется с ErrInvalidData и ошибкой кодирования.
+var ErrNonSerializable = errors.New("candycache: data is not serializable")
+
+// Ошибка проверки данных с циклическими ссылками.
+var errCyclicData = errors.New("data contains a reference cycle")
+
+// Включает проверку данных при добавлении через Add, TryAdd и Batch.Add: данные, которые
+// позже сломали бы работу кэша далеко от места добавления, не добавляются, а вызов
+// возвращает ErrInvalidData. Какие проверки выполняются:
+//   - данные должны кодироваться в JSON (json.Marshal), чтобы их можно было сохранить через Save,
+//     SaveKeys и WriteJSONL, - проверяется всегда, поэтому каналы, функции и комплексные числа
+//     с этой опцией хранить нельзя; такая ошибка совпадает (errors.Is) и с ErrNonSerializable;
+//   - с WithCopyOnGet (или WithCopyTypes для типа данных) в данных не должно быть циклических
+//     ссылок через указатели, срезы, карты и интерфейсы - иначе копирование не завершится;
+//   - с WithSoftByteTarget или WithMaxValueSize в данных не должно быть циклов через срезы,
+//     карты и интерфейсы - иначе не завершится подсчет размера.
+//
+// Set, AddOpts, Fill и другие методы записи данные не проверяют. Проверка выполняется
+// под блокировкой кэша и стоит как кодирование данных в JSON.
+func WithValidateOnAdd() Option {
+	return func(c *Cache) {
+		c.validateOnAdd = true
+	}
+}
+
+// Проверяет данные для добавления, если включена WithValidateOnAdd.
+func (c *Cache) validate(data interface{}) error {
+	if !c.validateOnAdd || data == nil {
+		return nil
+	}
+
+	val := reflect.ValueOf(data)
+	if c.copies(data) && hasCycle(val, true, nil) {
+		return errors.Join(ErrInvalidData, errCyclicData)
+	}
+
+	if (c.softByteTarget > 0 || c.maxValueSize > 0) && hasCycle(val, false, nil) {
+		return errors.Join(ErrInvalidData, errCyclicData)
+	}
+
+	if _, err := json.Marshal(data); err != nil {
+		return errors.Join(ErrInvalidData, ErrNonSerializable, err)
+	}
+
+	return nil
+}
+
+// Определяет копирует ли кэш данные data при добавлении и получении (см. copyData).
+func (c *Cache) copies(data interface{}) bool {
+	if c.copyOnGet {
+		return true
+	}
+
+	if c.copyTypes == nil || data == nil {
+		return false
+	}
+
+	_, found := c.copyTypes[reflect.TypeOf(data)]
+
+	return found
+}
+
+// Адрес и тип значения, через которое проходит путь поиска цикла. Тип нужен, потому что
+// срез и указатель на его первый элемент имеют один адрес.
+type cycleKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// Определяет есть ли в значении v цикл ссылок через срезы, карты и интерфейсы,
+// а если pointers == true - и через указатели. path - значения, через которые мы пришли к v.
+func hasCycle(v reflect.Value, pointers bool, path map[cycleKey]struct{}) bool {
+	switch v.Kind() {
+	case reflect.Interface:
+		return !v.IsNil() && hasCycle(v.Elem(), pointers, path)
+	case reflect.Pointer:
+		return pointers && !v.IsNil() && visit(v, path, func(path map[cycleKey]struct{}) bool {
+			return hasCycle(v.Elem(), pointers, path)
+		})
+	case reflect.Map:
+		return !v.IsNil() && visit(v, path, func(path map[cycleKey]struct{}) bool {
+			iter := v.MapRange()
+			for iter.Next() {
+				if hasCycle(iter.Key(), pointers, path) || hasCycle(iter.Value(), pointers, path) {
+					return true
+				}
+			}
+			return false
+		})
+	case reflect.Slice:
+		return !v.IsNil() && visit(v, path, func(path map[cycleKey]struct{}) bool {
+			return elemsHaveCycle(v, pointers, path)
+		})
+	case reflect.Array:
+		return elemsHaveCycle(v, pointers, path)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if hasCycle(v.Field(i), pointers, path) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// Проверяет на циклы элементы среза или массива v.
+func elemsHaveCycle(v reflect.Value, pointers bool, path map[cycleKey]struct{}) bool {
+	for i := 0; i < v.Len(); i++ {
+		if hasCycle(v.Index(i), pointers, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Добавляет ссылочное значение v в путь и проверяет его содержимое функцией inner.
+// Если v уже есть в пути, это цикл.
+func visit(v reflect.Value, path map[cycleKey]struct{}, inner func(path map[cycleKey]struct{}) bool) bool {
+	key := cycleKey{ptr: v.Pointer(), typ: v.Type()}
+	if _, found := path[key]; found {
+		return true
+	}
+
+	if path == nil {
+		path = make(map[cycleKey]struct{})
+	}
+	path[key] = struct{}{}
+	defer delete(path, key)
+
+	return inner(path)
+}
@@ -0,0 +1,69 @@
+package candycache
+
+import (
+	"context"
+	"time"
+)
+
+// Ждет, пока в кэше не останется неустаревших элементов (CountLive() == 0), или пока не будет
+// отменен ctx - тогда вернет ctx.Err(). Ожидание не опрашивает кэш по таймеру: оно проверяет его
+// заново, только когда из кэша удаляется элемент (Delete, очистка, Flush и т.д.) и когда должен
+// устареть последний из элементов, бывших в кэше на момент проверки. Если в кэше есть элементы, которые
+// никогда не устаревают, дождаться можно только их удаления. Пригодится, чтобы дождаться
+// опустошения кэша перед остановкой сервиса и в тестах устаревания.
+// Если ждущих вызовов уже столько, сколько разрешает WithMaxWaiters, сразу вернет ErrTooManyWaiters.
+func (c *Cache) WaitEmpty(ctx context.Context) error {
+	if !c.enterWait() {
+		return ErrTooManyWaiters
+	}
+	defer c.exitWait()
+
+	for {
+		c.Lock()
+		if c.countLive() == 0 {
+			c.Unlock()
+			return nil
+		}
+
+		if c.empty == nil {
+			c.empty = make(chan struct{})
+		}
+		empty := c.empty
+		latest, eternal := c.latestExpiry()
+		c.Unlock()
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if !eternal {
+			timer = time.NewTimer(time.Duration(latest - c.now()))
+			expired = timer.C
+		}
+
+		select {
+		case <-empty:
+		case <-expired:
+		case <-ctx.Done():
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// Вернет самый поздний момент устаревания среди элементов кэша в Unix-наносекундах
+// и есть ли среди них элементы, которые никогда не устаревают (в том числе замороженные). Без блокировки.
+func (c *Cache) latestExpiry() (latest int64, eternal bool) {
+	for _, item := range c.storage.Range {
+		if item.destroyTimestamp == 0 || item.frozen {
+			return 0, true
+		}
+		latest = max(latest, item.destroyTimestamp)
+	}
+
+	return latest, false
+}
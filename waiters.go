@@ -0,0 +1,37 @@
+package candycache
+
+import "errors"
+
+// Ошибка, возвращаемая ожидающими вызовами, если ждущих уже столько, сколько разрешает WithMaxWaiters.
+var ErrTooManyWaiters = errors.New("candycache: too many waiters")
+
+// Ограничивает количество вызовов, одновременно ждущих кэш: WaitEmpty, GetOrWait, ожидающих
+// чужой загрузки GetOrLoad и GetOrLoadMany. Если ждущих уже n, новый вызов не встает в очередь,
+// а сразу возвращает ErrTooManyWaiters (GetOrWait, у которого нет ошибки, возвращает found == false,
+// как по истечении ожидания; GetOrLoadMany пропускает такие ключи). Так ключ, который никто
+// не записывает, не может накопить неограниченное число заблокированных горутин.
+// Сколько вызовов ждет сейчас, показывает Stats.Waiters. Если n <= 0, ограничения нет (по умолчанию).
+func WithMaxWaiters(n int) Option {
+	return func(c *Cache) {
+		c.maxWaiters = int64(max(n, 0))
+	}
+}
+
+// Учитывает новый ждущий вызов. Вернет false, если ждущих уже maxWaiters, - тогда ждать нельзя.
+func (c *Cache) enterWait() bool {
+	for {
+		waiters := c.stats.waiters.Load()
+		if c.maxWaiters > 0 && waiters >= c.maxWaiters {
+			return false
+		}
+
+		if c.stats.waiters.CompareAndSwap(waiters, waiters+1) {
+			return true
+		}
+	}
+}
+
+// Учитывает завершение ждущего вызова.
+func (c *Cache) exitWait() {
+	c.stats.waiters.Add(-1)
+}
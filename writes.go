@@ -0,0 +1,192 @@
+package candycache
+
+import (
+	"container/heap"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Ключ и количество записей по нему (см. HotWriteKeys).
+type KeyCount struct {
+	Key   string
+	Count uint64
+}
+
+// Счетчики записей по ключам за два последних окна (см. WithWriteTracking).
+type writeTracker struct {
+	window    int64        // Длина окна в наносекундах
+	maxKeys   int          // Сколько ключей помнит каждое окно
+	start     int64        // Начало текущего окна в Unix-наносекундах
+	cur, prev *writeCounts // Счетчики текущего и предыдущего окна
+}
+
+// Счетчики записей одного окна по алгоритму Space-Saving: не больше maxKeys ключей,
+// куча с наименьшим счетчиком на вершине.
+type writeCounts struct {
+	counts map[string]*writeCount
+	heap   writeHeap
+}
+
+// Счетчик записей по ключу и его место в куче.
+type writeCount struct {
+	key   string
+	count uint64
+	index int
+}
+
+// Включает подсчет записей по ключам для HotWriteKeys: каждый Set, Add, Update и другая запись,
+// создающая новую версию элемента, увеличивает счетчик ключа. Продления (GetExtend, TouchMany и т.д.)
+// и ReplaceAll не учитываются. Ключ, который постоянно записывается заново (например, потому что
+// быстро устаревает), указывает на слишком короткое время жизни - по доле попаданий этого не видно.
+// Счетчики ведутся по окнам длиной window: HotWriteKeys учитывает записи текущего и предыдущего
+// окна, то есть за последние от window до 2*window. Память ограничена: каждое окно помнит не больше
+// maxKeys ключей по алгоритму Space-Saving. Когда ключей больше, новый ключ занимает место ключа
+// с наименьшим счетчиком и наследует этот счетчик. Ключ, на который пришлось больше 1/maxKeys
+// всех записей окна, гарантированно остается, а счетчики могут быть завышены, но не больше
+// чем на наименьший счетчик окна.
+// Цена - O(log maxKeys) на каждую запись под блокировкой на запись.
+// Если window <= 0 или maxKeys <= 0, подсчет выключен (по умолчанию).
+func WithWriteTracking(window time.Duration, maxKeys int) Option {
+	return func(c *Cache) {
+		if window <= 0 || maxKeys <= 0 {
+			c.writes = nil
+			return
+		}
+
+		c.writes = &writeTracker{
+			window:  int64(window),
+			maxKeys: maxKeys,
+			cur:     newWriteCounts(maxKeys),
+			prev:    newWriteCounts(0),
+		}
+	}
+}
+
+// Возвращает до n ключей, по которым было больше всего записей за последние одно-два окна
+// WithWriteTracking, по убыванию количества записей (при равенстве - по возрастанию ключа).
+// Количество приблизительное (см. WithWriteTracking). Без WithWriteTracking вернет пустой список.
+func (c *Cache) HotWriteKeys(n int) []KeyCount {
+	if n <= 0 || c.writes == nil {
+		return []KeyCount{}
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	totals := c.writes.totals(c.now())
+	top := make([]KeyCount, 0, len(totals))
+	for key, count := range totals {
+		top = append(top, KeyCount{Key: key, Count: count})
+	}
+
+	slices.SortFunc(top, func(a, b KeyCount) int {
+		switch {
+		case a.Count > b.Count:
+			return -1
+		case a.Count < b.Count:
+			return 1
+		default:
+			return strings.Compare(a.Key, b.Key)
+		}
+	})
+
+	return top[:min(n, len(top))]
+}
+
+// Учитывает запись по ключу key в момент now. Только под блокировкой на запись.
+func (t *writeTracker) record(key string, now int64) {
+	switch elapsed := now - t.start; {
+	case elapsed < t.window:
+	case elapsed < 2*t.window:
+		t.prev, t.cur = t.cur, newWriteCounts(t.maxKeys)
+		t.start += t.window
+	default:
+		t.prev, t.cur = newWriteCounts(0), newWriteCounts(t.maxKeys)
+		t.start = now
+	}
+
+	t.cur.add(key, t.maxKeys)
+}
+
+// Забывает все учтенные записи. Только под блокировкой на запись.
+func (t *writeTracker) reset() {
+	t.start = 0
+	t.cur, t.prev = newWriteCounts(t.maxKeys), newWriteCounts(0)
+}
+
+// Вернет количество записей по ключам за окна, которые на момент now еще учитываются.
+// Счетчики не меняются, поэтому достаточно блокировки на чтение.
+func (t *writeTracker) totals(now int64) map[string]uint64 {
+	windows := []*writeCounts{}
+	switch elapsed := now - t.start; {
+	case elapsed < t.window:
+		windows = append(windows, t.cur, t.prev)
+	case elapsed < 2*t.window:
+		// Текущее окно уже стало предыдущим, а предыдущее вышло из учета.
+		windows = append(windows, t.cur)
+	}
+
+	totals := make(map[string]uint64)
+	for _, w := range windows {
+		for key, e := range w.counts {
+			totals[key] += e.count
+		}
+	}
+
+	return totals
+}
+
+// Создает пустые счетчики окна на size ключей.
+func newWriteCounts(size int) *writeCounts {
+	return &writeCounts{counts: make(map[string]*writeCount, size)}
+}
+
+// Увеличивает счетчик ключа key. Если ключей уже maxKeys, ключ занимает место ключа
+// с наименьшим счетчиком.
+func (w *writeCounts) add(key string, maxKeys int) {
+	if e, found := w.counts[key]; found {
+		e.count++
+		heap.Fix(&w.heap, e.index)
+		return
+	}
+
+	if len(w.heap) < maxKeys {
+		e := &writeCount{key: key, count: 1}
+		heap.Push(&w.heap, e)
+		w.counts[key] = e
+		return
+	}
+
+	e := w.heap[0]
+	delete(w.counts, e.key)
+	e.key = key
+	e.count++
+	w.counts[key] = e
+	heap.Fix(&w.heap, 0)
+}
+
+// Куча счетчиков записей с наименьшим счетчиком на вершине.
+type writeHeap []*writeCount
+
+func (h writeHeap) Len() int           { return len(h) }
+func (h writeHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h writeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *writeHeap) Push(x any) {
+	e := x.(*writeCount)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *writeHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}